@@ -18,6 +18,10 @@ type CloudExpressServiceSpec struct {
 	// Environment variables
 	Env map[string]string `json:"env,omitempty"`
 
+	// Environment variables read from Secret keys (the key defaults to the
+	// variable name); they take precedence over Env and EnvFrom
+	SecretEnv map[string]SecretKeyReference `json:"secretEnv,omitempty"`
+
 	// Autoscaling configuration
 	Autoscale AutoscaleSpec `json:"autoscale,omitempty"`
 
@@ -41,6 +45,140 @@ type CloudExpressServiceSpec struct {
 
 	// Deployment strategy
 	Strategy *DeploymentStrategy `json:"strategy,omitempty"`
+
+	// Database migrations run before the deployment is updated
+	Migrations *MigrationSpec `json:"migrations,omitempty"`
+
+	// Release hooks run as Jobs at well-defined points of the rollout
+	Hooks []ReleaseHook `json:"hooks,omitempty"`
+}
+
+// ReleaseHook declares a Job run at a point of the rollout
+type ReleaseHook struct {
+	// Name of the hook, unique within the service
+	Name string `json:"name"`
+
+	// When the hook runs (preDeploy, postDeploy, preRollback, postPromote)
+	Phase string `json:"phase"`
+
+	// Image to run (defaults to the service image)
+	Image string `json:"image,omitempty"`
+
+	// Command to run
+	Command []string `json:"command,omitempty"`
+
+	// Arguments for the command
+	Args []string `json:"args,omitempty"`
+
+	// Environment variables added to the service's environment
+	Env map[string]string `json:"env,omitempty"`
+
+	// Maximum duration of the hook (e.g., "10m")
+	Timeout string `json:"timeout,omitempty"`
+
+	// What a failed hook does to the rollout (Fail or Ignore, defaults to Fail)
+	FailurePolicy string `json:"failurePolicy,omitempty"`
+}
+
+// MigrationSpec declares how database migrations are run for a service
+type MigrationSpec struct {
+	// How migrations are run: "tool" runs a migration tool image against
+	// the source, "app" runs the service image with Command (defaults to "tool")
+	Mode string `json:"mode,omitempty"`
+
+	// Migration tool (flyway, migrate, sql-migrate, goose) for tool mode
+	Tool string `json:"tool,omitempty"`
+
+	// Command run in the service image for app mode (e.g., ["npx", "prisma", "migrate", "deploy"])
+	Command []string `json:"command,omitempty"`
+
+	// Args for the app mode command
+	Args []string `json:"args,omitempty"`
+
+	// Where the migration files are loaded from
+	Source MigrationSource `json:"source,omitempty"`
+
+	// Secret holding the database connection string
+	DatabaseSecretRef SecretKeyReference `json:"databaseSecretRef"`
+
+	// Maximum duration of a migration run (e.g., "5m")
+	Timeout string `json:"timeout,omitempty"`
+
+	// Number of retries before the migration job is marked failed
+	BackoffLimit *int32 `json:"backoffLimit,omitempty"`
+
+	// Whether a failed migration blocks the rollout (defaults to true)
+	BlockRollout *bool `json:"blockRollout,omitempty"`
+
+	// Only report which migrations would be applied; the rollout waits
+	// until dryRun is turned off
+	DryRun bool `json:"dryRun,omitempty"`
+
+	// Command reporting pending migrations for app mode dry runs
+	PlanCommand []string `json:"planCommand,omitempty"`
+
+	// Schema version this revision expects (e.g., the latest migration version)
+	SchemaVersion string `json:"schemaVersion,omitempty"`
+
+	// Safety classification of this revision's migrations: reversible,
+	// expand-only or destructive. Only reversible migrations are ever
+	// migrated down automatically.
+	Safety string `json:"safety,omitempty"`
+
+	// Migrate the schema down when the rollout is rolled back
+	RollbackOnFailure bool `json:"rollbackOnFailure,omitempty"`
+
+	// Command migrating down to $(TARGET_SCHEMA_VERSION) for app mode
+	DownCommand []string `json:"downCommand,omitempty"`
+}
+
+// MigrationSource defines where migration files come from
+type MigrationSource struct {
+	// ConfigMap containing the migration files (defaults to <name>-migrations)
+	ConfigMap string `json:"configMap,omitempty"`
+
+	// Directory of the migration files within an OCI or git source
+	Directory string `json:"directory,omitempty"`
+
+	// OCI artifact containing the migration files
+	OCI *OCIMigrationSource `json:"oci,omitempty"`
+
+	// Git repository containing the migration files
+	Git *GitMigrationSource `json:"git,omitempty"`
+
+	// Expected sha256 of the fetched migration files; the job fails on mismatch.
+	// Required unless the OCI ref is a digest or the git ref a commit SHA.
+	Checksum string `json:"checksum,omitempty"`
+}
+
+// OCIMigrationSource pulls migration files from an OCI artifact
+type OCIMigrationSource struct {
+	// Artifact reference by tag or digest (e.g., ghcr.io/acme/migrations@sha256:...)
+	Ref string `json:"ref"`
+
+	// Docker config Secret used to authenticate to the registry
+	PullSecret string `json:"pullSecret,omitempty"`
+}
+
+// GitMigrationSource checks migration files out of a git repository
+type GitMigrationSource struct {
+	// Repository URL
+	Repository string `json:"repository"`
+
+	// Commit to check out; branches and tags require source.checksum
+	Ref string `json:"ref"`
+
+	// Secret with username and password keys for private repositories
+	CredentialsSecret string `json:"credentialsSecret,omitempty"`
+}
+
+// SecretKeyReference selects a key of a Secret in the service's namespace
+type SecretKeyReference struct {
+	// Name of the Secret
+	Name string `json:"name"`
+
+	// Key within the Secret (defaults to DATABASE_URL)
+	Key string `json:"key,omitempty"`
 }
 
 // AutoscaleSpec defines autoscaling parameters
@@ -107,6 +245,46 @@ type HealthGateSpec struct {
 
 	// Enable/disable health gating
 	Enabled bool `json:"enabled,omitempty"`
+
+	// Synthetic smoke tests run against the new pods before traffic is shifted
+	SmokeTest *SmokeTestSpec `json:"smokeTest,omitempty"`
+}
+
+// SmokeTestSpec defines synthetic checks that gate a rollout.
+// Either Image (with Command) or HTTPChecks must be set.
+type SmokeTestSpec struct {
+	// Container image running a custom smoke test suite
+	Image string `json:"image,omitempty"`
+
+	// Command for the custom smoke test image
+	Command []string `json:"command,omitempty"`
+
+	// HTTP checks to run when no custom image is specified
+	HTTPChecks []HTTPCheck `json:"httpChecks,omitempty"`
+
+	// Service port to target (defaults to the first service port)
+	Port int32 `json:"port,omitempty"`
+
+	// Maximum duration of the smoke test job (e.g., "2m")
+	Timeout string `json:"timeout,omitempty"`
+}
+
+// HTTPCheck defines a single synthetic HTTP request and its expectations
+type HTTPCheck struct {
+	// HTTP method (defaults to GET)
+	Method string `json:"method,omitempty"`
+
+	// Request path
+	Path string `json:"path"`
+
+	// Expected HTTP status code (defaults to 200)
+	ExpectedStatus int32 `json:"expectedStatus,omitempty"`
+
+	// Regular expression the response body must match
+	BodyRegex string `json:"bodyRegex,omitempty"`
+
+	// Maximum response latency in milliseconds
+	MaxLatency int32 `json:"maxLatency,omitempty"`
 }
 
 // DeploymentStrategy defines how deployments are rolled out
@@ -128,6 +306,36 @@ type CanaryStrategy struct {
 
 	// Auto-promote if healthy
 	AutoPromote bool `json:"autoPromote,omitempty"`
+
+	// Load test that must pass before the canary is promoted
+	LoadTest *LoadTestSpec `json:"loadTest,omitempty"`
+}
+
+// LoadTestSpec defines a synthetic load test run against the canary before promotion
+type LoadTestSpec struct {
+	// Load testing image (defaults to grafana/k6)
+	Image string `json:"image,omitempty"`
+
+	// ConfigMap containing the load test script
+	ScriptConfigMap string `json:"scriptConfigMap"`
+
+	// Key of the script within the ConfigMap (defaults to "script.js")
+	ScriptKey string `json:"scriptKey,omitempty"`
+
+	// Number of virtual users
+	VUs int32 `json:"vus,omitempty"`
+
+	// Duration of the load test (e.g., "2m")
+	Duration string `json:"duration,omitempty"`
+
+	// Maximum P95 latency in milliseconds under load
+	MaxP95Latency int32 `json:"maxP95Latency,omitempty"`
+
+	// Maximum error rate as percentage under load
+	MaxErrorRate float64 `json:"maxErrorRate,omitempty"`
+
+	// Maximum duration of the load test job
+	Timeout string `json:"timeout,omitempty"`
 }
 
 // CloudExpressServiceStatus defines the observed state of CloudExpressService
@@ -161,6 +369,129 @@ type CloudExpressServiceStatus struct {
 
 	// Conditions represent the latest available observations
 	Conditions []metav1.Condition `json:"conditions,omitempty"`
+
+	// Result of the most recent pre-promotion load test
+	LoadTest *LoadTestResult `json:"loadTest,omitempty"`
+
+	// Database migration progress for the current image and migration set
+	Migration *MigrationStatus `json:"migration,omitempty"`
+
+	// Schema version expected by recently deployed images
+	SchemaHistory []SchemaRevision `json:"schemaHistory,omitempty"`
+
+	// Most recent run of each release hook
+	Hooks []HookStatus `json:"hooks,omitempty"`
+}
+
+// HookStatus tracks the most recent Job of a release hook
+type HookStatus struct {
+	// Name of the hook
+	Name string `json:"name"`
+
+	// Phase the hook ran in
+	Phase string `json:"phase"`
+
+	// Name of the hook job
+	JobName string `json:"jobName,omitempty"`
+
+	// Service image the hook ran for
+	Image string `json:"image,omitempty"`
+
+	// State of the job (Pending, Running, Succeeded, Failed)
+	State string `json:"state,omitempty"`
+
+	// Time the job started
+	StartedAt metav1.Time `json:"startedAt,omitempty"`
+
+	// Time the job finished
+	CompletedAt metav1.Time `json:"completedAt,omitempty"`
+
+	// Details about the current state
+	Message string `json:"message,omitempty"`
+
+	// Tail of the job's output when it failed
+	Logs string `json:"logs,omitempty"`
+}
+
+// SchemaRevision records the schema version an image was deployed with
+type SchemaRevision struct {
+	// Image of the revision
+	Image string `json:"image"`
+
+	// Schema version the image expects
+	SchemaVersion string `json:"schemaVersion"`
+
+	// Safety classification of the migrations that produced this version
+	Safety string `json:"safety,omitempty"`
+
+	// Version of the migration set that produced this version
+	SourceVersion string `json:"sourceVersion,omitempty"`
+
+	// Time the migrations were applied
+	AppliedAt metav1.Time `json:"appliedAt,omitempty"`
+}
+
+// MigrationStatus tracks the migration job for an image and migration set
+type MigrationStatus struct {
+	// Phase of the migration (Pending, Running, Succeeded, Failed)
+	Phase string `json:"phase,omitempty"`
+
+	// Name of the migration job
+	JobName string `json:"jobName,omitempty"`
+
+	// Image the migrations were run for
+	Image string `json:"image,omitempty"`
+
+	// Checksum of the migration set
+	Checksum string `json:"checksum,omitempty"`
+
+	// Version of the migration set (ConfigMap, OCI reference or git ref)
+	SourceVersion string `json:"sourceVersion,omitempty"`
+
+	// Number of jobs started for this image and migration set
+	Attempts int32 `json:"attempts,omitempty"`
+
+	// Time the current attempt started
+	StartedAt metav1.Time `json:"startedAt,omitempty"`
+
+	// Time the current attempt finished
+	CompletedAt metav1.Time `json:"completedAt,omitempty"`
+
+	// Details about the current phase
+	Message string `json:"message,omitempty"`
+
+	// Tail of the migration job's output when it failed
+	Logs string `json:"logs,omitempty"`
+
+	// Output of the most recent dry run for this migration set
+	Plan string `json:"plan,omitempty"`
+}
+
+// LoadTestResult records the outcome of a pre-promotion load test
+type LoadTestResult struct {
+	// Image the load test was run against
+	Image string `json:"image,omitempty"`
+
+	// Name of the load test job
+	JobName string `json:"jobName,omitempty"`
+
+	// Whether the thresholds held
+	Passed bool `json:"passed"`
+
+	// Measured P95 latency in milliseconds
+	P95Latency float64 `json:"p95Latency,omitempty"`
+
+	// Measured error rate as percentage
+	ErrorRate float64 `json:"errorRate,omitempty"`
+
+	// Total requests made
+	Requests int64 `json:"requests,omitempty"`
+
+	// Explanation of the result
+	Message string `json:"message,omitempty"`
+
+	// Completion time
+	CompletedAt metav1.Time `json:"completedAt,omitempty"`
 }
 
 // +kubebuilder:object:root=true
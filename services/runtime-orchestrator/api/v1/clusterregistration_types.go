@@ -0,0 +1,74 @@
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:resource:scope=Cluster,shortName=creg
+// +kubebuilder:printcolumn:name="Region",type=string,JSONPath=`.spec.region`
+// +kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.phase`
+// +kubebuilder:printcolumn:name="Version",type=string,JSONPath=`.status.kubernetesVersion`
+
+// ClusterRegistration registers a cluster that MultiRegionServices deploy to
+type ClusterRegistration struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   ClusterRegistrationSpec   `json:"spec,omitempty"`
+	Status ClusterRegistrationStatus `json:"status,omitempty"`
+}
+
+type ClusterRegistrationSpec struct {
+	// Region served by the cluster (defaults to the registration name)
+	Region string `json:"region,omitempty"`
+
+	// API server URL, required with token credentials
+	Endpoint string `json:"endpoint,omitempty"`
+
+	// Secret with a "kubeconfig" key, or "token" and "ca.crt" keys for a
+	// service account; the operator's own cluster is used if not set
+	CredentialsSecret *SecretReference `json:"credentialsSecret,omitempty"`
+
+	// Stop deploying to the cluster without removing the registration
+	Disabled bool `json:"disabled,omitempty"`
+}
+
+type SecretReference struct {
+	// Name of the Secret
+	Name string `json:"name"`
+
+	// Namespace of the Secret
+	Namespace string `json:"namespace"`
+}
+
+type ClusterRegistrationStatus struct {
+	// Connected, Unreachable or Invalid
+	Phase string `json:"phase,omitempty"`
+
+	// Details about the phase
+	Message string `json:"message,omitempty"`
+
+	// Version reported by the API server
+	KubernetesVersion string `json:"kubernetesVersion,omitempty"`
+
+	// Failed health checks in a row
+	ConsecutiveFailures int32 `json:"consecutiveFailures,omitempty"`
+
+	// Last health check time
+	LastHealthCheck metav1.Time `json:"lastHealthCheck,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// ClusterRegistrationList contains a list of ClusterRegistration
+type ClusterRegistrationList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ClusterRegistration `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&ClusterRegistration{}, &ClusterRegistrationList{})
+}
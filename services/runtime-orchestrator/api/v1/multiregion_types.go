@@ -96,6 +96,10 @@ type LoadBalancerConfig struct {
 	// DNS configuration
 	Domain string `json:"domain"`
 
+	// DNS provider publishing the domain (route53, cloudflare, rfc2136).
+	// Defaults to route53.
+	Provider string `json:"provider,omitempty"`
+
 	// TLS configuration
 	TLS *TLSConfig `json:"tls,omitempty"`
 
@@ -166,6 +170,12 @@ type RegionStatus struct {
 	// Health status
 	Healthy bool `json:"healthy"`
 
+	// Number of consecutive failed health checks
+	ConsecutiveFailures int32 `json:"consecutiveFailures,omitempty"`
+
+	// Reason the last health check failed
+	Message string `json:"message,omitempty"`
+
 	// Last health check time
 	LastHealthCheck metav1.Time `json:"lastHealthCheck,omitempty"`
 }
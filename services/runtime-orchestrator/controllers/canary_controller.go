@@ -12,6 +12,8 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/gateway-api/apis/v1beta1"
 
@@ -21,6 +23,7 @@ import (
 // CanaryController manages canary deployments
 type CanaryController struct {
 	client        client.Client
+	kubeClient    kubernetes.Interface
 	log           logr.Logger
 	healthMonitor *HealthMonitor
 }
@@ -52,19 +55,72 @@ func (c *CanaryController) DeployCanary(ctx context.Context, cxs *cloudxv1.Cloud
 		return fmt.Errorf("failed to create stable deployment: %w", err)
 	}
 
+	// Keep all traffic on stable until smoke tests have passed
+	initialWeight := canaryConfig.InitialWeight
+	if hasSmokeTest(cxs) {
+		initialWeight = 0
+	}
+
 	// Configure traffic splitting using Gateway API
-	if err := c.configureTrafficSplitting(ctx, cxs, canaryConfig.InitialWeight); err != nil {
+	if err := c.configureTrafficSplitting(ctx, cxs, initialWeight); err != nil {
 		return fmt.Errorf("failed to configure traffic splitting: %w", err)
 	}
 
 	// Start canary monitoring
-	if canaryConfig.AutoPromote {
+	if hasSmokeTest(cxs) {
+		go c.gateCanaryOnSmokeTest(ctx, cxs, canaryConfig)
+	} else if canaryConfig.AutoPromote {
 		go c.monitorCanary(ctx, cxs, canaryConfig)
 	}
 
 	return nil
 }
 
+// gateCanaryOnSmokeTest runs smoke tests against the canary backend and only
+// shifts traffic to it once they pass
+func (c *CanaryController) gateCanaryOnSmokeTest(ctx context.Context, cxs *cloudxv1.CloudExpressService, config *cloudxv1.CanaryStrategy) {
+	runner := &SmokeTestRunner{
+		client:     c.client,
+		kubeClient: c.kubeClient,
+		log:        c.log.WithName("smoke-test"),
+	}
+
+	result, err := runner.Run(ctx, cxs, fmt.Sprintf("%s-canary", cxs.Name))
+	if err != nil || !result.Passed {
+		message := ""
+		if err != nil {
+			message = fmt.Sprintf("Canary smoke tests could not be run: %v", err)
+		} else {
+			message = fmt.Sprintf("Canary smoke tests failed (job %s):\n%s", result.JobName, result.Logs)
+		}
+
+		c.log.Error(err, "Canary smoke tests failed, rolling back", "service", cxs.Name)
+		if err := c.rollbackCanary(ctx, cxs); err != nil {
+			c.log.Error(err, "Failed to roll back canary")
+		}
+
+		cxs.Status.Message = message
+		if err := c.client.Status().Update(ctx, cxs); err != nil {
+			c.log.Error(err, "Failed to update status after smoke test failure")
+		}
+		return
+	}
+
+	c.log.Info("Canary smoke tests passed, shifting traffic",
+		"service", cxs.Name,
+		"weight", config.InitialWeight)
+
+	if err := c.configureTrafficSplitting(ctx, cxs, config.InitialWeight); err != nil {
+		c.log.Error(err, "Failed to shift traffic to canary")
+		c.rollbackCanary(ctx, cxs)
+		return
+	}
+
+	if config.AutoPromote {
+		c.monitorCanary(ctx, cxs, config)
+	}
+}
+
 func (c *CanaryController) constructCanaryDeployment(cxs *cloudxv1.CloudExpressService) *appsv1.Deployment {
 	deployment := constructDeploymentFromService(cxs)
 	deployment.Name = fmt.Sprintf("%s-canary", cxs.Name)
@@ -195,7 +251,18 @@ func (c *CanaryController) monitorCanary(ctx context.Context, cxs *cloudxv1.Clou
 	for {
 		select {
 		case <-monitorCtx.Done():
-			// Observation period complete, promote canary
+			// Observation period complete, promote canary once it holds up under load
+			if !c.passesLoadTest(ctx, cxs, config) {
+				c.rollbackCanary(ctx, cxs)
+				message := fmt.Sprintf("Canary failed load test: %s", cxs.Status.LoadTest.Message)
+				if err := c.updateStatus(ctx, cxs, func(status *cloudxv1.CloudExpressServiceStatus) {
+					status.Phase = "Failed"
+					status.Message = message
+				}); err != nil {
+					c.log.Error(err, "Failed to update status after load test failure")
+				}
+				return
+			}
 			c.promoteCanary(ctx, cxs)
 			return
 			
@@ -227,6 +294,63 @@ func (c *CanaryController) monitorCanary(ctx context.Context, cxs *cloudxv1.Clou
 	}
 }
 
+// passesLoadTest runs the configured load test against the canary backend and
+// records the result in status. Without a load test the canary always passes.
+func (c *CanaryController) passesLoadTest(ctx context.Context, cxs *cloudxv1.CloudExpressService, config *cloudxv1.CanaryStrategy) bool {
+	if config.LoadTest == nil {
+		return true
+	}
+
+	runner := &LoadTestRunner{
+		client:     c.client,
+		kubeClient: c.kubeClient,
+		log:        c.log.WithName("load-test"),
+	}
+
+	result, err := runner.Run(ctx, cxs, config.LoadTest, fmt.Sprintf("%s-canary", cxs.Name))
+	if err != nil {
+		c.log.Error(err, "Failed to run load test", "service", cxs.Name)
+		result = &cloudxv1.LoadTestResult{
+			Image:       cxs.Spec.Image,
+			Passed:      false,
+			Message:     fmt.Sprintf("load test could not be run: %v", err),
+			CompletedAt: metav1.Now(),
+		}
+	}
+
+	if err := c.updateStatus(ctx, cxs, func(status *cloudxv1.CloudExpressServiceStatus) {
+		status.LoadTest = result
+	}); err != nil {
+		c.log.Error(err, "Failed to record load test result")
+		cxs.Status.LoadTest = result
+	}
+
+	c.log.Info("Load test finished",
+		"service", cxs.Name,
+		"passed", result.Passed,
+		"message", result.Message)
+
+	return result.Passed
+}
+
+// updateStatus applies mutate to the latest status of the service. The
+// monitor's copy dates from the start of the observation period, so the
+// service is re-fetched and the update retried on conflicts.
+func (c *CanaryController) updateStatus(ctx context.Context, cxs *cloudxv1.CloudExpressService, mutate func(*cloudxv1.CloudExpressServiceStatus)) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		latest := &cloudxv1.CloudExpressService{}
+		if err := c.client.Get(ctx, client.ObjectKeyFromObject(cxs), latest); err != nil {
+			return err
+		}
+		mutate(&latest.Status)
+		if err := c.client.Status().Update(ctx, latest); err != nil {
+			return err
+		}
+		*cxs = *latest
+		return nil
+	})
+}
+
 func (c *CanaryController) promoteCanary(ctx context.Context, cxs *cloudxv1.CloudExpressService) error {
 	c.log.Info("Promoting canary to stable", "service", cxs.Name)
 
@@ -263,7 +387,43 @@ func (c *CanaryController) promoteCanary(ctx context.Context, cxs *cloudxv1.Clou
 	}
 
 	// Reset traffic to 100% stable
-	return c.configureTrafficSplitting(ctx, cxs, 0)
+	if err := c.configureTrafficSplitting(ctx, cxs, 0); err != nil {
+		return err
+	}
+
+	return c.runPostPromoteHooks(ctx, cxs)
+}
+
+// runPostPromoteHooks runs the service's postPromote hooks against the promoted
+// release and records their outcome in status
+func (c *CanaryController) runPostPromoteHooks(ctx context.Context, cxs *cloudxv1.CloudExpressService) error {
+	if !hasHooks(cxs, HookPhasePostPromote) {
+		return nil
+	}
+
+	runner := &HookRunner{
+		client:     c.client,
+		kubeClient: c.kubeClient,
+		log:        c.log.WithName("hooks"),
+	}
+
+	// The canary has already been promoted, so a failure is reported rather than rolled back
+	hookErr := runner.RunHooksAndWait(ctx, cxs, HookPhasePostPromote, "")
+	if hookErr != nil {
+		c.log.Error(hookErr, "postPromote hooks failed", "service", cxs.Name)
+	}
+
+	hookStatuses := cxs.Status.Hooks
+	if err := c.updateStatus(ctx, cxs, func(status *cloudxv1.CloudExpressServiceStatus) {
+		status.Hooks = hookStatuses
+		if hookErr != nil {
+			status.Message = fmt.Sprintf("Canary promoted but %v", hookErr)
+		}
+	}); err != nil {
+		c.log.Error(err, "Failed to record hook results")
+	}
+
+	return hookErr
 }
 
 func (c *CanaryController) rollbackCanary(ctx context.Context, cxs *cloudxv1.CloudExpressService) error {
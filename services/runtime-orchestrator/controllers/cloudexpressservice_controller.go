@@ -3,13 +3,16 @@ package controllers
 import (
 	"context"
 	"fmt"
+	"sort"
 	"time"
 
 	"github.com/go-logr/logr"
 	appsv1 "k8s.io/api/apps/v1"
 	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/api/resource"
@@ -17,6 +20,8 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
@@ -30,6 +35,8 @@ type CloudExpressServiceReconciler struct {
 	Log           logr.Logger
 	Scheme        *runtime.Scheme
 	HealthMonitor *HealthMonitor
+	KubeClient    kubernetes.Interface
+	Recorder      record.EventRecorder
 }
 
 // +kubebuilder:rbac:groups=cloudx.io,resources=cygniservices,verbs=get;list;watch;create;update;patch;delete
@@ -37,9 +44,12 @@ type CloudExpressServiceReconciler struct {
 // +kubebuilder:rbac:groups=cloudx.io,resources=cygniservices/finalizers,verbs=update
 // +kubebuilder:rbac:groups=apps,resources=deployments,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=core,resources=services,verbs=get;list;watch;create;update;patch;delete
-// +kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch
+// +kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch;create;update
 // +kubebuilder:rbac:groups=networking.k8s.io,resources=ingresses,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=autoscaling,resources=horizontalpodautoscalers,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=batch,resources=jobs,verbs=get;list;watch;create;delete
+// +kubebuilder:rbac:groups=core,resources=pods;pods/log,verbs=get;list
+// +kubebuilder:rbac:groups=core,resources=events,verbs=create;patch
 
 func (r *CloudExpressServiceReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	log := r.Log.WithValues("cygniservice", req.NamespacedName)
@@ -65,18 +75,86 @@ func (r *CloudExpressServiceReconciler) Reconcile(ctx context.Context, req ctrl.
 	cxs.Status.LastUpdateTime = metav1.Now()
 
 	// Run database migrations if needed
-	if cxs.Spec.ServiceType == "" || cxs.Spec.ServiceType == "web" {
+	if cxs.Spec.Migrations != nil || cxs.Spec.ServiceType == "" || cxs.Spec.ServiceType == "web" {
 		migrationRunner := &MigrationRunner{
-			client: r.Client,
-			log:    log.WithName("migration"),
+			client:     r.Client,
+			kubeClient: r.KubeClient,
+			scheme:     r.Scheme,
+			log:        log.WithName("migration"),
 		}
 		
-		if err := migrationRunner.RunMigrations(ctx, cxs); err != nil {
+		previousMigration := cxs.Status.Migration.DeepCopy()
+		completed, err := migrationRunner.RunMigrations(ctx, cxs)
+		if err != nil {
 			log.Error(err, "Failed to run migrations")
-			cxs.Status.Phase = "Failed"
-			cxs.Status.Message = fmt.Sprintf("Migration failed: %v", err)
-			r.updateStatus(ctx, cxs)
-			return ctrl.Result{RequeueAfter: 30 * time.Second}, err
+			if cxs.Status.Migration != nil && cxs.Status.Migration.Phase == MigrationPhaseFailed &&
+				(previousMigration == nil || previousMigration.Phase != MigrationPhaseFailed) {
+				r.recordEvent(cxs, corev1.EventTypeWarning, "MigrationFailed",
+					fmt.Sprintf("%s:\n%s", cxs.Status.Migration.Message, cxs.Status.Migration.Logs))
+			}
+
+			if migrationBlocksRollout(cxs) {
+				cxs.Status.Phase = "Failed"
+				cxs.Status.Message = fmt.Sprintf("Migration failed: %v", err)
+				r.updateStatus(ctx, cxs)
+				return ctrl.Result{RequeueAfter: 30 * time.Second}, err
+			}
+
+			// Non-blocking migrations surface the failure but let the rollout continue
+			meta.SetStatusCondition(&cxs.Status.Conditions, metav1.Condition{
+				Type:    "MigrationsApplied",
+				Status:  metav1.ConditionFalse,
+				Reason:  "MigrationFailed",
+				Message: err.Error(),
+			})
+		} else if !completed && cxs.Status.Migration.Phase == MigrationPhasePlanned {
+			// Hold the rollout until the plan has been reviewed and dryRun is turned off
+			cxs.Status.Phase = "MigrationPlanned"
+			cxs.Status.Message = cxs.Status.Migration.Message
+			if err := r.updateStatus(ctx, cxs); err != nil {
+				return ctrl.Result{}, err
+			}
+			if previousMigration == nil || previousMigration.Phase != MigrationPhasePlanned {
+				r.recordEvent(cxs, corev1.EventTypeNormal, "MigrationPlanned",
+					fmt.Sprintf("Pending migrations:\n%s", cxs.Status.Migration.Plan))
+			}
+			return ctrl.Result{}, nil
+		} else if !completed {
+			// Requeue instead of blocking the worker while the migration job runs
+			cxs.Status.Phase = "Migrating"
+			cxs.Status.Message = fmt.Sprintf("Waiting for migration job %s", cxs.Status.Migration.JobName)
+			if err := r.updateStatus(ctx, cxs); err != nil {
+				return ctrl.Result{}, err
+			}
+			return ctrl.Result{RequeueAfter: 5 * time.Second}, nil
+		}
+
+		// Persist migration progress even when the rollout phase is unchanged
+		if !equality.Semantic.DeepEqual(previousMigration, cxs.Status.Migration) {
+			if err := r.updateStatus(ctx, cxs); err != nil {
+				return ctrl.Result{}, err
+			}
+		}
+	}
+
+	// Run preDeploy hooks once migrations have been applied
+	if hasHooks(cxs, HookPhasePreDeploy) {
+		if result, done, err := r.runReleaseHooks(ctx, cxs, HookPhasePreDeploy); !done {
+			return result, err
+		}
+	}
+
+	// Hold the rollout until smoke tests have passed against the new image
+	if gatesRolloutOnSmokeTest(cxs) {
+		var current *appsv1.Deployment
+		existing := &appsv1.Deployment{}
+		if err := r.Get(ctx, types.NamespacedName{Name: cxs.Name, Namespace: cxs.Namespace}, existing); err == nil {
+			current = existing
+		} else if !errors.IsNotFound(err) {
+			return ctrl.Result{}, err
+		}
+		if result, done, err := r.gateRolloutOnSmokeTest(ctx, cxs, current); !done {
+			return result, err
 		}
 	}
 
@@ -183,7 +261,15 @@ func (r *CloudExpressServiceReconciler) Reconcile(ctx context.Context, req ctrl.
 	}
 
 	// Create or update HPA if autoscaling is configured
-	if cxs.Spec.Autoscale.Max > 0 {
+	if isHibernated(cxs) {
+		// An HPA would scale a hibernated service back up to its minimum
+		hpa := &autoscalingv2.HorizontalPodAutoscaler{}
+		hpa.Name = cxs.Name
+		hpa.Namespace = cxs.Namespace
+		if err := r.Delete(ctx, hpa); err != nil && !errors.IsNotFound(err) {
+			return ctrl.Result{}, err
+		}
+	} else if cxs.Spec.Autoscale.Max > 0 {
 		hpa := &autoscalingv2.HorizontalPodAutoscaler{}
 		hpaName := types.NamespacedName{
 			Name:      cxs.Name,
@@ -215,7 +301,10 @@ func (r *CloudExpressServiceReconciler) Reconcile(ctx context.Context, req ctrl.
 	}
 
 	// Update status phase based on deployment status
-	if deployment.Status.ReadyReplicas == deployment.Status.Replicas && deployment.Status.Replicas > 0 {
+	if isHibernated(cxs) {
+		cxs.Status.Phase = "Hibernated"
+		cxs.Status.Message = "Scaled to zero while idle"
+	} else if deployment.Status.ReadyReplicas == deployment.Status.Replicas && deployment.Status.Replicas > 0 {
 		cxs.Status.Phase = "Running"
 		cxs.Status.Message = ""
 		meta.SetStatusCondition(&cxs.Status.Conditions, metav1.Condition{
@@ -224,6 +313,18 @@ func (r *CloudExpressServiceReconciler) Reconcile(ctx context.Context, req ctrl.
 			Reason:  "DeploymentReady",
 			Message: "All replicas are ready",
 		})
+
+		// Run postDeploy hooks once the new release is serving. Ready replicas
+		// of the previous ReplicaSet do not count, so wait for the rollout of
+		// the current image to complete.
+		if hasHooks(cxs, HookPhasePostDeploy) {
+			if !rolloutComplete(deployment, cxs.Spec.Image) {
+				cxs.Status.Phase = "Deploying"
+				cxs.Status.Message = fmt.Sprintf("Waiting for %s to roll out before postDeploy hooks", cxs.Spec.Image)
+			} else if result, done, err := r.runReleaseHooks(ctx, cxs, HookPhasePostDeploy); !done {
+				return result, err
+			}
+		}
 	} else if deployment.Status.Replicas == 0 {
 		cxs.Status.Phase = "Pending"
 		cxs.Status.Message = "Waiting for replicas to start"
@@ -248,6 +349,51 @@ func (r *CloudExpressServiceReconciler) Reconcile(ctx context.Context, req ctrl.
 	return ctrl.Result{}, nil
 }
 
+// runReleaseHooks advances the hooks of a phase without blocking the worker.
+// It reports whether the rollout may continue; otherwise the returned result
+// and error should be returned from Reconcile.
+func (r *CloudExpressServiceReconciler) runReleaseHooks(ctx context.Context, cxs *cloudxv1.CloudExpressService, phase string) (ctrl.Result, bool, error) {
+	runner := &HookRunner{
+		client:     r.Client,
+		kubeClient: r.KubeClient,
+		scheme:     r.Scheme,
+		log:        r.Log.WithName("hooks"),
+	}
+
+	previous := append([]cloudxv1.HookStatus(nil), cxs.Status.Hooks...)
+	completed, err := runner.RunHooks(ctx, cxs, phase)
+	for _, failed := range newlyFailedHooks(previous, cxs.Status.Hooks) {
+		r.recordEvent(cxs, corev1.EventTypeWarning, "HookFailed", hookFailureSummary(failed))
+	}
+
+	if err != nil {
+		r.Log.Error(err, "Release hook failed", "service", cxs.Name, "phase", phase)
+		cxs.Status.Phase = "Failed"
+		cxs.Status.Message = fmt.Sprintf("Release hook failed: %v", err)
+		r.updateStatus(ctx, cxs)
+		return ctrl.Result{RequeueAfter: 30 * time.Second}, false, err
+	}
+
+	if !completed {
+		// Requeue instead of blocking the worker while the hook job runs
+		cxs.Status.Phase = "RunningHooks"
+		cxs.Status.Message = fmt.Sprintf("Waiting for %s hooks", phase)
+		if err := r.updateStatus(ctx, cxs); err != nil {
+			return ctrl.Result{}, false, err
+		}
+		return ctrl.Result{RequeueAfter: 5 * time.Second}, false, nil
+	}
+
+	// Persist hook progress even when the rollout phase is unchanged
+	if !equality.Semantic.DeepEqual(previous, cxs.Status.Hooks) {
+		if err := r.updateStatus(ctx, cxs); err != nil {
+			return ctrl.Result{}, false, err
+		}
+	}
+
+	return ctrl.Result{}, true, nil
+}
+
 func (r *CloudExpressServiceReconciler) constructDeployment(cxs *cloudxv1.CloudExpressService) *appsv1.Deployment {
 	return &appsv1.Deployment{
 		ObjectMeta: metav1.ObjectMeta{
@@ -264,6 +410,9 @@ func (r *CloudExpressServiceReconciler) constructDeploymentSpec(cxs *cloudxv1.Cl
 	if cxs.Spec.Autoscale.Min > 0 {
 		replicas = cxs.Spec.Autoscale.Min
 	}
+	if isHibernated(cxs) {
+		replicas = 0
+	}
 
 	maxUnavailable := intstr.FromInt(0) // Zero-downtime deployments
 	maxSurge := intstr.FromString("25%")
@@ -292,6 +441,12 @@ func (r *CloudExpressServiceReconciler) constructDeploymentSpec(cxs *cloudxv1.Cl
 		},
 	}
 
+	// Record the migration set the pods were rolled out against
+	if migration := cxs.Status.Migration; migration != nil && migration.Image == cxs.Spec.Image &&
+		migration.Phase == MigrationPhaseSucceeded && migration.SourceVersion != "" {
+		spec.Template.Annotations["cygni.io/migration-version"] = migration.SourceVersion
+	}
+
 	return spec
 }
 
@@ -387,22 +542,28 @@ func (r *CloudExpressServiceReconciler) constructService(cxs *cloudxv1.CloudExpr
 
 func (r *CloudExpressServiceReconciler) constructIngress(cxs *cloudxv1.CloudExpressService) *networkingv1.Ingress {
 	// Generate host based on namespace and service name
-	host := fmt.Sprintf("%s-%s.cygni.app", cxs.Name, cxs.Namespace)
-	if cxs.Namespace == "preview" || isPreviewNamespace(cxs.Namespace) {
-		host = fmt.Sprintf("%s.preview.cygni.app", cxs.Name)
+	host := serviceHost(cxs)
+
+	annotations := map[string]string{
+		"kubernetes.io/ingress.class":                "nginx",
+		"cert-manager.io/cluster-issuer":             "letsencrypt-prod",
+		"nginx.ingress.kubernetes.io/proxy-body-size": "100m",
+	}
+	// Only the access protection of previews is passed through; other
+	// ingress-nginx annotations could inject configuration into the controller
+	for _, key := range previewAccessAnnotations {
+		if value, ok := cxs.Annotations[key]; ok {
+			annotations[key] = value
+		}
 	}
 
 	pathType := networkingv1.PathTypePrefix
 	return &networkingv1.Ingress{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      cxs.Name,
-			Namespace: cxs.Namespace,
-			Labels:    r.labelsForCloudExpressService(cxs),
-			Annotations: map[string]string{
-				"kubernetes.io/ingress.class":                "nginx",
-				"cert-manager.io/cluster-issuer":             "letsencrypt-prod",
-				"nginx.ingress.kubernetes.io/proxy-body-size": "100m",
-			},
+			Name:        cxs.Name,
+			Namespace:   cxs.Namespace,
+			Labels:      r.labelsForCloudExpressService(cxs),
+			Annotations: annotations,
 		},
 		Spec: networkingv1.IngressSpec{
 			TLS: []networkingv1.IngressTLS{
@@ -481,6 +642,12 @@ func (r *CloudExpressServiceReconciler) constructHPASpec(cxs *cloudxv1.CloudExpr
 }
 
 func (r *CloudExpressServiceReconciler) constructEnvVars(cxs *cloudxv1.CloudExpressService) []corev1.EnvVar {
+	return serviceEnvVars(cxs)
+}
+
+// serviceEnvVars returns the environment shared by the service's pods and the
+// jobs that run with its image
+func serviceEnvVars(cxs *cloudxv1.CloudExpressService) []corev1.EnvVar {
 	envVars := []corev1.EnvVar{
 		{
 			Name:  "CLOUDEXPRESS_SERVICE",
@@ -498,17 +665,59 @@ func (r *CloudExpressServiceReconciler) constructEnvVars(cxs *cloudxv1.CloudExpr
 
 	// Add custom env vars
 	for key, value := range cxs.Spec.Env {
+		if _, ok := cxs.Spec.SecretEnv[key]; ok {
+			continue
+		}
 		envVars = append(envVars, corev1.EnvVar{
 			Name:  key,
 			Value: value,
 		})
 	}
 
-	// TODO: Add envFrom for secrets
+	return append(envVars, serviceSecretEnvVars(cxs)...)
+}
+
+// serviceSecretEnvVars returns the variables the service reads from Secret keys
+func serviceSecretEnvVars(cxs *cloudxv1.CloudExpressService) []corev1.EnvVar {
+	names := make([]string, 0, len(cxs.Spec.SecretEnv))
+	for name := range cxs.Spec.SecretEnv {
+		names = append(names, name)
+	}
+	sort.Strings(names)
 
+	envVars := []corev1.EnvVar{}
+	for _, name := range names {
+		ref := cxs.Spec.SecretEnv[name]
+		key := ref.Key
+		if key == "" {
+			key = name
+		}
+		envVars = append(envVars, corev1.EnvVar{
+			Name:      name,
+			ValueFrom: secretKeyRef(ref.Name, key),
+		})
+	}
 	return envVars
 }
 
+// serviceEnvFrom exposes the secret referenced by EnvFrom as environment
+// variables of the jobs that run with the service's image
+func serviceEnvFrom(cxs *cloudxv1.CloudExpressService) []corev1.EnvFromSource {
+	if cxs.Spec.EnvFrom == "" {
+		return nil
+	}
+
+	return []corev1.EnvFromSource{
+		{
+			SecretRef: &corev1.SecretEnvSource{
+				LocalObjectReference: corev1.LocalObjectReference{
+					Name: cxs.Spec.EnvFrom,
+				},
+			},
+		},
+	}
+}
+
 func (r *CloudExpressServiceReconciler) labelsForCloudExpressService(cxs *cloudxv1.CloudExpressService) map[string]string {
 	return map[string]string{
 		"app":                          cxs.Name,
@@ -529,9 +738,27 @@ func (r *CloudExpressServiceReconciler) SetupWithManager(mgr ctrl.Manager) error
 		Owns(&corev1.Service{}).
 		Owns(&networkingv1.Ingress{}).
 		Owns(&autoscalingv2.HorizontalPodAutoscaler{}).
+		Owns(&batchv1.Job{}).
 		Complete(r)
 }
 
+// rolloutComplete reports whether every replica of the Deployment runs its
+// current template with the given image and is ready
+func rolloutComplete(deployment *appsv1.Deployment, image string) bool {
+	if deploymentImage(deployment) != image || deployment.Status.ObservedGeneration < deployment.Generation {
+		return false
+	}
+
+	replicas := int32(1)
+	if deployment.Spec.Replicas != nil {
+		replicas = *deployment.Spec.Replicas
+	}
+	return replicas > 0 &&
+		deployment.Status.UpdatedReplicas == replicas &&
+		deployment.Status.ReadyReplicas == replicas &&
+		deployment.Status.Replicas == replicas
+}
+
 // Helper functions
 func hashImage(image string) string {
 	// Simple hash for change detection
@@ -542,10 +769,29 @@ func hashImage(image string) string {
 	return fmt.Sprintf("%x", h)
 }
 
+// hibernatedAnnotation scales a service to zero while it is idle
+const hibernatedAnnotation = "cygni.io/hibernated"
+
+func isHibernated(cxs *cloudxv1.CloudExpressService) bool {
+	return cxs.Annotations[hibernatedAnnotation] == "true"
+}
+
 func isPreviewNamespace(namespace string) bool {
 	return len(namespace) > 3 && namespace[:3] == "pr-"
 }
 
+// serviceHost returns the public host the CloudExpressService controller
+// assigns to a service
+func serviceHost(cxs *cloudxv1.CloudExpressService) string {
+	if host := cxs.Annotations["cygni.io/host"]; host != "" {
+		return host
+	}
+	if cxs.Namespace == "preview" || isPreviewNamespace(cxs.Namespace) {
+		return fmt.Sprintf("%s.preview.cygni.app", cxs.Name)
+	}
+	return fmt.Sprintf("%s-%s.cygni.app", cxs.Name, cxs.Namespace)
+}
+
 // monitorDeploymentHealth monitors the health of a deployment during rollout
 func (r *CloudExpressServiceReconciler) monitorDeploymentHealth(ctx context.Context, cxs *cloudxv1.CloudExpressService, deployment *appsv1.Deployment) {
 	stopCh := make(chan struct{})
@@ -571,7 +817,8 @@ func (r *CloudExpressServiceReconciler) monitorDeploymentHealth(ctx context.Cont
 				r.Log.Error(nil, "Health gate failed, rolling back deployment", 
 					"service", cxs.Name, 
 					"namespace", cxs.Namespace)
-				r.rollbackDeployment(ctx, cxs, deployment)
+				r.rollbackDeployment(ctx, cxs, deployment, "HealthGateFailed",
+					"Health gate failed, rolling back to previous version")
 				return
 			}
 		case <-ticker.C:
@@ -608,35 +855,69 @@ func (r *CloudExpressServiceReconciler) monitorDeploymentHealth(ctx context.Cont
 }
 
 // rollbackDeployment rolls back a deployment to the previous version
-func (r *CloudExpressServiceReconciler) rollbackDeployment(ctx context.Context, cxs *cloudxv1.CloudExpressService, deployment *appsv1.Deployment) {
+func (r *CloudExpressServiceReconciler) rollbackDeployment(ctx context.Context, cxs *cloudxv1.CloudExpressService, deployment *appsv1.Deployment, reason, message string) {
+	// The monitor's copy dates from the start of the rollout
+	latest := &cloudxv1.CloudExpressService{}
+	if err := r.Get(ctx, client.ObjectKeyFromObject(cxs), latest); err != nil {
+		r.Log.Error(err, "Failed to get service for rollback", "service", cxs.Name)
+		return
+	}
+	cxs = latest
+
 	if cxs.Status.PreviousImage == "" {
 		r.Log.Info("No previous image available for rollback", "service", cxs.Name)
 		return
 	}
 
-	// Update the CRD to trigger rollback
-	cxs.Spec.Image = cxs.Status.PreviousImage
-	if err := r.Update(ctx, cxs); err != nil {
-		r.Log.Error(err, "Failed to update service for rollback", "service", cxs.Name)
+	// A failing health gate should not be held up, so hook failures are reported
+	// and the rollback continues
+	if err := r.runRollbackHooks(ctx, cxs, cxs.Status.PreviousImage); err != nil {
+		r.Log.Error(err, "preRollback hooks failed", "service", cxs.Name)
+		r.recordEvent(cxs, corev1.EventTypeWarning, "HookFailed", err.Error())
+		message = fmt.Sprintf("%s; %v", message, err)
+	}
+	hookStatuses := cxs.Status.Hooks
+
+	// Revert the schema first when migrations opted in to automatic rollback.
+	// The previous image must not run against a schema it does not expect, so
+	// the rollback is abandoned when the schema cannot follow.
+	migrationStatus, err := r.rollbackSchema(ctx, cxs, cxs.Status.PreviousImage)
+	if err != nil {
+		r.Log.Error(err, "Schema could not be rolled back, keeping the current image", "service", cxs.Name)
+		aborted := fmt.Sprintf("%s; rollback to %s aborted, schema could not be rolled back: %v",
+			message, cxs.Status.PreviousImage, err)
+		if err := r.updateStatusWithRetry(ctx, cxs, func(status *cloudxv1.CloudExpressServiceStatus) {
+			status.Hooks = hookStatuses
+			status.Phase = "Failed"
+			status.Message = aborted
+		}); err != nil {
+			r.Log.Error(err, "Failed to update status after aborted rollback")
+		}
+		r.recordEvent(cxs, corev1.EventTypeWarning, "RollbackAborted", aborted)
 		return
 	}
 
-	// Update status
-	cxs.Status.Phase = "RollingBack"
-	cxs.Status.Message = "Health gate failed, rolling back to previous version"
-	if err := r.updateStatus(ctx, cxs); err != nil {
-		r.Log.Error(err, "Failed to update status during rollback")
+	// Update the CRD to trigger rollback
+	if err := r.revertImage(ctx, cxs, cxs.Status.PreviousImage, migrationStatus, func(status *cloudxv1.CloudExpressServiceStatus) {
+		status.Hooks = hookStatuses
+		status.Phase = "RollingBack"
+		status.Message = message
+	}); err != nil {
+		r.Log.Error(err, "Failed to roll back service", "service", cxs.Name)
+		return
 	}
 
 	// Emit event
-	r.recordEvent(cxs, corev1.EventTypeWarning, "HealthGateFailed", 
-		"Deployment rolled back due to health gate failure")
+	r.recordEvent(cxs, corev1.EventTypeWarning, reason, 
+		"Deployment rolled back: "+message)
 }
 
 // recordEvent records a Kubernetes event for the CloudExpressService
 func (r *CloudExpressServiceReconciler) recordEvent(cxs *cloudxv1.CloudExpressService, eventType, reason, message string) {
-	// This would use the Kubernetes event recorder
-	// For now, just log it
+	if r.Recorder != nil {
+		r.Recorder.Event(cxs, eventType, reason, message)
+	}
+
 	r.Log.Info("Event", 
 		"type", eventType,
 		"reason", reason,
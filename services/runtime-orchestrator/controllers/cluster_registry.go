@@ -0,0 +1,275 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	cloudxv1 "github.com/cygni/runtime-orchestrator/api/v1"
+)
+
+// Cluster registration phases
+const (
+	ClusterPhaseConnected   = "Connected"
+	ClusterPhaseUnreachable = "Unreachable"
+	ClusterPhaseInvalid     = "Invalid"
+)
+
+// clusterHealthInterval is how often registered clusters are checked
+const clusterHealthInterval = time.Minute
+
+// ClusterRegistry holds the clients of the registered regional clusters. It is
+// updated by the ClusterRegistration controller and read by the
+// MultiRegionService controller.
+type ClusterRegistry struct {
+	mu       sync.RWMutex
+	clusters map[string]*RegionCluster // by region
+}
+
+func NewClusterRegistry() *ClusterRegistry {
+	return &ClusterRegistry{
+		clusters: map[string]*RegionCluster{},
+	}
+}
+
+// Get returns the cluster serving a region
+func (c *ClusterRegistry) Get(region string) (*RegionCluster, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	cluster, ok := c.clusters[region]
+	return cluster, ok
+}
+
+// Regions returns the registered regions
+func (c *ClusterRegistry) Regions() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	regions := make([]string, 0, len(c.clusters))
+	for region := range c.clusters {
+		regions = append(regions, region)
+	}
+	sort.Strings(regions)
+	return regions
+}
+
+func (c *ClusterRegistry) set(cluster *RegionCluster) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// A registration serves one region, even after its region is changed
+	for region, existing := range c.clusters {
+		if existing.Registration == cluster.Registration && region != cluster.Name {
+			delete(c.clusters, region)
+		}
+	}
+	c.clusters[cluster.Name] = cluster
+}
+
+// removeRegistration drops the clusters added by a registration
+func (c *ClusterRegistry) removeRegistration(registration string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for region, cluster := range c.clusters {
+		if cluster.Registration == registration {
+			delete(c.clusters, region)
+		}
+	}
+}
+
+// ClusterRegistrationReconciler turns ClusterRegistrations into clients in
+// the ClusterRegistry and keeps checking their health
+type ClusterRegistrationReconciler struct {
+	client.Client
+	Log      logr.Logger
+	Scheme   *runtime.Scheme
+	Registry *ClusterRegistry
+}
+
+// +kubebuilder:rbac:groups=cloudx.io,resources=clusterregistrations,verbs=get;list;watch
+// +kubebuilder:rbac:groups=cloudx.io,resources=clusterregistrations/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=core,resources=secrets,verbs=get
+
+func (r *ClusterRegistrationReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := r.Log.WithValues("clusterregistration", req.Name)
+
+	registration := &cloudxv1.ClusterRegistration{}
+	if err := r.Get(ctx, req.NamespacedName, registration); err != nil {
+		if errors.IsNotFound(err) {
+			r.Registry.removeRegistration(req.Name)
+			log.Info("Removed cluster registration")
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, err
+	}
+
+	region := registration.Spec.Region
+	if region == "" {
+		region = registration.Name
+	}
+
+	if registration.Spec.Disabled {
+		r.Registry.removeRegistration(registration.Name)
+		return ctrl.Result{}, nil
+	}
+
+	previous := registration.Status.DeepCopy()
+	cluster, err := r.clusterFor(ctx, registration, region)
+	if err != nil {
+		// Bad credentials will not fix themselves, so they are not retried until changed
+		r.Registry.removeRegistration(registration.Name)
+		registration.Status.Phase = ClusterPhaseInvalid
+		registration.Status.Message = err.Error()
+		if err := r.Status().Update(ctx, registration); err != nil {
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{RequeueAfter: clusterHealthInterval}, nil
+	}
+
+	// Registered clusters are read concurrently, so the check updates a copy
+	checked := *cluster
+	cluster = &checked
+
+	version, err := cluster.discovery.ServerVersion()
+	cluster.LastHealthCheck = time.Now()
+	registration.Status.LastHealthCheck = metav1.NewTime(cluster.LastHealthCheck)
+	if err != nil {
+		cluster.Healthy = false
+		registration.Status.Phase = ClusterPhaseUnreachable
+		registration.Status.Message = err.Error()
+		registration.Status.ConsecutiveFailures++
+		log.Error(err, "Cluster health check failed", "region", region)
+	} else {
+		cluster.Healthy = true
+		registration.Status.Phase = ClusterPhaseConnected
+		registration.Status.Message = ""
+		registration.Status.KubernetesVersion = version.GitVersion
+		registration.Status.ConsecutiveFailures = 0
+	}
+	r.Registry.set(cluster)
+
+	if previous.Phase != registration.Status.Phase {
+		log.Info("Cluster registration changed phase", "region", region, "phase", registration.Status.Phase)
+	}
+	if err := r.Status().Update(ctx, registration); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	return ctrl.Result{RequeueAfter: clusterHealthInterval}, nil
+}
+
+// clusterFor returns the registered cluster, building a new client when the
+// registration or its credentials changed
+func (r *ClusterRegistrationReconciler) clusterFor(ctx context.Context, registration *cloudxv1.ClusterRegistration, region string) (*RegionCluster, error) {
+	var secret *corev1.Secret
+	source := fmt.Sprintf("%d", registration.Generation)
+	if ref := registration.Spec.CredentialsSecret; ref != nil {
+		secret = &corev1.Secret{}
+		if err := r.Get(ctx, types.NamespacedName{Name: ref.Name, Namespace: ref.Namespace}, secret); err != nil {
+			return nil, fmt.Errorf("failed to get credentials secret: %w", err)
+		}
+		source += "/" + secret.ResourceVersion
+	}
+
+	if existing, ok := r.Registry.Get(region); ok &&
+		existing.Registration == registration.Name && existing.source == source {
+		return existing, nil
+	}
+	if existing, ok := r.Registry.Get(region); ok && existing.Registration != registration.Name {
+		return nil, fmt.Errorf("region %s is already registered by %s", region, existing.Registration)
+	}
+
+	config, err := r.restConfig(registration, secret)
+	if err != nil {
+		return nil, err
+	}
+
+	remote, err := client.New(config, client.Options{Scheme: r.Scheme})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create client: %w", err)
+	}
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create discovery client: %w", err)
+	}
+
+	return &RegionCluster{
+		Name:         region,
+		Endpoint:     config.Host,
+		Client:       remote,
+		Registration: registration.Name,
+		discovery:    clientset.Discovery(),
+		source:       source,
+	}, nil
+}
+
+// restConfig builds the connection to a cluster from a kubeconfig or a
+// service account token
+func (r *ClusterRegistrationReconciler) restConfig(registration *cloudxv1.ClusterRegistration, secret *corev1.Secret) (*rest.Config, error) {
+	var config *rest.Config
+
+	switch {
+	case secret == nil:
+		local, err := ctrl.GetConfig()
+		if err != nil {
+			return nil, fmt.Errorf("failed to load local cluster config: %w", err)
+		}
+		config = rest.CopyConfig(local)
+	case len(secret.Data["kubeconfig"]) > 0:
+		parsed, err := clientcmd.RESTConfigFromKubeConfig(secret.Data["kubeconfig"])
+		if err != nil {
+			return nil, fmt.Errorf("invalid kubeconfig: %w", err)
+		}
+		config = parsed
+	case len(secret.Data["token"]) > 0:
+		if registration.Spec.Endpoint == "" {
+			return nil, fmt.Errorf("token credentials require an endpoint")
+		}
+		config = &rest.Config{
+			Host:        registration.Spec.Endpoint,
+			BearerToken: string(secret.Data["token"]),
+			TLSClientConfig: rest.TLSClientConfig{
+				CAData: secret.Data["ca.crt"],
+			},
+		}
+	default:
+		return nil, fmt.Errorf("credentials secret %s has neither a kubeconfig nor a token", secret.Name)
+	}
+
+	if registration.Spec.Endpoint != "" {
+		config.Host = registration.Spec.Endpoint
+	}
+	config.Timeout = 15 * time.Second
+	return config, nil
+}
+
+func (r *ClusterRegistrationReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	// A registry of its own would never be read by the MultiRegionService controller
+	if r.Registry == nil {
+		return fmt.Errorf("ClusterRegistrationReconciler requires the Registry shared with the MultiRegionService controller")
+	}
+
+	// Every health check writes status, so only spec changes trigger a
+	// reconcile; the periodic check picks up rotated credentials
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&cloudxv1.ClusterRegistration{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Complete(r)
+}
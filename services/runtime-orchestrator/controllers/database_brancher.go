@@ -0,0 +1,91 @@
+package controllers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// Ways a preview database can be created
+const (
+	BranchStrategyTemplate   = "template"
+	BranchStrategyDump       = "dump"
+	BranchStrategySchemaOnly = "schema-only"
+	BranchStrategyEmpty      = "empty"
+)
+
+// DatabaseBrancher creates and removes per-preview databases
+type DatabaseBrancher interface {
+	// Branch creates the database and credentials for a preview. It is
+	// idempotent: branching an existing database rotates its credentials.
+	Branch(ctx context.Context, req BranchRequest) (*DatabaseBranch, error)
+
+	// Delete drops a preview's database and credentials
+	Delete(ctx context.Context, name string) error
+
+	// List returns the preview databases the brancher created. Databases it
+	// did not create are never listed, so they are never swept.
+	List(ctx context.Context) ([]PreviewDatabase, error)
+}
+
+// PreviewDatabase is a database created by a brancher
+type PreviewDatabase struct {
+	Name      string
+	CreatedAt time.Time
+}
+
+// BranchRequest describes the database a preview needs
+type BranchRequest struct {
+	Name     string            // name of the database and role
+	Source   string            // database name on the same server, or a connection URL; empty for an empty database
+	MaxSize  resource.Quantity // larger sources are cloned without data
+	Strategy string            // template or dump; empty tries template first
+}
+
+// DatabaseBranch is a database created for a preview
+type DatabaseBranch struct {
+	Name       string
+	User       string
+	Password   string
+	URL        string // connection URL including credentials
+	Strategy   string // how the database was created
+	SourceSize int64  // size of the source in bytes, if cloned
+}
+
+// invalidIdentifierChars matches characters not allowed in generated database identifiers
+var invalidIdentifierChars = regexp.MustCompile(`[^a-z0-9_]`)
+
+// previewDatabaseName derives a database and role name from a preview namespace
+func previewDatabaseName(namespace string) string {
+	name := "preview_" + invalidIdentifierChars.ReplaceAllString(strings.ToLower(namespace), "_")
+	if len(name) > 63 {
+		// Keep names unique when truncating to the identifier limit
+		name = name[:52] + "_" + shortHash(namespace)
+	}
+	return name
+}
+
+// generatePassword returns a random password safe to embed in connection URLs
+func generatePassword() (string, error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate password: %w", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// redactDatabaseURL removes the password from a connection URL
+func redactDatabaseURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return ""
+	}
+	return u.Redacted()
+}
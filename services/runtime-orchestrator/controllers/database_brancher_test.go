@@ -0,0 +1,71 @@
+package controllers
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPreviewDatabaseName(t *testing.T) {
+	tests := []struct {
+		namespace string
+		want      string
+	}{
+		{namespace: "shop-pr-42", want: "preview_shop_pr_42"},
+		{namespace: "Shop.PR-42", want: "preview_shop_pr_42"},
+		{namespace: "a", want: "preview_a"},
+	}
+
+	for _, tt := range tests {
+		if got := previewDatabaseName(tt.namespace); got != tt.want {
+			t.Errorf("previewDatabaseName(%q) = %q, want %q", tt.namespace, got, tt.want)
+		}
+	}
+}
+
+func TestPreviewDatabaseNameTruncation(t *testing.T) {
+	long := strings.Repeat("a", 60) + "-pr-1"
+	other := strings.Repeat("a", 60) + "-pr-2"
+
+	name := previewDatabaseName(long)
+	if len(name) != 63 {
+		t.Fatalf("expected a 63 character name, got %d: %q", len(name), name)
+	}
+	if !strings.HasPrefix(name, "preview_") {
+		t.Errorf("truncated name %q lost the preview_ prefix", name)
+	}
+	if err := checkPreviewDatabaseName(name); err != nil {
+		t.Errorf("truncated name is not a valid preview database name: %v", err)
+	}
+	if name == previewDatabaseName(other) {
+		t.Errorf("namespaces sharing a long prefix map to the same database %q", name)
+	}
+	if name != previewDatabaseName(long) {
+		t.Errorf("truncated name is not stable")
+	}
+
+	// Exactly at the limit the name is kept as is
+	exact := strings.Repeat("b", 63-len("preview_"))
+	if got := previewDatabaseName(exact); got != "preview_"+exact {
+		t.Errorf("previewDatabaseName(%q) = %q, want it untruncated", exact, got)
+	}
+}
+
+func TestCheckPreviewDatabaseName(t *testing.T) {
+	tests := []struct {
+		name    string
+		wantErr bool
+	}{
+		{name: "preview_shop_pr_42"},
+		{name: "shop", wantErr: true},
+		{name: "postgres", wantErr: true},
+		{name: "preview_shop; DROP DATABASE shop", wantErr: true},
+		{name: "preview_Shop", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		err := checkPreviewDatabaseName(tt.name)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("checkPreviewDatabaseName(%q) error = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
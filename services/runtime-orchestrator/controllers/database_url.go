@@ -0,0 +1,203 @@
+package controllers
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// DatabaseEndpoint is a parsed database connection string
+type DatabaseEndpoint struct {
+	Scheme   string // postgres, mysql or sqlserver
+	Host     string
+	Port     string
+	Database string
+	User     string
+	Password string
+	Params   url.Values // driver parameters, including TLS settings
+}
+
+// defaultDatabasePorts maps normalised schemes to their default ports
+var defaultDatabasePorts = map[string]string{
+	"postgres":  "5432",
+	"mysql":     "3306",
+	"sqlserver": "1433",
+}
+
+// mysqlTCPHost matches the Go MySQL driver's "@tcp(host:port)" address form
+var mysqlTCPHost = regexp.MustCompile(`@tcp\(([^)]*)\)`)
+
+// parseDatabaseURL parses a postgres, mysql or sqlserver connection URL
+func parseDatabaseURL(raw string) (*DatabaseEndpoint, error) {
+	if raw == "" {
+		return nil, fmt.Errorf("database URL is empty")
+	}
+
+	// Accept the driver-style MySQL address so both URL forms work
+	normalized := mysqlTCPHost.ReplaceAllString(raw, "@$1")
+
+	u, err := url.Parse(normalized)
+	if err != nil {
+		// Avoid echoing the URL, which usually contains a password
+		return nil, fmt.Errorf("database URL is not a valid URL")
+	}
+
+	scheme := strings.ToLower(u.Scheme)
+	switch scheme {
+	case "postgres", "postgresql":
+		scheme = "postgres"
+	case "mysql":
+	case "sqlserver", "mssql":
+		scheme = "sqlserver"
+	default:
+		return nil, fmt.Errorf("unsupported database scheme %q", u.Scheme)
+	}
+
+	endpoint := &DatabaseEndpoint{
+		Scheme:   scheme,
+		Host:     u.Hostname(),
+		Port:     u.Port(),
+		Database: strings.TrimPrefix(u.Path, "/"),
+		Params:   u.Query(),
+	}
+
+	if endpoint.Host == "" {
+		return nil, fmt.Errorf("database URL has no host")
+	}
+	if endpoint.Port == "" {
+		endpoint.Port = defaultDatabasePorts[scheme]
+	}
+
+	// SQL Server carries the database name as a query parameter
+	if scheme == "sqlserver" && endpoint.Database == "" {
+		endpoint.Database = endpoint.Params.Get("database")
+	}
+
+	if u.User != nil {
+		endpoint.User = u.User.Username()
+		endpoint.Password, _ = u.User.Password()
+	}
+
+	return endpoint, nil
+}
+
+// TLSEnabled reports whether the connection string requests an encrypted connection
+func (e *DatabaseEndpoint) TLSEnabled() bool {
+	switch e.Scheme {
+	case "postgres":
+		mode := e.Params.Get("sslmode")
+		return mode != "" && mode != "disable" && mode != "allow" && mode != "prefer"
+	case "mysql":
+		mode := e.Params.Get("tls")
+		return mode != "" && mode != "false"
+	case "sqlserver":
+		mode := strings.ToLower(e.Params.Get("encrypt"))
+		return mode == "true" || mode == "strict"
+	}
+	return false
+}
+
+// JDBCURL returns a credential-free JDBC URL for JVM-based tools such as Flyway
+func (e *DatabaseEndpoint) JDBCURL() string {
+	address := fmt.Sprintf("%s:%s", e.Host, e.Port)
+
+	switch e.Scheme {
+	case "postgres":
+		params := url.Values{}
+		for _, key := range []string{"sslmode", "sslrootcert", "sslcert", "sslkey"} {
+			if value := e.Params.Get(key); value != "" {
+				params.Set(key, value)
+			}
+		}
+		jdbc := fmt.Sprintf("jdbc:postgresql://%s/%s", address, e.Database)
+		if len(params) > 0 {
+			jdbc += "?" + params.Encode()
+		}
+		return jdbc
+	case "mysql":
+		sslMode := "PREFERRED"
+		switch e.Params.Get("tls") {
+		case "true":
+			sslMode = "VERIFY_IDENTITY"
+		case "skip-verify", "preferred":
+			sslMode = "REQUIRED"
+		case "false":
+			sslMode = "DISABLED"
+		}
+		return fmt.Sprintf("jdbc:mysql://%s/%s?sslMode=%s", address, e.Database, sslMode)
+	case "sqlserver":
+		jdbc := fmt.Sprintf("jdbc:sqlserver://%s;databaseName=%s", address, e.Database)
+		if e.TLSEnabled() {
+			jdbc += ";encrypt=true"
+		}
+		if trust := e.Params.Get("TrustServerCertificate"); trust != "" {
+			jdbc += ";trustServerCertificate=" + trust
+		}
+		return jdbc
+	}
+	return ""
+}
+
+// DriverURL returns the connection string in the form expected by Go
+// migration tools (golang-migrate and goose), including credentials
+func (e *DatabaseEndpoint) DriverURL() string {
+	userInfo := url.UserPassword(e.User, e.Password)
+	if e.Password == "" {
+		userInfo = url.User(e.User)
+	}
+	address := fmt.Sprintf("%s:%s", e.Host, e.Port)
+
+	switch e.Scheme {
+	case "mysql":
+		return (&url.URL{
+			Scheme:   "mysql",
+			User:     userInfo,
+			Host:     "tcp(" + address + ")",
+			Path:     "/" + e.Database,
+			RawQuery: e.Params.Encode(),
+		}).String()
+	case "sqlserver":
+		params := url.Values{}
+		for key, values := range e.Params {
+			params[key] = values
+		}
+		params.Set("database", e.Database)
+		return (&url.URL{
+			Scheme:   "sqlserver",
+			User:     userInfo,
+			Host:     address,
+			RawQuery: params.Encode(),
+		}).String()
+	default:
+		return (&url.URL{
+			Scheme:   "postgres",
+			User:     userInfo,
+			Host:     address,
+			Path:     "/" + e.Database,
+			RawQuery: e.Params.Encode(),
+		}).String()
+	}
+}
+
+// GooseDriver returns the goose driver name for the scheme
+func (e *DatabaseEndpoint) GooseDriver() string {
+	if e.Scheme == "sqlserver" {
+		return "mssql"
+	}
+	return e.Scheme
+}
+
+// GooseDSN returns the DSN goose expects for the scheme
+func (e *DatabaseEndpoint) GooseDSN() string {
+	if e.Scheme != "mysql" {
+		return e.DriverURL()
+	}
+
+	// The Go MySQL driver takes a DSN rather than a URL
+	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s", e.User, e.Password, e.Host, e.Port, e.Database)
+	if len(e.Params) > 0 {
+		dsn += "?" + e.Params.Encode()
+	}
+	return dsn
+}
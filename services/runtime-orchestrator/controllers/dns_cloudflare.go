@@ -0,0 +1,198 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// CloudflareProvider routes a name through a Cloudflare load balancer with
+// one pool per region. Weighted routing uses random steering with pool
+// weights, latency routing uses dynamic steering and failover uses the pool order.
+type CloudflareProvider struct {
+	api       *apiClient
+	accountID string
+}
+
+func NewCloudflareProvider(baseURL, token, accountID string) *CloudflareProvider {
+	return &CloudflareProvider{
+		api: &apiClient{
+			baseURL:    baseURL,
+			httpClient: &http.Client{Timeout: 30 * time.Second},
+			authHeader: "Authorization",
+			authValue:  "Bearer " + token,
+		},
+		accountID: accountID,
+	}
+}
+
+// cloudflareResponse is the envelope of every Cloudflare API response
+type cloudflareResponse struct {
+	Success bool            `json:"success"`
+	Result  json.RawMessage `json:"result"`
+	Errors  []struct {
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+type cloudflarePool struct {
+	ID      string             `json:"id,omitempty"`
+	Name    string             `json:"name"`
+	Origins []cloudflareOrigin `json:"origins"`
+}
+
+type cloudflareOrigin struct {
+	Name    string  `json:"name"`
+	Address string  `json:"address"`
+	Enabled bool    `json:"enabled"`
+	Weight  float64 `json:"weight"`
+}
+
+type cloudflareLoadBalancer struct {
+	ID             string                 `json:"id,omitempty"`
+	Name           string                 `json:"name"`
+	DefaultPools   []string               `json:"default_pools"`
+	FallbackPool   string                 `json:"fallback_pool"`
+	SteeringPolicy string                 `json:"steering_policy"`
+	RandomSteering *cloudflareRandomSteer `json:"random_steering,omitempty"`
+	Proxied        bool                   `json:"proxied"`
+	TTL            int64                  `json:"ttl,omitempty"`
+}
+
+type cloudflareRandomSteer struct {
+	PoolWeights map[string]float64 `json:"pool_weights"`
+}
+
+func (p *CloudflareProvider) do(ctx context.Context, method, path string, body, out interface{}) error {
+	response := &cloudflareResponse{}
+	if err := p.api.do(ctx, method, path, body, response); err != nil {
+		return err
+	}
+	if !response.Success {
+		messages := []string{}
+		for _, e := range response.Errors {
+			messages = append(messages, e.Message)
+		}
+		return fmt.Errorf("%s %s failed: %s", method, path, strings.Join(messages, "; "))
+	}
+	if out != nil {
+		return json.Unmarshal(response.Result, out)
+	}
+	return nil
+}
+
+func (p *CloudflareProvider) ApplyRecords(ctx context.Context, name string, records []DNSRecord) error {
+	zoneID, err := p.zoneID(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	pools := []cloudflarePool{}
+	if err := p.do(ctx, http.MethodGet, fmt.Sprintf("/accounts/%s/load_balancers/pools", p.accountID), nil, &pools); err != nil {
+		return fmt.Errorf("failed to list pools: %w", err)
+	}
+	poolIDs := map[string]string{}
+	for _, pool := range pools {
+		poolIDs[pool.Name] = pool.ID
+	}
+
+	lb := cloudflareLoadBalancer{
+		Name:    name,
+		Proxied: true,
+	}
+	total := int64(0)
+	for _, record := range records {
+		total += record.Weight
+	}
+
+	for _, record := range records {
+		pool := cloudflarePool{
+			Name: cloudflarePoolName(name, record.Region),
+			Origins: []cloudflareOrigin{
+				{Name: record.Region, Address: record.Target, Enabled: true, Weight: 1},
+			},
+		}
+
+		if id, ok := poolIDs[pool.Name]; ok {
+			pool.ID = id
+			if err := p.do(ctx, http.MethodPut, fmt.Sprintf("/accounts/%s/load_balancers/pools/%s", p.accountID, id), pool, nil); err != nil {
+				return fmt.Errorf("failed to update pool %s: %w", pool.Name, err)
+			}
+		} else {
+			created := cloudflarePool{}
+			if err := p.do(ctx, http.MethodPost, fmt.Sprintf("/accounts/%s/load_balancers/pools", p.accountID), pool, &created); err != nil {
+				return fmt.Errorf("failed to create pool %s: %w", pool.Name, err)
+			}
+			pool.ID = created.ID
+		}
+
+		// Records are ordered with the failover primary first
+		lb.DefaultPools = append(lb.DefaultPools, pool.ID)
+
+		switch record.Policy {
+		case RoutingPolicyWeighted:
+			lb.SteeringPolicy = "random"
+			if lb.RandomSteering == nil {
+				lb.RandomSteering = &cloudflareRandomSteer{PoolWeights: map[string]float64{}}
+			}
+			if total > 0 {
+				lb.RandomSteering.PoolWeights[pool.ID] = float64(record.Weight) / float64(total)
+			}
+		case RoutingPolicyLatency:
+			lb.SteeringPolicy = "dynamic_latency"
+		case RoutingPolicyFailover:
+			lb.SteeringPolicy = "off"
+		default:
+			return fmt.Errorf("unsupported routing policy %q", record.Policy)
+		}
+	}
+	if len(lb.DefaultPools) == 0 {
+		return fmt.Errorf("no records to publish for %s", name)
+	}
+	lb.FallbackPool = lb.DefaultPools[len(lb.DefaultPools)-1]
+
+	balancers := []cloudflareLoadBalancer{}
+	if err := p.do(ctx, http.MethodGet, fmt.Sprintf("/zones/%s/load_balancers", zoneID), nil, &balancers); err != nil {
+		return fmt.Errorf("failed to list load balancers: %w", err)
+	}
+	for _, existing := range balancers {
+		if strings.EqualFold(existing.Name, name) {
+			if err := p.do(ctx, http.MethodPut, fmt.Sprintf("/zones/%s/load_balancers/%s", zoneID, existing.ID), lb, nil); err != nil {
+				return fmt.Errorf("failed to update load balancer %s: %w", name, err)
+			}
+			return nil
+		}
+	}
+
+	if err := p.do(ctx, http.MethodPost, fmt.Sprintf("/zones/%s/load_balancers", zoneID), lb, nil); err != nil {
+		return fmt.Errorf("failed to create load balancer %s: %w", name, err)
+	}
+	return nil
+}
+
+// zoneID finds the most specific zone containing name
+func (p *CloudflareProvider) zoneID(ctx context.Context, name string) (string, error) {
+	labels := strings.Split(strings.TrimSuffix(name, "."), ".")
+	for i := 0; i < len(labels)-1; i++ {
+		zones := []struct {
+			ID string `json:"id"`
+		}{}
+		query := url.Values{"name": []string{strings.Join(labels[i:], ".")}}
+		if err := p.do(ctx, http.MethodGet, "/zones?"+query.Encode(), nil, &zones); err != nil {
+			return "", fmt.Errorf("failed to look up zone: %w", err)
+		}
+		if len(zones) > 0 {
+			return zones[0].ID, nil
+		}
+	}
+	return "", fmt.Errorf("no Cloudflare zone found for %s", name)
+}
+
+// cloudflarePoolName names the pool of a region; pool names are account-wide
+func cloudflarePoolName(name, region string) string {
+	return fmt.Sprintf("%s-%s", strings.ReplaceAll(strings.TrimSuffix(name, "."), ".", "-"), region)
+}
@@ -0,0 +1,221 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	cloudxv1 "github.com/cygni/runtime-orchestrator/api/v1"
+)
+
+// DNS providers
+const (
+	DNSProviderRoute53    = "route53"
+	DNSProviderCloudflare = "cloudflare"
+	DNSProviderRFC2136    = "rfc2136"
+)
+
+// Routing policies of global DNS records
+const (
+	RoutingPolicyWeighted = "weighted"
+	RoutingPolicyFailover = "failover"
+	RoutingPolicyLatency  = "latency"
+)
+
+// defaultDNSRecordTTL keeps failover reasonably quick
+const defaultDNSRecordTTL = 60
+
+// DNSRecord routes a global name to one regional endpoint
+type DNSRecord struct {
+	Name    string // global name, such as api.example.com
+	Target  string // regional host name
+	Region  string // region the target serves; also the record's set identifier
+	Policy  string // weighted, failover or latency
+	Weight  int64  // share of traffic for the weighted policy
+	Primary bool   // whether this is the primary record for the failover policy
+	TTL     int64
+}
+
+// DNSProvider publishes the routing records of a global name
+type DNSProvider interface {
+	// ApplyRecords makes records the only routing records of name. All
+	// records share the same policy; failover records come primary first,
+	// followed by the other regions in order of preference.
+	ApplyRecords(ctx context.Context, name string, records []DNSRecord) error
+}
+
+// DNSProvidersFromEnv returns the providers configured in the environment.
+// Route53 is always available and uses the default AWS credential chain.
+func DNSProvidersFromEnv() (map[string]DNSProvider, error) {
+	providers := map[string]DNSProvider{
+		DNSProviderRoute53: NewRoute53Provider(),
+	}
+
+	if token := os.Getenv("CLOUDFLARE_API_TOKEN"); token != "" {
+		accountID := os.Getenv("CLOUDFLARE_ACCOUNT_ID")
+		if accountID == "" {
+			return nil, fmt.Errorf("CLOUDFLARE_ACCOUNT_ID is required with CLOUDFLARE_API_TOKEN")
+		}
+		providers[DNSProviderCloudflare] = NewCloudflareProvider("https://api.cloudflare.com/client/v4", token, accountID)
+	}
+
+	if server := os.Getenv("RFC2136_SERVER"); server != "" {
+		provider, err := NewRFC2136Provider(RFC2136Config{
+			Server:        server,
+			Zone:          os.Getenv("RFC2136_ZONE"),
+			TSIGKey:       os.Getenv("RFC2136_TSIG_KEY"),
+			TSIGSecret:    os.Getenv("RFC2136_TSIG_SECRET"),
+			TSIGAlgorithm: os.Getenv("RFC2136_TSIG_ALGORITHM"),
+		})
+		if err != nil {
+			return nil, err
+		}
+		providers[DNSProviderRFC2136] = provider
+	}
+
+	return providers, nil
+}
+
+// buildDNSRecords maps the traffic policy onto records for the healthy regions
+func buildDNSRecords(mrs *cloudxv1.MultiRegionService) ([]DNSRecord, error) {
+	policy := mrs.Spec.TrafficPolicy.Strategy
+	failover := mrs.Spec.TrafficPolicy.Failover
+	if failover != nil && failover.Enabled {
+		policy = RoutingPolicyFailover
+	}
+	if policy == "" {
+		policy = RoutingPolicyWeighted
+	}
+
+	switch policy {
+	case RoutingPolicyWeighted, RoutingPolicyLatency, RoutingPolicyFailover:
+	default:
+		return nil, fmt.Errorf("unsupported traffic policy %q", policy)
+	}
+
+	weights := map[string]int32{}
+	for _, region := range mrs.Spec.Regions {
+		weights[region.Name] = region.Weight
+	}
+
+	healthy := []cloudxv1.RegionStatus{}
+	for _, status := range mrs.Status.RegionStatus {
+		if status.Healthy && status.Endpoint != "" {
+			healthy = append(healthy, status)
+		}
+	}
+	if len(healthy) == 0 {
+		return nil, fmt.Errorf("no healthy regions to route to")
+	}
+
+	primary := ""
+	preference := map[string]int{}
+	if policy == RoutingPolicyFailover {
+		// The configured primary when healthy, otherwise the first healthy failover region
+		candidates := []string{}
+		if failover != nil {
+			candidates = append([]string{failover.PrimaryRegion}, failover.FailoverRegions...)
+		}
+		for i, candidate := range candidates {
+			if _, ok := preference[candidate]; !ok {
+				preference[candidate] = i + 1
+			}
+		}
+		for _, candidate := range candidates {
+			for _, status := range healthy {
+				if primary == "" && status.Region == candidate {
+					primary = candidate
+				}
+			}
+		}
+		if primary == "" {
+			primary = healthy[0].Region
+		}
+	}
+
+	records := []DNSRecord{}
+	for _, status := range healthy {
+		target, err := endpointHost(status.Endpoint)
+		if err != nil {
+			return nil, err
+		}
+
+		weight := int64(100 / len(mrs.Spec.Regions)) // Default equal weight
+		if weights[status.Region] > 0 {
+			weight = int64(weights[status.Region])
+		}
+
+		records = append(records, DNSRecord{
+			Name:    mrs.Spec.LoadBalancer.Domain,
+			Target:  target,
+			Region:  status.Region,
+			Policy:  policy,
+			Weight:  weight,
+			Primary: status.Region == primary,
+			TTL:     defaultDNSRecordTTL,
+		})
+	}
+
+	// The primary comes first, followed by the failover regions in order of
+	// preference and then any other regions
+	rank := func(region string) int {
+		if rank, ok := preference[region]; ok {
+			return rank
+		}
+		return len(preference) + 1
+	}
+	sort.Slice(records, func(i, j int) bool {
+		if records[i].Primary != records[j].Primary {
+			return records[i].Primary
+		}
+		if rank(records[i].Region) != rank(records[j].Region) {
+			return rank(records[i].Region) < rank(records[j].Region)
+		}
+		return records[i].Region < records[j].Region
+	})
+	return records, nil
+}
+
+// endpointHost returns the host name of a regional endpoint URL
+func endpointHost(endpoint string) (string, error) {
+	if !strings.Contains(endpoint, "://") {
+		return endpoint, nil
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", fmt.Errorf("invalid regional endpoint %q: %w", endpoint, err)
+	}
+	return u.Hostname(), nil
+}
+
+// InMemoryDNSProvider keeps records in memory, for local development and tests
+type InMemoryDNSProvider struct {
+	mu      sync.Mutex
+	records map[string][]DNSRecord
+}
+
+func NewInMemoryDNSProvider() *InMemoryDNSProvider {
+	return &InMemoryDNSProvider{
+		records: map[string][]DNSRecord{},
+	}
+}
+
+func (p *InMemoryDNSProvider) ApplyRecords(ctx context.Context, name string, records []DNSRecord) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.records[name] = append([]DNSRecord{}, records...)
+	return nil
+}
+
+// Records returns the records published for a name
+func (p *InMemoryDNSProvider) Records(name string) []DNSRecord {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return append([]DNSRecord{}, p.records[name]...)
+}
@@ -0,0 +1,166 @@
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	cloudxv1 "github.com/cygni/runtime-orchestrator/api/v1"
+)
+
+// testMultiRegionService routes api.example.com to the given regions
+func testMultiRegionService(policy cloudxv1.TrafficPolicy, regions []cloudxv1.RegionConfig, statuses ...cloudxv1.RegionStatus) *cloudxv1.MultiRegionService {
+	mrs := &cloudxv1.MultiRegionService{}
+	mrs.Spec.Regions = regions
+	mrs.Spec.TrafficPolicy = policy
+	mrs.Spec.LoadBalancer.Domain = "api.example.com"
+	mrs.Status.RegionStatus = statuses
+	return mrs
+}
+
+func healthyRegion(region string) cloudxv1.RegionStatus {
+	return cloudxv1.RegionStatus{
+		Region:   region,
+		Endpoint: "https://api." + region + ".cygni.app",
+		Healthy:  true,
+	}
+}
+
+func TestBuildDNSRecords(t *testing.T) {
+	threeRegions := []cloudxv1.RegionConfig{{Name: "eu-west-1"}, {Name: "us-east-1"}, {Name: "us-west-2"}}
+	failover := cloudxv1.TrafficPolicy{Failover: &cloudxv1.FailoverConfig{
+		Enabled:         true,
+		PrimaryRegion:   "us-east-1",
+		FailoverRegions: []string{"us-west-2", "eu-west-1"},
+	}}
+
+	// summary reduces a record to the fields under test
+	type summary struct {
+		Region  string
+		Policy  string
+		Weight  int64
+		Primary bool
+	}
+
+	tests := []struct {
+		name    string
+		mrs     *cloudxv1.MultiRegionService
+		want    []summary
+		wantErr bool
+	}{
+		{
+			name: "weighted default weights",
+			mrs: testMultiRegionService(cloudxv1.TrafficPolicy{},
+				[]cloudxv1.RegionConfig{{Name: "eu-west-1"}, {Name: "us-east-1", Weight: 70}, {Name: "us-west-2"}},
+				healthyRegion("us-east-1"), healthyRegion("eu-west-1"), healthyRegion("us-west-2")),
+			want: []summary{
+				{Region: "eu-west-1", Policy: RoutingPolicyWeighted, Weight: 33},
+				{Region: "us-east-1", Policy: RoutingPolicyWeighted, Weight: 70},
+				{Region: "us-west-2", Policy: RoutingPolicyWeighted, Weight: 33},
+			},
+		},
+		{
+			name: "unhealthy regions are left out",
+			mrs: testMultiRegionService(cloudxv1.TrafficPolicy{Strategy: RoutingPolicyLatency}, threeRegions,
+				healthyRegion("us-east-1"),
+				cloudxv1.RegionStatus{Region: "eu-west-1", Endpoint: "https://api.eu-west-1.cygni.app"},
+				healthyRegion("us-west-2")),
+			want: []summary{
+				{Region: "us-east-1", Policy: RoutingPolicyLatency, Weight: 33},
+				{Region: "us-west-2", Policy: RoutingPolicyLatency, Weight: 33},
+			},
+		},
+		{
+			name: "failover to the configured primary",
+			mrs: testMultiRegionService(failover, threeRegions,
+				healthyRegion("eu-west-1"), healthyRegion("us-east-1"), healthyRegion("us-west-2")),
+			want: []summary{
+				{Region: "us-east-1", Policy: RoutingPolicyFailover, Weight: 33, Primary: true},
+				{Region: "us-west-2", Policy: RoutingPolicyFailover, Weight: 33},
+				{Region: "eu-west-1", Policy: RoutingPolicyFailover, Weight: 33},
+			},
+		},
+		{
+			name: "failover primary unhealthy",
+			mrs: testMultiRegionService(failover, threeRegions,
+				healthyRegion("eu-west-1"),
+				cloudxv1.RegionStatus{Region: "us-east-1", Endpoint: "https://api.us-east-1.cygni.app"},
+				healthyRegion("us-west-2")),
+			want: []summary{
+				{Region: "us-west-2", Policy: RoutingPolicyFailover, Weight: 33, Primary: true},
+				{Region: "eu-west-1", Policy: RoutingPolicyFailover, Weight: 33},
+			},
+		},
+		{
+			name: "no healthy regions",
+			mrs: testMultiRegionService(failover, threeRegions,
+				cloudxv1.RegionStatus{Region: "us-east-1", Endpoint: "https://api.us-east-1.cygni.app"}),
+			wantErr: true,
+		},
+		{
+			name:    "unsupported policy",
+			mrs:     testMultiRegionService(cloudxv1.TrafficPolicy{Strategy: "geolocation"}, threeRegions, healthyRegion("us-east-1")),
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		records, err := buildDNSRecords(tt.mrs)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%s: expected an error, got %v", tt.name, records)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+
+		got := []summary{}
+		for _, record := range records {
+			got = append(got, summary{Region: record.Region, Policy: record.Policy, Weight: record.Weight, Primary: record.Primary})
+			if record.Name != "api.example.com" || record.Target != "api."+record.Region+".cygni.app" {
+				t.Errorf("%s: record %s -> %s", tt.name, record.Name, record.Target)
+			}
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: records = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestConfigureGlobalLoadBalancer(t *testing.T) {
+	provider := NewInMemoryDNSProvider()
+	r := &MultiRegionServiceReconciler{DNSProviders: map[string]DNSProvider{"memory": provider}}
+
+	mrs := testMultiRegionService(cloudxv1.TrafficPolicy{}, []cloudxv1.RegionConfig{{Name: "eu-west-1"}, {Name: "us-east-1"}},
+		healthyRegion("eu-west-1"), healthyRegion("us-east-1"))
+	mrs.Spec.LoadBalancer.Provider = "memory"
+
+	endpoint, err := r.configureGlobalLoadBalancer(context.Background(), mrs)
+	if err != nil {
+		t.Fatalf("configureGlobalLoadBalancer: %v", err)
+	}
+	if endpoint != "https://api.example.com" {
+		t.Errorf("endpoint = %q", endpoint)
+	}
+	if records := provider.Records("api.example.com"); len(records) != 2 {
+		t.Errorf("published %d records, want 2", len(records))
+	}
+
+	// Regions that become unhealthy are no longer routed to
+	mrs.Status.RegionStatus[0].Healthy = false
+	if _, err := r.configureGlobalLoadBalancer(context.Background(), mrs); err != nil {
+		t.Fatalf("configureGlobalLoadBalancer: %v", err)
+	}
+	records := provider.Records("api.example.com")
+	if len(records) != 1 || records[0].Region != "us-east-1" {
+		t.Errorf("records = %+v, want only us-east-1", records)
+	}
+
+	// Unknown providers are refused
+	mrs.Spec.LoadBalancer.Provider = "cloudflare"
+	if _, err := r.configureGlobalLoadBalancer(context.Background(), mrs); err == nil {
+		t.Error("configureGlobalLoadBalancer accepted an unconfigured provider")
+	}
+}
@@ -0,0 +1,118 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// RFC2136Config configures dynamic updates against a DNS server such as BIND
+// or CoreDNS
+type RFC2136Config struct {
+	// Server address, such as 127.0.0.1:53
+	Server string
+
+	// Zone the records are written to; defaults to the parent of each name
+	Zone string
+
+	// Optional TSIG key name, secret (base64) and algorithm
+	TSIGKey       string
+	TSIGSecret    string
+	TSIGAlgorithm string
+}
+
+// RFC2136Provider publishes records with DNS dynamic updates. Plain DNS has no
+// routing policies, so failover points a CNAME at the primary region and
+// weighted or latency routing becomes round-robin over the regional addresses.
+type RFC2136Provider struct {
+	config RFC2136Config
+	client *dns.Client
+}
+
+func NewRFC2136Provider(config RFC2136Config) (*RFC2136Provider, error) {
+	if _, _, err := net.SplitHostPort(config.Server); err != nil {
+		config.Server = net.JoinHostPort(config.Server, "53")
+	}
+
+	client := &dns.Client{Net: "tcp", Timeout: 10 * time.Second}
+	if config.TSIGKey != "" {
+		if config.TSIGSecret == "" {
+			return nil, fmt.Errorf("RFC2136_TSIG_SECRET is required with RFC2136_TSIG_KEY")
+		}
+		if config.TSIGAlgorithm == "" {
+			config.TSIGAlgorithm = dns.HmacSHA256
+		}
+		config.TSIGKey = dns.Fqdn(config.TSIGKey)
+		config.TSIGAlgorithm = dns.Fqdn(config.TSIGAlgorithm)
+		client.TsigSecret = map[string]string{config.TSIGKey: config.TSIGSecret}
+	}
+
+	return &RFC2136Provider{
+		config: config,
+		client: client,
+	}, nil
+}
+
+func (p *RFC2136Provider) ApplyRecords(ctx context.Context, name string, records []DNSRecord) error {
+	if len(records) == 0 {
+		return fmt.Errorf("no records to publish for %s", name)
+	}
+
+	fqdn := dns.Fqdn(strings.ToLower(name))
+	zone := p.config.Zone
+	if zone == "" {
+		zone = fqdn[strings.Index(fqdn, ".")+1:]
+	}
+
+	inserts := []dns.RR{}
+	switch records[0].Policy {
+	case RoutingPolicyFailover:
+		// Records are ordered with the primary first
+		inserts = append(inserts, &dns.CNAME{
+			Hdr:    dns.RR_Header{Name: fqdn, Rrtype: dns.TypeCNAME, Class: dns.ClassINET, Ttl: uint32(records[0].TTL)},
+			Target: dns.Fqdn(records[0].Target),
+		})
+	case RoutingPolicyWeighted, RoutingPolicyLatency:
+		// Weights are ignored; resolvers rotate over the addresses
+		for _, record := range records {
+			addresses, err := net.DefaultResolver.LookupIPAddr(ctx, record.Target)
+			if err != nil {
+				return fmt.Errorf("failed to resolve %s: %w", record.Target, err)
+			}
+			for _, address := range addresses {
+				header := dns.RR_Header{Name: fqdn, Class: dns.ClassINET, Ttl: uint32(record.TTL)}
+				if ip4 := address.IP.To4(); ip4 != nil {
+					header.Rrtype = dns.TypeA
+					inserts = append(inserts, &dns.A{Hdr: header, A: ip4})
+				} else {
+					header.Rrtype = dns.TypeAAAA
+					inserts = append(inserts, &dns.AAAA{Hdr: header, AAAA: address.IP})
+				}
+			}
+		}
+	default:
+		return fmt.Errorf("unsupported routing policy %q", records[0].Policy)
+	}
+
+	// Replace whatever the name pointed at in a single update
+	msg := &dns.Msg{}
+	msg.SetUpdate(dns.Fqdn(zone))
+	msg.RemoveName([]dns.RR{&dns.ANY{Hdr: dns.RR_Header{Name: fqdn, Rrtype: dns.TypeANY, Class: dns.ClassANY}}})
+	msg.Insert(inserts)
+	if p.config.TSIGKey != "" {
+		msg.SetTsig(p.config.TSIGKey, p.config.TSIGAlgorithm, 300, time.Now().Unix())
+	}
+
+	reply, _, err := p.client.ExchangeContext(ctx, msg, p.config.Server)
+	if err != nil {
+		return fmt.Errorf("failed to send DNS update: %w", err)
+	}
+	if reply.Rcode != dns.RcodeSuccess {
+		return fmt.Errorf("DNS update for %s was refused: %s", name, dns.RcodeToString[reply.Rcode])
+	}
+	return nil
+}
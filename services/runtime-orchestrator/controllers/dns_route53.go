@@ -0,0 +1,240 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/elb"
+	"github.com/aws/aws-sdk-go/service/elbv2"
+	"github.com/aws/aws-sdk-go/service/route53"
+	"github.com/aws/aws-sdk-go/service/route53/route53iface"
+)
+
+// Route53Provider publishes weighted, latency and failover records in
+// Route53. Names below a zone apex get CNAME records; the apex, where CNAMEs
+// are not allowed, gets alias records.
+type Route53Provider struct {
+	client route53iface.Route53API
+
+	// loadBalancerZoneID returns the canonical hosted zone of a load
+	// balancer, which alias records to it must name
+	loadBalancerZoneID func(ctx context.Context, region, dnsName string) (string, error)
+
+	mu    sync.Mutex
+	zones map[string]string // hosted zone ID by zone name
+}
+
+func NewRoute53Provider() *Route53Provider {
+	sess := session.Must(session.NewSession())
+	return &Route53Provider{
+		client: route53.New(sess),
+		loadBalancerZoneID: func(ctx context.Context, region, dnsName string) (string, error) {
+			return describeLoadBalancerZoneID(ctx, sess, region, dnsName)
+		},
+		zones: map[string]string{},
+	}
+}
+
+func (p *Route53Provider) ApplyRecords(ctx context.Context, name string, records []DNSRecord) error {
+	zoneID, zone, err := p.hostedZone(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	fqdn := canonicalFQDN(name)
+	recordType := route53.RRTypeCname
+	if fqdn == zone {
+		recordType = route53.RRTypeA
+	}
+
+	changes := []*route53.Change{}
+	desired := map[string]bool{}
+	secondary := false
+
+	for _, record := range records {
+		set := &route53.ResourceRecordSet{
+			Name:          aws.String(fqdn),
+			Type:          aws.String(recordType),
+			SetIdentifier: aws.String(record.Region),
+		}
+
+		switch record.Policy {
+		case RoutingPolicyWeighted:
+			set.Weight = aws.Int64(record.Weight)
+		case RoutingPolicyLatency:
+			set.Region = aws.String(record.Region)
+		case RoutingPolicyFailover:
+			// Route53 takes exactly one primary and one secondary; records
+			// come primary first, so the secondary is the next region
+			if record.Primary {
+				set.Failover = aws.String(route53.ResourceRecordSetFailoverPrimary)
+			} else if !secondary {
+				set.Failover = aws.String(route53.ResourceRecordSetFailoverSecondary)
+				secondary = true
+			} else {
+				continue
+			}
+		default:
+			return fmt.Errorf("unsupported routing policy %q", record.Policy)
+		}
+
+		if recordType == route53.RRTypeA {
+			targetZoneID, err := p.aliasTargetZoneID(ctx, record)
+			if err != nil {
+				return err
+			}
+			set.AliasTarget = &route53.AliasTarget{
+				HostedZoneId:         aws.String(targetZoneID),
+				DNSName:              aws.String(canonicalFQDN(record.Target)),
+				EvaluateTargetHealth: aws.Bool(true),
+			}
+		} else {
+			set.TTL = aws.Int64(record.TTL)
+			set.ResourceRecords = []*route53.ResourceRecord{
+				{Value: aws.String(record.Target)},
+			}
+		}
+
+		desired[record.Region] = true
+		changes = append(changes, &route53.Change{
+			Action:            aws.String(route53.ChangeActionUpsert),
+			ResourceRecordSet: set,
+		})
+	}
+
+	// Remove regions that are no longer routed to, and routing records of
+	// the other type, which cannot exist next to a CNAME
+	existing, err := p.client.ListResourceRecordSetsWithContext(ctx, &route53.ListResourceRecordSetsInput{
+		HostedZoneId:    aws.String(zoneID),
+		StartRecordName: aws.String(fqdn),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list records of %s: %w", name, err)
+	}
+	for _, set := range existing.ResourceRecordSets {
+		if aws.StringValue(set.Name) != fqdn || set.SetIdentifier == nil {
+			continue
+		}
+		switch aws.StringValue(set.Type) {
+		case recordType:
+			if desired[aws.StringValue(set.SetIdentifier)] {
+				continue
+			}
+		case route53.RRTypeA, route53.RRTypeCname:
+			// Left over from before the name's record type changed
+		default:
+			continue
+		}
+		changes = append(changes, &route53.Change{
+			Action:            aws.String(route53.ChangeActionDelete),
+			ResourceRecordSet: set,
+		})
+	}
+
+	if _, err := p.client.ChangeResourceRecordSetsWithContext(ctx, &route53.ChangeResourceRecordSetsInput{
+		HostedZoneId: aws.String(zoneID),
+		ChangeBatch:  &route53.ChangeBatch{Changes: changes},
+	}); err != nil {
+		return fmt.Errorf("failed to update Route53: %w", err)
+	}
+	return nil
+}
+
+// aliasTargetZoneID returns the hosted zone an alias record to the target
+// must name: the load balancer's canonical zone for AWS load balancers, and
+// otherwise the Route53 zone holding the target's record
+func (p *Route53Provider) aliasTargetZoneID(ctx context.Context, record DNSRecord) (string, error) {
+	if strings.HasSuffix(strings.TrimSuffix(strings.ToLower(record.Target), "."), ".elb.amazonaws.com") {
+		return p.loadBalancerZoneID(ctx, record.Region, record.Target)
+	}
+
+	zoneID, _, err := p.hostedZone(ctx, record.Target)
+	if err != nil {
+		return "", fmt.Errorf("cannot alias %s: %w", record.Target, err)
+	}
+	return zoneID, nil
+}
+
+// describeLoadBalancerZoneID looks up the canonical hosted zone of an
+// application, network or classic load balancer by its DNS name
+func describeLoadBalancerZoneID(ctx context.Context, sess *session.Session, region, dnsName string) (string, error) {
+	dnsName = strings.TrimSuffix(strings.ToLower(dnsName), ".")
+	config := aws.NewConfig().WithRegion(region)
+
+	zoneID := ""
+	err := elbv2.New(sess, config).DescribeLoadBalancersPagesWithContext(ctx, &elbv2.DescribeLoadBalancersInput{},
+		func(page *elbv2.DescribeLoadBalancersOutput, lastPage bool) bool {
+			for _, lb := range page.LoadBalancers {
+				if strings.ToLower(aws.StringValue(lb.DNSName)) == dnsName {
+					zoneID = aws.StringValue(lb.CanonicalHostedZoneId)
+					return false
+				}
+			}
+			return true
+		})
+	if err != nil {
+		return "", fmt.Errorf("failed to describe load balancers in %s: %w", region, err)
+	}
+	if zoneID != "" {
+		return zoneID, nil
+	}
+
+	err = elb.New(sess, config).DescribeLoadBalancersPagesWithContext(ctx, &elb.DescribeLoadBalancersInput{},
+		func(page *elb.DescribeLoadBalancersOutput, lastPage bool) bool {
+			for _, lb := range page.LoadBalancerDescriptions {
+				if strings.ToLower(aws.StringValue(lb.DNSName)) == dnsName {
+					zoneID = aws.StringValue(lb.CanonicalHostedZoneNameID)
+					return false
+				}
+			}
+			return true
+		})
+	if err != nil {
+		return "", fmt.Errorf("failed to describe classic load balancers in %s: %w", region, err)
+	}
+	if zoneID == "" {
+		return "", fmt.Errorf("no load balancer %s found in %s", dnsName, region)
+	}
+	return zoneID, nil
+}
+
+// hostedZone finds the most specific public hosted zone containing name and
+// returns its ID and name
+func (p *Route53Provider) hostedZone(ctx context.Context, name string) (string, string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	labels := strings.Split(strings.TrimSuffix(name, "."), ".")
+	for i := 0; i < len(labels)-1; i++ {
+		zone := canonicalFQDN(strings.Join(labels[i:], "."))
+		if id, ok := p.zones[zone]; ok {
+			return id, zone, nil
+		}
+
+		output, err := p.client.ListHostedZonesByNameWithContext(ctx, &route53.ListHostedZonesByNameInput{
+			DNSName:  aws.String(zone),
+			MaxItems: aws.String("1"),
+		})
+		if err != nil {
+			return "", "", fmt.Errorf("failed to look up hosted zone %s: %w", zone, err)
+		}
+		for _, hz := range output.HostedZones {
+			if aws.StringValue(hz.Name) == zone && (hz.Config == nil || !aws.BoolValue(hz.Config.PrivateZone)) {
+				id := strings.TrimPrefix(aws.StringValue(hz.Id), "/hostedzone/")
+				p.zones[zone] = id
+				return id, zone, nil
+			}
+		}
+	}
+
+	return "", "", fmt.Errorf("no hosted zone found for %s", name)
+}
+
+// canonicalFQDN returns name with a trailing dot, as Route53 reports names
+func canonicalFQDN(name string) string {
+	return strings.TrimSuffix(strings.ToLower(name), ".") + "."
+}
@@ -0,0 +1,146 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/route53"
+	"github.com/aws/aws-sdk-go/service/route53/route53iface"
+)
+
+// fakeRoute53 serves public hosted zones and records the submitted changes
+type fakeRoute53 struct {
+	route53iface.Route53API
+
+	zones    map[string]string // zone ID by zone name
+	existing []*route53.ResourceRecordSet
+	changes  []*route53.Change
+}
+
+func (f *fakeRoute53) ListHostedZonesByNameWithContext(ctx aws.Context, input *route53.ListHostedZonesByNameInput, opts ...request.Option) (*route53.ListHostedZonesByNameOutput, error) {
+	output := &route53.ListHostedZonesByNameOutput{}
+	if id, ok := f.zones[aws.StringValue(input.DNSName)]; ok {
+		output.HostedZones = []*route53.HostedZone{{
+			Id:   aws.String("/hostedzone/" + id),
+			Name: input.DNSName,
+		}}
+	}
+	return output, nil
+}
+
+func (f *fakeRoute53) ListResourceRecordSetsWithContext(ctx aws.Context, input *route53.ListResourceRecordSetsInput, opts ...request.Option) (*route53.ListResourceRecordSetsOutput, error) {
+	return &route53.ListResourceRecordSetsOutput{ResourceRecordSets: f.existing}, nil
+}
+
+func (f *fakeRoute53) ChangeResourceRecordSetsWithContext(ctx aws.Context, input *route53.ChangeResourceRecordSetsInput, opts ...request.Option) (*route53.ChangeResourceRecordSetsOutput, error) {
+	f.changes = input.ChangeBatch.Changes
+	return &route53.ChangeResourceRecordSetsOutput{}, nil
+}
+
+func newTestRoute53Provider(fake *fakeRoute53) *Route53Provider {
+	return &Route53Provider{
+		client: fake,
+		loadBalancerZoneID: func(ctx context.Context, region, dnsName string) (string, error) {
+			return "", fmt.Errorf("no load balancer %s", dnsName)
+		},
+		zones: map[string]string{},
+	}
+}
+
+func failoverRecords(name string, regions ...string) []DNSRecord {
+	records := []DNSRecord{}
+	for i, region := range regions {
+		records = append(records, DNSRecord{
+			Name:    name,
+			Target:  "api." + region + ".cygni.app",
+			Region:  region,
+			Policy:  RoutingPolicyFailover,
+			Primary: i == 0,
+			TTL:     defaultDNSRecordTTL,
+		})
+	}
+	return records
+}
+
+func TestRoute53PublishesOneFailoverSecondary(t *testing.T) {
+	fake := &fakeRoute53{
+		zones: map[string]string{"example.com.": "ZEXAMPLE"},
+		// The third region was the secondary before
+		existing: []*route53.ResourceRecordSet{{
+			Name:          aws.String("api.example.com."),
+			Type:          aws.String(route53.RRTypeCname),
+			SetIdentifier: aws.String("eu-west-1"),
+			Failover:      aws.String(route53.ResourceRecordSetFailoverSecondary),
+		}},
+	}
+	provider := newTestRoute53Provider(fake)
+
+	records := failoverRecords("api.example.com", "us-east-1", "us-west-2", "eu-west-1")
+	if err := provider.ApplyRecords(context.Background(), "api.example.com", records); err != nil {
+		t.Fatalf("ApplyRecords: %v", err)
+	}
+
+	upserted := map[string]string{}
+	deleted := []string{}
+	for _, change := range fake.changes {
+		set := change.ResourceRecordSet
+		if aws.StringValue(change.Action) == route53.ChangeActionDelete {
+			deleted = append(deleted, aws.StringValue(set.SetIdentifier))
+			continue
+		}
+		if aws.StringValue(set.Type) != route53.RRTypeCname || set.AliasTarget != nil {
+			t.Errorf("%s: type %s, want a CNAME below the zone apex", aws.StringValue(set.SetIdentifier), aws.StringValue(set.Type))
+		}
+		upserted[aws.StringValue(set.SetIdentifier)] = aws.StringValue(set.Failover)
+	}
+
+	want := map[string]string{
+		"us-east-1": route53.ResourceRecordSetFailoverPrimary,
+		"us-west-2": route53.ResourceRecordSetFailoverSecondary,
+	}
+	if fmt.Sprint(upserted) != fmt.Sprint(want) {
+		t.Errorf("upserted %v, want %v", upserted, want)
+	}
+	if len(deleted) != 1 || deleted[0] != "eu-west-1" {
+		t.Errorf("deleted %v, want the former secondary", deleted)
+	}
+}
+
+func TestRoute53AliasesAtZoneApex(t *testing.T) {
+	fake := &fakeRoute53{zones: map[string]string{
+		"example.com.": "ZEXAMPLE",
+		"cygni.app.":   "ZCYGNI",
+	}}
+	provider := newTestRoute53Provider(fake)
+
+	records := failoverRecords("example.com", "us-east-1", "us-west-2")
+	if err := provider.ApplyRecords(context.Background(), "example.com", records); err != nil {
+		t.Fatalf("ApplyRecords: %v", err)
+	}
+
+	if len(fake.changes) != 2 {
+		t.Fatalf("changes = %v, want 2", fake.changes)
+	}
+	for _, change := range fake.changes {
+		set := change.ResourceRecordSet
+		if aws.StringValue(set.Type) != route53.RRTypeA || set.AliasTarget == nil {
+			t.Fatalf("%s: type %s, want an alias at the zone apex", aws.StringValue(set.SetIdentifier), aws.StringValue(set.Type))
+		}
+		// The alias names the zone holding the target, not a fixed table
+		if aws.StringValue(set.AliasTarget.HostedZoneId) != "ZCYGNI" {
+			t.Errorf("alias zone = %s, want ZCYGNI", aws.StringValue(set.AliasTarget.HostedZoneId))
+		}
+		if set.TTL != nil {
+			t.Error("alias records cannot have a TTL")
+		}
+	}
+
+	// Targets outside any hosted zone cannot be aliased
+	records[1].Target = "api.us-west-2.elsewhere.net"
+	if err := provider.ApplyRecords(context.Background(), "example.com", records); err == nil {
+		t.Error("ApplyRecords aliased a target outside Route53")
+	}
+}
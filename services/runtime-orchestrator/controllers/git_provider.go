@@ -0,0 +1,275 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// Commit status states, mapped onto each provider's own states
+const (
+	CommitStatePending = "pending"
+	CommitStateSuccess = "success"
+	CommitStateFailure = "failure"
+)
+
+// CommitStatus is reported on a pull request's head commit
+type CommitStatus struct {
+	State       string
+	TargetURL   string
+	Description string
+	Context     string
+}
+
+// GitProvider reports back to pull requests on a git hosting service
+type GitProvider interface {
+	// UpsertComment creates the pull request comment containing marker, or
+	// replaces it if it already exists
+	UpsertComment(ctx context.Context, repository string, number int, marker, body string) error
+
+	// SetCommitStatus sets a status on a commit
+	SetCommitStatus(ctx context.Context, repository, sha string, status CommitStatus) error
+}
+
+// GitProvidersFromEnv returns the providers with credentials in the environment.
+// API URLs can be overridden for self-hosted instances.
+func GitProvidersFromEnv() map[string]GitProvider {
+	providers := map[string]GitProvider{}
+
+	if token := os.Getenv("PREVIEW_GITHUB_TOKEN"); token != "" {
+		baseURL := os.Getenv("PREVIEW_GITHUB_API_URL")
+		if baseURL == "" {
+			baseURL = "https://api.github.com"
+		}
+		providers[GitProviderGitHub] = NewGitHubProvider(baseURL, token)
+	}
+
+	if token := os.Getenv("PREVIEW_GITLAB_TOKEN"); token != "" {
+		baseURL := os.Getenv("PREVIEW_GITLAB_API_URL")
+		if baseURL == "" {
+			baseURL = "https://gitlab.com/api/v4"
+		}
+		providers[GitProviderGitLab] = NewGitLabProvider(baseURL, token)
+	}
+
+	return providers
+}
+
+// apiClient sends JSON requests to a provider's REST API
+type apiClient struct {
+	baseURL    string
+	httpClient *http.Client
+	authHeader string
+	authValue  string
+}
+
+func (c *apiClient) do(ctx context.Context, method, path string, body, out interface{}) error {
+	_, err := c.request(ctx, method, c.url(path), body, out)
+	return err
+}
+
+func (c *apiClient) url(path string) string {
+	return strings.TrimSuffix(c.baseURL, "/") + path
+}
+
+// request sends a request to an absolute API URL and returns the URL of the
+// next page from the Link header, or "" on the last page
+func (c *apiClient) request(ctx context.Context, method, target string, body, out interface{}) (string, error) {
+	var reader io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return "", err
+		}
+		reader = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, target, reader)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set(c.authHeader, c.authValue)
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return "", fmt.Errorf("%s %s returned %d: %s", method, req.URL.Path, resp.StatusCode, strings.TrimSpace(string(message)))
+	}
+
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return "", err
+		}
+	}
+	return c.nextPage(resp.Header.Get("Link")), nil
+}
+
+// nextPage returns the rel="next" URL of a Link header. Links off the API's
+// own base URL are ignored so the token is never sent elsewhere.
+func (c *apiClient) nextPage(link string) string {
+	for _, part := range strings.Split(link, ",") {
+		fields := strings.Split(part, ";")
+		target := strings.Trim(strings.TrimSpace(fields[0]), "<>")
+		for _, param := range fields[1:] {
+			if strings.ReplaceAll(strings.TrimSpace(param), `"`, "") == "rel=next" &&
+				strings.HasPrefix(target, strings.TrimSuffix(c.baseURL, "/")+"/") {
+				return target
+			}
+		}
+	}
+	return ""
+}
+
+// providerComment is a pull request comment or merge request note
+type providerComment struct {
+	ID   int64  `json:"id"`
+	Body string `json:"body"`
+}
+
+// findComment pages through the comments listed at path and returns the ID of
+// the first one containing marker, or 0 if there is none
+func (c *apiClient) findComment(ctx context.Context, path, marker string) (int64, error) {
+	for target := c.url(path); target != ""; {
+		comments := []providerComment{}
+		next, err := c.request(ctx, http.MethodGet, target, nil, &comments)
+		if err != nil {
+			return 0, err
+		}
+		for _, comment := range comments {
+			if strings.Contains(comment.Body, marker) {
+				return comment.ID, nil
+			}
+		}
+		target = next
+	}
+	return 0, nil
+}
+
+// GitHubProvider reports to GitHub pull requests
+type GitHubProvider struct {
+	api *apiClient
+}
+
+func NewGitHubProvider(baseURL, token string) *GitHubProvider {
+	return &GitHubProvider{
+		api: &apiClient{
+			baseURL:    baseURL,
+			httpClient: &http.Client{Timeout: 15 * time.Second},
+			authHeader: "Authorization",
+			authValue:  "Bearer " + token,
+		},
+	}
+}
+
+func (g *GitHubProvider) UpsertComment(ctx context.Context, repository string, number int, marker, body string) error {
+	id, err := g.api.findComment(ctx,
+		fmt.Sprintf("/repos/%s/issues/%d/comments?per_page=100", repository, number), marker)
+	if err != nil {
+		return fmt.Errorf("failed to list comments: %w", err)
+	}
+
+	payload := map[string]string{"body": body}
+	if id != 0 {
+		if err := g.api.do(ctx, http.MethodPatch,
+			fmt.Sprintf("/repos/%s/issues/comments/%d", repository, id), payload, nil); err != nil {
+			return fmt.Errorf("failed to update comment: %w", err)
+		}
+		return nil
+	}
+
+	if err := g.api.do(ctx, http.MethodPost,
+		fmt.Sprintf("/repos/%s/issues/%d/comments", repository, number), payload, nil); err != nil {
+		return fmt.Errorf("failed to create comment: %w", err)
+	}
+	return nil
+}
+
+func (g *GitHubProvider) SetCommitStatus(ctx context.Context, repository, sha string, status CommitStatus) error {
+	payload := map[string]string{
+		"state":       status.State,
+		"target_url":  status.TargetURL,
+		"description": status.Description,
+		"context":     status.Context,
+	}
+	if err := g.api.do(ctx, http.MethodPost,
+		fmt.Sprintf("/repos/%s/statuses/%s", repository, sha), payload, nil); err != nil {
+		return fmt.Errorf("failed to set commit status: %w", err)
+	}
+	return nil
+}
+
+// GitLabProvider reports to GitLab merge requests
+type GitLabProvider struct {
+	api *apiClient
+}
+
+func NewGitLabProvider(baseURL, token string) *GitLabProvider {
+	return &GitLabProvider{
+		api: &apiClient{
+			baseURL:    baseURL,
+			httpClient: &http.Client{Timeout: 15 * time.Second},
+			authHeader: "PRIVATE-TOKEN",
+			authValue:  token,
+		},
+	}
+}
+
+func (g *GitLabProvider) UpsertComment(ctx context.Context, repository string, number int, marker, body string) error {
+	project := url.PathEscape(repository)
+
+	id, err := g.api.findComment(ctx,
+		fmt.Sprintf("/projects/%s/merge_requests/%d/notes?per_page=100", project, number), marker)
+	if err != nil {
+		return fmt.Errorf("failed to list notes: %w", err)
+	}
+
+	payload := map[string]string{"body": body}
+	if id != 0 {
+		if err := g.api.do(ctx, http.MethodPut,
+			fmt.Sprintf("/projects/%s/merge_requests/%d/notes/%d", project, number, id), payload, nil); err != nil {
+			return fmt.Errorf("failed to update note: %w", err)
+		}
+		return nil
+	}
+
+	if err := g.api.do(ctx, http.MethodPost,
+		fmt.Sprintf("/projects/%s/merge_requests/%d/notes", project, number), payload, nil); err != nil {
+		return fmt.Errorf("failed to create note: %w", err)
+	}
+	return nil
+}
+
+func (g *GitLabProvider) SetCommitStatus(ctx context.Context, repository, sha string, status CommitStatus) error {
+	state := status.State
+	if state == CommitStateFailure {
+		state = "failed"
+	}
+
+	payload := map[string]string{
+		"state":       state,
+		"target_url":  status.TargetURL,
+		"description": status.Description,
+		"name":        status.Context,
+	}
+	if err := g.api.do(ctx, http.MethodPost,
+		fmt.Sprintf("/projects/%s/statuses/%s", url.PathEscape(repository), sha), payload, nil); err != nil {
+		return fmt.Errorf("failed to set commit status: %w", err)
+	}
+	return nil
+}
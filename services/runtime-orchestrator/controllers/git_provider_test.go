@@ -0,0 +1,373 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// recordedRequest is a request received by a fakeGitAPI
+type recordedRequest struct {
+	Method string
+	Path   string // escaped path including the query
+	Auth   string
+	Body   map[string]string
+}
+
+// fakeGitAPI serves pages of comments and records every request
+type fakeGitAPI struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	requests []recordedRequest
+
+	// Comment pages keyed by their escaped list path; each page links to the next
+	pages map[string][]providerComment
+
+	// Link header overrides keyed by escaped list path
+	links map[string]string
+}
+
+func newFakeGitAPI(t *testing.T) *fakeGitAPI {
+	api := &fakeGitAPI{
+		pages: map[string][]providerComment{},
+		links: map[string]string{},
+	}
+	api.Server = httptest.NewServer(http.HandlerFunc(api.serve))
+	t.Cleanup(api.Close)
+	return api
+}
+
+func (a *fakeGitAPI) serve(rw http.ResponseWriter, req *http.Request) {
+	request := recordedRequest{
+		Method: req.Method,
+		Path:   req.URL.EscapedPath(),
+		Auth:   req.Header.Get("Authorization") + req.Header.Get("PRIVATE-TOKEN"),
+	}
+	if req.URL.RawQuery != "" {
+		request.Path += "?" + req.URL.RawQuery
+	}
+	if req.Body != nil {
+		json.NewDecoder(req.Body).Decode(&request.Body)
+	}
+
+	a.mu.Lock()
+	a.requests = append(a.requests, request)
+	page, isList := a.pages[request.Path]
+	link := a.links[request.Path]
+	a.mu.Unlock()
+
+	if req.Method == http.MethodGet && isList {
+		if link != "" {
+			rw.Header().Set("Link", link)
+		}
+		rw.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(rw).Encode(page)
+		return
+	}
+	if req.Method == http.MethodGet {
+		http.NotFound(rw, req)
+		return
+	}
+	rw.WriteHeader(http.StatusCreated)
+	rw.Write([]byte("{}"))
+}
+
+// addPages serves comment pages at path, path&page=2 and so on, linked with
+// Link headers the way GitHub and GitLab paginate
+func (a *fakeGitAPI) addPages(path string, pages ...[]providerComment) {
+	for i, page := range pages {
+		pagePath := path
+		if i > 0 {
+			pagePath = fmt.Sprintf("%s&page=%d", path, i+1)
+		}
+		a.pages[pagePath] = page
+		if i < len(pages)-1 {
+			a.links[pagePath] = fmt.Sprintf(`<%s%s&page=%d>; rel="next", <%s%s&page=%d>; rel="last"`,
+				a.URL, path, i+2, a.URL, path, len(pages))
+		}
+	}
+}
+
+// writes returns the requests that were not GETs
+func (a *fakeGitAPI) writes() []recordedRequest {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	writes := []recordedRequest{}
+	for _, request := range a.requests {
+		if request.Method != http.MethodGet {
+			writes = append(writes, request)
+		}
+	}
+	return writes
+}
+
+func (a *fakeGitAPI) gets() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	count := 0
+	for _, request := range a.requests {
+		if request.Method == http.MethodGet {
+			count++
+		}
+	}
+	return count
+}
+
+func commentPage(start int64, count int) []providerComment {
+	comments := []providerComment{}
+	for i := 0; i < count; i++ {
+		comments = append(comments, providerComment{ID: start + int64(i), Body: "looks good"})
+	}
+	return comments
+}
+
+func TestGitHubUpsertComment(t *testing.T) {
+	const list = "/repos/acme/shop/issues/7/comments?per_page=100"
+
+	tests := []struct {
+		name      string
+		pages     [][]providerComment
+		wantWrite recordedRequest
+		wantGets  int
+	}{
+		{
+			name:      "creates the comment when there is none",
+			pages:     [][]providerComment{commentPage(1, 3)},
+			wantWrite: recordedRequest{Method: http.MethodPost, Path: "/repos/acme/shop/issues/7/comments"},
+			wantGets:  1,
+		},
+		{
+			name:      "updates the comment on the first page",
+			pages:     [][]providerComment{{{ID: 41, Body: "hello"}, {ID: 42, Body: previewCommentMarker + "\nold"}}},
+			wantWrite: recordedRequest{Method: http.MethodPatch, Path: "/repos/acme/shop/issues/comments/42"},
+			wantGets:  1,
+		},
+		{
+			name: "follows Link headers to find the comment on a later page",
+			pages: [][]providerComment{
+				commentPage(1, 100),
+				commentPage(101, 100),
+				{{ID: 250, Body: previewCommentMarker + "\nold"}},
+			},
+			wantWrite: recordedRequest{Method: http.MethodPatch, Path: "/repos/acme/shop/issues/comments/250"},
+			wantGets:  3,
+		},
+		{
+			name:      "creates the comment after reading every page",
+			pages:     [][]providerComment{commentPage(1, 100), commentPage(101, 10)},
+			wantWrite: recordedRequest{Method: http.MethodPost, Path: "/repos/acme/shop/issues/7/comments"},
+			wantGets:  2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := newFakeGitAPI(t)
+			api.addPages(list, tt.pages...)
+
+			provider := NewGitHubProvider(api.URL, "gh-token")
+			if err := provider.UpsertComment(context.Background(), "acme/shop", 7, previewCommentMarker, "new body"); err != nil {
+				t.Fatalf("UpsertComment: %v", err)
+			}
+
+			writes := api.writes()
+			if len(writes) != 1 {
+				t.Fatalf("expected one write, got %+v", writes)
+			}
+			if writes[0].Method != tt.wantWrite.Method || writes[0].Path != tt.wantWrite.Path {
+				t.Errorf("write = %s %s, want %s %s", writes[0].Method, writes[0].Path, tt.wantWrite.Method, tt.wantWrite.Path)
+			}
+			if writes[0].Body["body"] != "new body" {
+				t.Errorf("body = %q, want %q", writes[0].Body["body"], "new body")
+			}
+			if writes[0].Auth != "Bearer gh-token" {
+				t.Errorf("auth = %q, want the bearer token", writes[0].Auth)
+			}
+			if api.gets() != tt.wantGets {
+				t.Errorf("listed %d pages, want %d", api.gets(), tt.wantGets)
+			}
+		})
+	}
+}
+
+func TestGitHubUpsertCommentIgnoresForeignLinks(t *testing.T) {
+	const list = "/repos/acme/shop/issues/7/comments?per_page=100"
+
+	foreign := newFakeGitAPI(t)
+	api := newFakeGitAPI(t)
+	api.pages[list] = commentPage(1, 100)
+	api.links[list] = fmt.Sprintf(`<%s%s&page=2>; rel="next"`, foreign.URL, list)
+
+	provider := NewGitHubProvider(api.URL, "gh-token")
+	if err := provider.UpsertComment(context.Background(), "acme/shop", 7, previewCommentMarker, "new body"); err != nil {
+		t.Fatalf("UpsertComment: %v", err)
+	}
+
+	if len(foreign.requests) != 0 {
+		t.Errorf("followed a Link to another host: %+v", foreign.requests)
+	}
+}
+
+func TestGitHubUpsertCommentListError(t *testing.T) {
+	api := newFakeGitAPI(t)
+
+	provider := NewGitHubProvider(api.URL, "gh-token")
+	err := provider.UpsertComment(context.Background(), "acme/shop", 7, previewCommentMarker, "new body")
+	if err == nil || !strings.Contains(err.Error(), "failed to list comments") {
+		t.Fatalf("expected a list error, got %v", err)
+	}
+	if len(api.writes()) != 0 {
+		t.Errorf("wrote after failing to list comments: %+v", api.writes())
+	}
+}
+
+func TestGitHubSetCommitStatus(t *testing.T) {
+	api := newFakeGitAPI(t)
+
+	provider := NewGitHubProvider(api.URL, "gh-token")
+	if err := provider.SetCommitStatus(context.Background(), "acme/shop", "abc123", CommitStatus{
+		State:       CommitStateFailure,
+		TargetURL:   "https://shop-pr-7.preview.example.com",
+		Description: "Preview is failed",
+		Context:     previewStatusContext,
+	}); err != nil {
+		t.Fatalf("SetCommitStatus: %v", err)
+	}
+
+	writes := api.writes()
+	if len(writes) != 1 || writes[0].Method != http.MethodPost || writes[0].Path != "/repos/acme/shop/statuses/abc123" {
+		t.Fatalf("unexpected requests %+v", writes)
+	}
+	want := map[string]string{
+		"state":       "failure",
+		"target_url":  "https://shop-pr-7.preview.example.com",
+		"description": "Preview is failed",
+		"context":     previewStatusContext,
+	}
+	for key, value := range want {
+		if writes[0].Body[key] != value {
+			t.Errorf("%s = %q, want %q", key, writes[0].Body[key], value)
+		}
+	}
+}
+
+func TestGitLabUpsertComment(t *testing.T) {
+	const list = "/projects/group%2Fsub%2Fshop/merge_requests/7/notes?per_page=100"
+
+	tests := []struct {
+		name      string
+		pages     [][]providerComment
+		wantWrite recordedRequest
+	}{
+		{
+			name:      "creates the note when there is none",
+			pages:     [][]providerComment{commentPage(1, 2)},
+			wantWrite: recordedRequest{Method: http.MethodPost, Path: "/projects/group%2Fsub%2Fshop/merge_requests/7/notes"},
+		},
+		{
+			name: "follows Link headers to update the note on a later page",
+			pages: [][]providerComment{
+				commentPage(1, 100),
+				{{ID: 150, Body: "intro " + previewCommentMarker}},
+			},
+			wantWrite: recordedRequest{Method: http.MethodPut, Path: "/projects/group%2Fsub%2Fshop/merge_requests/7/notes/150"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := newFakeGitAPI(t)
+			api.addPages(list, tt.pages...)
+
+			provider := NewGitLabProvider(api.URL, "gl-token")
+			if err := provider.UpsertComment(context.Background(), "group/sub/shop", 7, previewCommentMarker, "new body"); err != nil {
+				t.Fatalf("UpsertComment: %v", err)
+			}
+
+			writes := api.writes()
+			if len(writes) != 1 {
+				t.Fatalf("expected one write, got %+v", writes)
+			}
+			if writes[0].Method != tt.wantWrite.Method || writes[0].Path != tt.wantWrite.Path {
+				t.Errorf("write = %s %s, want %s %s", writes[0].Method, writes[0].Path, tt.wantWrite.Method, tt.wantWrite.Path)
+			}
+			if writes[0].Body["body"] != "new body" {
+				t.Errorf("body = %q, want %q", writes[0].Body["body"], "new body")
+			}
+			if writes[0].Auth != "gl-token" {
+				t.Errorf("auth = %q, want the private token", writes[0].Auth)
+			}
+			if api.gets() != len(tt.pages) {
+				t.Errorf("listed %d pages, want %d", api.gets(), len(tt.pages))
+			}
+		})
+	}
+}
+
+func TestGitLabSetCommitStatus(t *testing.T) {
+	tests := []struct {
+		state     string
+		wantState string
+	}{
+		{state: CommitStatePending, wantState: "pending"},
+		{state: CommitStateSuccess, wantState: "success"},
+		{state: CommitStateFailure, wantState: "failed"},
+	}
+
+	for _, tt := range tests {
+		api := newFakeGitAPI(t)
+
+		provider := NewGitLabProvider(api.URL, "gl-token")
+		if err := provider.SetCommitStatus(context.Background(), "group/sub/shop", "abc123", CommitStatus{
+			State:       tt.state,
+			Description: "Preview",
+			Context:     previewStatusContext,
+		}); err != nil {
+			t.Fatalf("SetCommitStatus: %v", err)
+		}
+
+		writes := api.writes()
+		if len(writes) != 1 || writes[0].Method != http.MethodPost || writes[0].Path != "/projects/group%2Fsub%2Fshop/statuses/abc123" {
+			t.Fatalf("unexpected requests %+v", writes)
+		}
+		if writes[0].Body["state"] != tt.wantState {
+			t.Errorf("state = %q, want %q", writes[0].Body["state"], tt.wantState)
+		}
+		if writes[0].Body["name"] != previewStatusContext {
+			t.Errorf("name = %q, want %q", writes[0].Body["name"], previewStatusContext)
+		}
+	}
+}
+
+func TestNextPage(t *testing.T) {
+	api := &apiClient{baseURL: "https://api.github.com/"}
+
+	tests := []struct {
+		link string
+		want string
+	}{
+		{link: "", want: ""},
+		{
+			link: `<https://api.github.com/repos/a/b/issues/1/comments?page=2>; rel="next", <https://api.github.com/repos/a/b/issues/1/comments?page=5>; rel="last"`,
+			want: "https://api.github.com/repos/a/b/issues/1/comments?page=2",
+		},
+		{
+			link: `<https://api.github.com/repos/a/b/issues/1/comments?page=1>; rel="prev", <https://api.github.com/repos/a/b/issues/1/comments?page=1>; rel="first"`,
+			want: "",
+		},
+		{link: `<https://evil.example.com/steal?page=2>; rel="next"`, want: ""},
+		{link: `<https://api.github.com.evil.example.com/x>; rel="next"`, want: ""},
+	}
+
+	for _, tt := range tests {
+		if got := api.nextPage(tt.link); got != tt.want {
+			t.Errorf("nextPage(%q) = %q, want %q", tt.link, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// maxLogTailBytes bounds how much job output is copied into status messages
+const maxLogTailBytes = 4096
+
+// jobFinished reports whether a Job has reached a terminal condition and whether it succeeded
+func jobFinished(job *batchv1.Job) (finished bool, succeeded bool) {
+	for _, condition := range job.Status.Conditions {
+		if condition.Status != corev1.ConditionTrue {
+			continue
+		}
+		switch condition.Type {
+		case batchv1.JobComplete:
+			return true, true
+		case batchv1.JobFailed:
+			return true, false
+		}
+	}
+	return false, false
+}
+
+// waitForJobCompletion polls a Job until it finishes or the timeout elapses
+func waitForJobCompletion(ctx context.Context, c client.Client, job *batchv1.Job, timeout time.Duration) (bool, error) {
+	deadline := time.After(timeout)
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return false, ctx.Err()
+		case <-deadline:
+			return false, fmt.Errorf("job %s timed out after %s", job.Name, timeout)
+		case <-ticker.C:
+			current := &batchv1.Job{}
+			if err := c.Get(ctx, types.NamespacedName{
+				Name:      job.Name,
+				Namespace: job.Namespace,
+			}, current); err != nil {
+				return false, fmt.Errorf("failed to get job status: %w", err)
+			}
+
+			if finished, succeeded := jobFinished(current); finished {
+				return succeeded, nil
+			}
+		}
+	}
+}
+
+// jobLogs returns the tail of a container's logs from the most recent pod of a Job
+func jobLogs(ctx context.Context, c client.Client, kubeClient kubernetes.Interface, job *batchv1.Job, container string) (string, error) {
+	limit := int64(maxLogTailBytes)
+	logs, err := jobLogsWithOptions(ctx, c, kubeClient, job, &corev1.PodLogOptions{
+		Container:  container,
+		LimitBytes: &limit,
+		TailLines:  &[]int64{100}[0],
+	})
+	if err != nil {
+		return "", err
+	}
+	return truncateLog(logs, maxLogTailBytes), nil
+}
+
+// jobLogsWithOptions returns a container's logs from the most recent pod of a Job
+func jobLogsWithOptions(ctx context.Context, c client.Client, kubeClient kubernetes.Interface, job *batchv1.Job, opts *corev1.PodLogOptions) (string, error) {
+	if kubeClient == nil {
+		return "", fmt.Errorf("no kubernetes clientset configured for log retrieval")
+	}
+
+	pods := &corev1.PodList{}
+	if err := c.List(ctx, pods,
+		client.InNamespace(job.Namespace),
+		client.MatchingLabels{
+			"job-name": job.Name,
+		}); err != nil {
+		return "", fmt.Errorf("failed to list job pods: %w", err)
+	}
+
+	if len(pods.Items) == 0 {
+		return "", nil
+	}
+
+	// Use the most recently created pod, which reflects the last attempt
+	sort.Slice(pods.Items, func(i, j int) bool {
+		return pods.Items[i].CreationTimestamp.After(pods.Items[j].CreationTimestamp.Time)
+	})
+
+	stream, err := kubeClient.CoreV1().Pods(job.Namespace).GetLogs(pods.Items[0].Name, opts).Stream(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to stream logs: %w", err)
+	}
+	defer stream.Close()
+
+	data, err := io.ReadAll(stream)
+	if err != nil {
+		return "", fmt.Errorf("failed to read logs: %w", err)
+	}
+
+	return string(data), nil
+}
+
+// createOrRerunJob creates a job that is waited on synchronously. A running
+// or succeeded job of the same name is returned as is, while a failed one is
+// replaced, so that retrying runs the job again instead of reporting the
+// earlier failure until the job's TTL expires.
+func createOrRerunJob(ctx context.Context, c client.Client, job *batchv1.Job) (*batchv1.Job, error) {
+	key := types.NamespacedName{Name: job.Name, Namespace: job.Namespace}
+
+	existing := &batchv1.Job{}
+	err := c.Get(ctx, key, existing)
+	if err != nil && !errors.IsNotFound(err) {
+		return nil, fmt.Errorf("failed to check existing job %s: %w", job.Name, err)
+	}
+	if err == nil {
+		if finished, succeeded := jobFinished(existing); !finished || succeeded {
+			return existing, nil
+		}
+
+		if err := c.Delete(ctx, existing, client.PropagationPolicy(metav1.DeletePropagationBackground)); err != nil && !errors.IsNotFound(err) {
+			return nil, fmt.Errorf("failed to delete failed job %s: %w", job.Name, err)
+		}
+		if err := waitForJobDeletion(ctx, c, key, time.Minute); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := c.Create(ctx, job); err != nil {
+		return nil, fmt.Errorf("failed to create job %s: %w", job.Name, err)
+	}
+	return job, nil
+}
+
+// waitForJobDeletion polls until a deleted Job is gone
+func waitForJobDeletion(ctx context.Context, c client.Client, key types.NamespacedName, timeout time.Duration) error {
+	deadline := time.After(timeout)
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		err := c.Get(ctx, key, &batchv1.Job{})
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to check deleted job %s: %w", key.Name, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-deadline:
+			return fmt.Errorf("timed out waiting for job %s to be deleted", key.Name)
+		case <-ticker.C:
+		}
+	}
+}
+
+// truncateLog keeps the last max bytes of a log, which usually hold the failure
+func truncateLog(log string, max int) string {
+	log = strings.TrimSpace(log)
+	if len(log) <= max {
+		return log
+	}
+	return "..." + log[len(log)-max:]
+}
+
+// shortHash returns a stable, name-safe hash of the given parts
+func shortHash(parts ...string) string {
+	h := sha256.New()
+	for _, part := range parts {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))[:10]
+}
@@ -0,0 +1,62 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestCreateOrRerunJob(t *testing.T) {
+	ctx := context.Background()
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	newJob := func(name string, conditions ...batchv1.JobCondition) *batchv1.Job {
+		job := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "shop"}}
+		job.Status.Conditions = conditions
+		return job
+	}
+	failed := batchv1.JobCondition{Type: batchv1.JobFailed, Status: corev1.ConditionTrue}
+	complete := batchv1.JobCondition{Type: batchv1.JobComplete, Status: corev1.ConditionTrue}
+
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		newJob("failed", failed),
+		newJob("succeeded", complete),
+		newJob("running"),
+	).Build()
+
+	// Only the failed job is replaced by a fresh run
+	tests := []struct {
+		name          string
+		wantFinished  bool
+		wantSucceeded bool
+	}{
+		{name: "missing"},
+		{name: "failed"},
+		{name: "succeeded", wantFinished: true, wantSucceeded: true},
+		{name: "running"},
+	}
+	for _, tt := range tests {
+		if _, err := createOrRerunJob(ctx, c, newJob(tt.name)); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+
+		stored := &batchv1.Job{}
+		if err := c.Get(ctx, types.NamespacedName{Name: tt.name, Namespace: "shop"}, stored); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		finished, succeeded := jobFinished(stored)
+		if finished != tt.wantFinished || succeeded != tt.wantSucceeded {
+			t.Errorf("%s: finished, succeeded = %v, %v, want %v, %v", tt.name, finished, succeeded, tt.wantFinished, tt.wantSucceeded)
+		}
+	}
+}
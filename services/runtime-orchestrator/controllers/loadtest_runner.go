@@ -0,0 +1,268 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	cloudxv1 "github.com/cygni/runtime-orchestrator/api/v1"
+)
+
+// k6SummaryMarker separates k6's run output from the exported summary in the job logs
+const k6SummaryMarker = "---CYGNI-K6-SUMMARY---"
+
+// LoadTestRunner runs k6 load tests against a canary backend before promotion
+type LoadTestRunner struct {
+	client     client.Client
+	kubeClient kubernetes.Interface
+	log        logr.Logger
+}
+
+// k6Summary is the subset of k6's --summary-export output used for gating
+type k6Summary struct {
+	Metrics map[string]map[string]interface{} `json:"metrics"`
+}
+
+// value returns a numeric field of a metric, or zero if it is absent
+func (s *k6Summary) value(metric, field string) float64 {
+	if v, ok := s.Metrics[metric][field].(float64); ok {
+		return v
+	}
+	return 0
+}
+
+// Run executes the load test, waits for it and evaluates the configured thresholds
+func (l *LoadTestRunner) Run(ctx context.Context, cxs *cloudxv1.CloudExpressService, spec *cloudxv1.LoadTestSpec, targetService string) (*cloudxv1.LoadTestResult, error) {
+	if spec.ScriptConfigMap == "" {
+		return nil, fmt.Errorf("load test requires a script ConfigMap")
+	}
+
+	script := &corev1.ConfigMap{}
+	if err := l.client.Get(ctx, types.NamespacedName{
+		Name:      spec.ScriptConfigMap,
+		Namespace: cxs.Namespace,
+	}, script); err != nil {
+		return nil, fmt.Errorf("failed to get load test script ConfigMap %s: %w", spec.ScriptConfigMap, err)
+	}
+
+	job := l.constructLoadTestJob(cxs, spec, targetService, configMapDataHash(script))
+
+	existing := &batchv1.Job{}
+	err := l.client.Get(ctx, types.NamespacedName{
+		Name:      job.Name,
+		Namespace: job.Namespace,
+	}, existing)
+
+	if err != nil && !errors.IsNotFound(err) {
+		return nil, fmt.Errorf("failed to check existing load test job: %w", err)
+	}
+
+	if errors.IsNotFound(err) {
+		if err := l.client.Create(ctx, job); err != nil {
+			return nil, fmt.Errorf("failed to create load test job: %w", err)
+		}
+		l.log.Info("Created load test job", "job", job.Name, "target", targetService)
+	} else {
+		job = existing
+	}
+
+	// The job enforces the timeout itself; allow it time to report failure
+	jobSucceeded, err := waitForJobCompletion(ctx, l.client, job, loadTestTimeout(spec)+time.Minute)
+	if err != nil {
+		return nil, err
+	}
+
+	// The summary can be large, so read the full log rather than the usual tail
+	limit := int64(1 << 20)
+	logs, err := jobLogsWithOptions(ctx, l.client, l.kubeClient, job, &corev1.PodLogOptions{
+		Container:  "k6",
+		LimitBytes: &limit,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read load test output: %w", err)
+	}
+
+	result := evaluateK6Summary(logs, spec)
+	result.Image = cxs.Spec.Image
+	result.JobName = job.Name
+	result.CompletedAt = metav1.Now()
+
+	// k6 exits non-zero when thresholds declared in the script are crossed
+	if !jobSucceeded && result.Passed {
+		result.Passed = false
+		result.Message = "load test job failed; script thresholds were not met"
+	}
+
+	return result, nil
+}
+
+// loadTestTimeout returns the maximum duration of a load test job
+func loadTestTimeout(spec *cloudxv1.LoadTestSpec) time.Duration {
+	if timeout, err := time.ParseDuration(spec.Timeout); err == nil && timeout > 0 {
+		return timeout
+	}
+	return 15 * time.Minute
+}
+
+// configMapDataHash fingerprints the contents of a ConfigMap
+func configMapDataHash(configMap *corev1.ConfigMap) string {
+	parts := []string{}
+	for _, key := range sortedKeys(configMap.Data) {
+		parts = append(parts, key, configMap.Data[key])
+	}
+	binary := map[string]string{}
+	for key, value := range configMap.BinaryData {
+		binary[key] = string(value)
+	}
+	for _, key := range sortedKeys(binary) {
+		parts = append(parts, key, binary[key])
+	}
+	return shortHash(parts...)
+}
+
+func (l *LoadTestRunner) constructLoadTestJob(cxs *cloudxv1.CloudExpressService, spec *cloudxv1.LoadTestSpec, targetService, scriptHash string) *batchv1.Job {
+	// Key the job on everything that affects the run, so a changed script or
+	// load profile runs again instead of reusing an earlier result
+	specJSON, _ := json.Marshal(spec)
+	jobName := fmt.Sprintf("%s-loadtest-%s", cxs.Name, shortHash(cxs.Spec.Image, targetService, string(specJSON), scriptHash))
+
+	image := spec.Image
+	if image == "" {
+		image = "grafana/k6:0.49.0"
+	}
+
+	scriptKey := spec.ScriptKey
+	if scriptKey == "" {
+		scriptKey = "script.js"
+	}
+
+	port := int32(80)
+	if len(cxs.Spec.Ports) > 0 {
+		port = cxs.Spec.Ports[0]
+	}
+
+	args := []string{"k6", "run", "--quiet", "--summary-export=/tmp/summary.json"}
+	if spec.VUs > 0 {
+		args = append(args, fmt.Sprintf("--vus=%d", spec.VUs))
+	}
+	if spec.Duration != "" {
+		args = append(args, "--duration="+shellQuote(spec.Duration))
+	}
+	args = append(args, shellQuote("/scripts/"+scriptKey))
+
+	script := fmt.Sprintf("%s; rc=$?; echo %s; cat /tmp/summary.json; exit $rc",
+		strings.Join(args, " "), k6SummaryMarker)
+
+	return &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      jobName,
+			Namespace: cxs.Namespace,
+			Labels: map[string]string{
+				"cygni.io/service": cxs.Name,
+				"cygni.io/type":    "load-test",
+			},
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit:            &[]int32{0}[0],
+			ActiveDeadlineSeconds:   &[]int64{int64(loadTestTimeout(spec).Seconds())}[0],
+			TTLSecondsAfterFinished: &[]int32{86400}[0], // Keep results for a day
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: map[string]string{
+						"cygni.io/service": cxs.Name,
+						"cygni.io/type":    "load-test",
+					},
+				},
+				Spec: corev1.PodSpec{
+					RestartPolicy: corev1.RestartPolicyNever,
+					Containers: []corev1.Container{
+						{
+							Name:    "k6",
+							Image:   image,
+							Command: []string{"sh", "-c", script},
+							Env: []corev1.EnvVar{
+								{
+									Name:  "TARGET_URL",
+									Value: fmt.Sprintf("http://%s.%s.svc.cluster.local:%d", targetService, cxs.Namespace, port),
+								},
+							},
+							VolumeMounts: []corev1.VolumeMount{
+								{
+									Name:      "scripts",
+									MountPath: "/scripts",
+								},
+							},
+						},
+					},
+					Volumes: []corev1.Volume{
+						{
+							Name: "scripts",
+							VolumeSource: corev1.VolumeSource{
+								ConfigMap: &corev1.ConfigMapVolumeSource{
+									LocalObjectReference: corev1.LocalObjectReference{
+										Name: spec.ScriptConfigMap,
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// evaluateK6Summary parses the exported k6 summary from the job logs and checks thresholds
+func evaluateK6Summary(logs string, spec *cloudxv1.LoadTestSpec) *cloudxv1.LoadTestResult {
+	idx := strings.LastIndex(logs, k6SummaryMarker)
+	if idx < 0 {
+		return &cloudxv1.LoadTestResult{
+			Passed:  false,
+			Message: "load test summary not found in job output",
+		}
+	}
+
+	summary := &k6Summary{}
+	if err := json.Unmarshal([]byte(logs[idx+len(k6SummaryMarker):]), summary); err != nil {
+		return &cloudxv1.LoadTestResult{
+			Passed:  false,
+			Message: fmt.Sprintf("failed to parse load test summary: %v", err),
+		}
+	}
+
+	result := &cloudxv1.LoadTestResult{
+		P95Latency: summary.value("http_req_duration", "p(95)"),
+		ErrorRate:  summary.value("http_req_failed", "value") * 100,
+		Requests:   int64(summary.value("http_reqs", "count")),
+		Passed:     true,
+	}
+
+	if spec.MaxP95Latency > 0 && result.P95Latency > float64(spec.MaxP95Latency) {
+		result.Passed = false
+		result.Message = fmt.Sprintf("P95 latency %.0fms exceeds threshold %dms under load",
+			result.P95Latency, spec.MaxP95Latency)
+		return result
+	}
+
+	if spec.MaxErrorRate > 0 && result.ErrorRate > spec.MaxErrorRate {
+		result.Passed = false
+		result.Message = fmt.Sprintf("error rate %.2f%% exceeds threshold %.2f%% under load",
+			result.ErrorRate, spec.MaxErrorRate)
+		return result
+	}
+
+	result.Message = fmt.Sprintf("load test passed (requests: %d, error: %.2f%%, p95: %.0fms)",
+		result.Requests, result.ErrorRate, result.P95Latency)
+	return result
+}
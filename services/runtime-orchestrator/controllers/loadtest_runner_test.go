@@ -0,0 +1,55 @@
+package controllers
+
+import (
+	"testing"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+
+	cloudxv1 "github.com/cygni/runtime-orchestrator/api/v1"
+)
+
+func TestLoadTestJobKeyedOnRun(t *testing.T) {
+	runner := &LoadTestRunner{log: logr.Discard()}
+	cxs := baseService("api", 8080)
+	base := cloudxv1.LoadTestSpec{ScriptConfigMap: "api-load", VUs: 10, Duration: "1m", Timeout: "5m"}
+	script := &corev1.ConfigMap{Data: map[string]string{"script.js": "export default function () {}"}}
+
+	job := runner.constructLoadTestJob(cxs, &base, "api-canary", configMapDataHash(script))
+	if job.Spec.ActiveDeadlineSeconds == nil || *job.Spec.ActiveDeadlineSeconds != 300 {
+		t.Errorf("active deadline = %v, want 300 seconds", job.Spec.ActiveDeadlineSeconds)
+	}
+
+	changedScript := &corev1.ConfigMap{Data: map[string]string{"script.js": "export default function () { sleep(1) }"}}
+	tests := []struct {
+		name   string
+		change func(spec *cloudxv1.LoadTestSpec)
+		script *corev1.ConfigMap
+	}{
+		{name: "script contents", change: func(spec *cloudxv1.LoadTestSpec) {}, script: changedScript},
+		{name: "vus", change: func(spec *cloudxv1.LoadTestSpec) { spec.VUs = 50 }},
+		{name: "duration", change: func(spec *cloudxv1.LoadTestSpec) { spec.Duration = "5m" }},
+		{name: "script key", change: func(spec *cloudxv1.LoadTestSpec) { spec.ScriptKey = "spike.js" }},
+		{name: "latency threshold", change: func(spec *cloudxv1.LoadTestSpec) { spec.MaxP95Latency = 200 }},
+		{name: "error threshold", change: func(spec *cloudxv1.LoadTestSpec) { spec.MaxErrorRate = 1 }},
+	}
+	for _, tt := range tests {
+		spec := base
+		tt.change(&spec)
+		data := script
+		if tt.script != nil {
+			data = tt.script
+		}
+
+		changed := runner.constructLoadTestJob(cxs, &spec, "api-canary", configMapDataHash(data))
+		if changed.Name == job.Name {
+			t.Errorf("changing the %s reuses job %s", tt.name, job.Name)
+		}
+	}
+
+	// The same run maps onto the same job
+	again := runner.constructLoadTestJob(cxs, &base, "api-canary", configMapDataHash(script))
+	if again.Name != job.Name {
+		t.Errorf("job name changed from %s to %s for the same run", job.Name, again.Name)
+	}
+}
@@ -4,81 +4,342 @@ import (
 	"context"
 	"fmt"
 	"path/filepath"
+	"sort"
+	"strings"
 	"time"
 
+	"github.com/go-logr/logr"
 	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
 	cloudxv1 "github.com/cygni/runtime-orchestrator/api/v1"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 )
 
 // MigrationRunner handles database migrations before deployments
 type MigrationRunner struct {
-	client client.Client
-	log    logr.Logger
+	client     client.Client
+	kubeClient kubernetes.Interface
+	scheme     *runtime.Scheme
+	log        logr.Logger
 }
 
 type MigrationConfig struct {
-	Tool        string // flyway, migrate, sql-migrate, etc.
-	Directory   string // migrations directory path
-	DatabaseURL string // connection string
+	Mode           string                       // tool or app
+	Command        []string                     // command run in the service image for app mode
+	Args           []string                     // args for the app mode command
+	PlanCommand    []string                     // command reporting pending migrations for app mode
+	Tool           string                       // flyway, migrate, sql-migrate, etc.
+	Directory      string                       // migrations directory path
+	DatabaseURL    string                       // connection string
+	SecretName     string                       // Secret holding the connection string
+	SecretKey      string                       // key of the connection string within the Secret
+	Endpoint       *DatabaseEndpoint            // parsed connection string
+	ConfigMap      string                       // ConfigMap holding the migration files
+	OCI            *cloudxv1.OCIMigrationSource // OCI artifact holding the migration files
+	Git            *cloudxv1.GitMigrationSource // git repository holding the migration files
+	SourceChecksum string                       // expected sha256 of the fetched migration files
+	Timeout        time.Duration                // maximum duration of a migration run
+	BackoffLimit   int32                        // retries before the job is marked failed
+	BlockRollout   bool                         // whether a failure blocks the rollout
 }
 
-// RunMigrations executes database migrations before deployment
-func (m *MigrationRunner) RunMigrations(ctx context.Context, cxs *cloudxv1.CloudExpressService) error {
+// supportedMigrationTools lists the tools a MigrationSpec may declare
+var supportedMigrationTools = map[string]bool{
+	"flyway":      true,
+	"migrate":     true,
+	"sql-migrate": true,
+	"goose":       true,
+}
+
+const (
+	// migrationModeTool runs a migration tool image against a migration source
+	migrationModeTool = "tool"
+
+	// migrationModeApp runs the service's own image with a custom command
+	migrationModeApp = "app"
+)
+
+// validateMigrationSpec checks a declared migrations block before any job is created
+func validateMigrationSpec(spec *cloudxv1.MigrationSpec) error {
+	switch spec.Mode {
+	case "", migrationModeTool:
+		if !supportedMigrationTools[spec.Tool] {
+			return fmt.Errorf("unsupported migration tool %q", spec.Tool)
+		}
+	case migrationModeApp:
+		if len(spec.Command) == 0 {
+			return fmt.Errorf("command is required for app mode migrations")
+		}
+		if spec.DryRun && len(spec.PlanCommand) == 0 {
+			return fmt.Errorf("planCommand is required for app mode dry runs")
+		}
+	default:
+		return fmt.Errorf("unsupported migration mode %q", spec.Mode)
+	}
+
+	if spec.DatabaseSecretRef.Name == "" {
+		return fmt.Errorf("databaseSecretRef.name is required")
+	}
+
+	if spec.Timeout != "" {
+		timeout, err := time.ParseDuration(spec.Timeout)
+		if err != nil || timeout <= 0 {
+			return fmt.Errorf("invalid timeout %q", spec.Timeout)
+		}
+	}
+
+	switch spec.Safety {
+	case "", MigrationSafetyReversible, MigrationSafetyExpandOnly, MigrationSafetyDestructive:
+	default:
+		return fmt.Errorf("unsupported migration safety %q", spec.Safety)
+	}
+
+	// Automatic down-migrations need an explicit classification and a version to return to
+	if spec.RollbackOnFailure {
+		if spec.Safety == "" {
+			return fmt.Errorf("safety must be set to reversible, expand-only or destructive when rollbackOnFailure is enabled")
+		}
+		if spec.SchemaVersion == "" {
+			return fmt.Errorf("schemaVersion is required when rollbackOnFailure is enabled")
+		}
+		if spec.Mode == migrationModeApp && spec.Safety == MigrationSafetyReversible && len(spec.DownCommand) == 0 {
+			return fmt.Errorf("downCommand is required for reversible app mode migrations")
+		}
+	}
+
+	if spec.BackoffLimit != nil && *spec.BackoffLimit < 0 {
+		return fmt.Errorf("backoffLimit must not be negative")
+	}
+
+	if filepath.IsAbs(spec.Source.Directory) || strings.Contains(spec.Source.Directory, "..") {
+		return fmt.Errorf("source.directory must be a relative path within the source")
+	}
+
+	if err := validateMigrationSource(&spec.Source); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// migrationBlocksRollout reports whether a migration failure should stop the deployment
+func migrationBlocksRollout(cxs *cloudxv1.CloudExpressService) bool {
+	if cxs.Spec.Migrations == nil || cxs.Spec.Migrations.BlockRollout == nil {
+		return true
+	}
+	return *cxs.Spec.Migrations.BlockRollout
+}
+
+// Migration phases recorded in CloudExpressServiceStatus.Migration
+const (
+	MigrationPhasePending   = "Pending"
+	MigrationPhaseRunning   = "Running"
+	MigrationPhaseSucceeded = "Succeeded"
+	MigrationPhaseFailed    = "Failed"
+	MigrationPhasePlanned   = "Planned"
+)
+
+// RunMigrations advances the migration job for the service's current image and
+// migration set without blocking. It returns true once migrations have completed;
+// callers should requeue while it returns false. Progress is recorded in
+// cxs.Status.Migration, which the caller persists. In dry-run mode only a plan
+// job runs and RunMigrations never reports completion.
+func (m *MigrationRunner) RunMigrations(ctx context.Context, cxs *cloudxv1.CloudExpressService) (bool, error) {
 	// Check if migrations are needed
 	migrationConfig, err := m.detectMigrationConfig(ctx, cxs)
 	if err != nil {
-		return fmt.Errorf("failed to detect migration config: %w", err)
+		return false, fmt.Errorf("failed to detect migration config: %w", err)
 	}
 
 	if migrationConfig == nil {
-		m.log.Info("No migrations detected", "service", cxs.Name)
-		return nil
+		return true, nil
+	}
+
+	checksum, err := m.migrationChecksum(ctx, cxs, migrationConfig)
+	if err != nil {
+		return false, err
+	}
+
+	dryRun := cxs.Spec.Migrations != nil && cxs.Spec.Migrations.DryRun
+	kind := "migrate"
+	if dryRun {
+		kind = "plan"
+	}
+
+	// Key the job on the image and migration set so each combination runs once
+	jobName := fmt.Sprintf("%s-%s-%s", cxs.Name, kind, shortHash(cxs.Spec.Image, checksum))
+
+	status := cxs.Status.Migration
+	if status == nil || status.JobName != jobName {
+		previous := status
+		status = &cloudxv1.MigrationStatus{
+			Phase:         MigrationPhasePending,
+			JobName:       jobName,
+			Image:         cxs.Spec.Image,
+			Checksum:      checksum,
+			SourceVersion: migrationSourceVersion(migrationConfig, checksum),
+		}
+		// Keep the plan visible while the same migration set is applied
+		if previous != nil && previous.Image == status.Image && previous.Checksum == checksum {
+			status.Plan = previous.Plan
+		}
+		cxs.Status.Migration = status
 	}
 
-	// Create migration job
-	job := m.constructMigrationJob(cxs, migrationConfig)
-	
-	// Check if job already exists
 	existingJob := &batchv1.Job{}
 	err = m.client.Get(ctx, types.NamespacedName{
-		Name:      job.Name,
-		Namespace: job.Namespace,
+		Name:      jobName,
+		Namespace: cxs.Namespace,
 	}, existingJob)
 
 	if err != nil && !errors.IsNotFound(err) {
-		return fmt.Errorf("failed to check existing job: %w", err)
+		return false, fmt.Errorf("failed to check existing job: %w", err)
 	}
 
-	if err == nil {
-		// Job already exists, check status
-		if existingJob.Status.Succeeded > 0 {
-			m.log.Info("Migrations already completed", "job", job.Name)
-			return nil
+	if errors.IsNotFound(err) {
+		// Finished jobs are garbage collected after their TTL; the recorded
+		// phase is the source of truth once that happens
+		if status.Phase == MigrationPhaseSucceeded {
+			return true, nil
+		}
+		if status.Phase == MigrationPhasePlanned {
+			return false, nil
+		}
+
+		if err := m.ensureCredentialsSecret(ctx, cxs, migrationConfig); err != nil {
+			return false, fmt.Errorf("failed to prepare migration credentials: %w", err)
+		}
+
+		job := m.constructMigrationJob(cxs, migrationConfig, jobName)
+		if dryRun {
+			job.Spec.Template.Spec.Containers[0].Command = m.getPlanCommand(migrationConfig)
+			job.Spec.Template.Spec.Containers[0].Args = nil
 		}
-		if existingJob.Status.Failed > 0 {
-			return fmt.Errorf("migration job failed")
+		job.Annotations = map[string]string{
+			"cygni.io/image":              cxs.Spec.Image,
+			"cygni.io/migration-checksum": checksum,
+			"cygni.io/migration-version":  status.SourceVersion,
 		}
-		// Job is still running
-		return m.waitForJob(ctx, existingJob)
+		// Owning the job lets its completion trigger the next reconcile
+		if m.scheme != nil {
+			if err := controllerutil.SetControllerReference(cxs, job, m.scheme); err != nil {
+				return false, fmt.Errorf("failed to set controller reference: %w", err)
+			}
+		}
+		if err := m.client.Create(ctx, job); err != nil {
+			return false, fmt.Errorf("failed to create migration job: %w", err)
+		}
+
+		status.Phase = MigrationPhaseRunning
+		status.Attempts++
+		status.StartedAt = metav1.Now()
+		status.CompletedAt = metav1.Time{}
+		status.Message = ""
+		m.log.Info("Created migration job", "job", jobName, "attempt", status.Attempts)
+		return false, nil
 	}
 
-	// Create new migration job
-	if err := m.client.Create(ctx, job); err != nil {
-		return fmt.Errorf("failed to create migration job: %w", err)
+	finished, succeeded := jobFinished(existingJob)
+	if !finished {
+		status.Phase = MigrationPhaseRunning
+		return false, nil
 	}
 
-	m.log.Info("Created migration job", "job", job.Name)
-	
-	// Wait for job completion
-	return m.waitForJob(ctx, job)
+	if succeeded && dryRun {
+		if status.Phase != MigrationPhasePlanned {
+			plan, err := jobLogs(ctx, m.client, m.kubeClient, existingJob, "migrate")
+			if err != nil {
+				m.log.Error(err, "Failed to capture migration plan", "job", jobName)
+			}
+			status.Phase = MigrationPhasePlanned
+			status.CompletedAt = metav1.Now()
+			status.Plan = plan
+			status.Message = "dry run complete; set migrations.dryRun to false to apply"
+		}
+		return false, nil
+	}
+
+	if succeeded {
+		if status.Phase != MigrationPhaseSucceeded {
+			m.log.Info("Migration completed successfully", "job", jobName)
+			status.Phase = MigrationPhaseSucceeded
+			status.CompletedAt = metav1.Now()
+			status.Message = ""
+			recordSchemaRevision(cxs)
+		}
+		return true, nil
+	}
+
+	if status.Phase != MigrationPhaseFailed {
+		m.logFailedPods(ctx, existingJob)
+		logs, err := jobLogs(ctx, m.client, m.kubeClient, existingJob, "migrate")
+		if err != nil {
+			m.log.Error(err, "Failed to capture migration logs", "job", jobName)
+		}
+		status.Phase = MigrationPhaseFailed
+		status.CompletedAt = metav1.Now()
+		status.Message = fmt.Sprintf("migration job %s failed", jobName)
+		status.Logs = logs
+	}
+
+	return false, fmt.Errorf("migration job %s failed", jobName)
+}
+
+// migrationChecksum identifies the migration set, so that changing either the
+// image or the migration files produces a new migration job
+func (m *MigrationRunner) migrationChecksum(ctx context.Context, cxs *cloudxv1.CloudExpressService, config *MigrationConfig) (string, error) {
+	if config.Mode == migrationModeApp {
+		// Migrations ship inside the image, so the command identifies the set
+		parts := append([]string{config.Mode}, config.Command...)
+		return shortHash(append(parts, config.Args...)...), nil
+	}
+
+	// Remote sources are identified by their reference and expected checksum,
+	// one of which validation requires to be immutable
+	if config.OCI != nil {
+		return shortHash(config.Tool, config.Directory, "oci", config.OCI.Ref, config.SourceChecksum), nil
+	}
+	if config.Git != nil {
+		return shortHash(config.Tool, config.Directory, "git", config.Git.Repository, config.Git.Ref, config.SourceChecksum), nil
+	}
+
+	configMap := &corev1.ConfigMap{}
+	if err := m.client.Get(ctx, types.NamespacedName{
+		Name:      config.ConfigMap,
+		Namespace: cxs.Namespace,
+	}, configMap); err != nil {
+		return "", fmt.Errorf("failed to get migrations ConfigMap %s: %w", config.ConfigMap, err)
+	}
+
+	keys := make([]string, 0, len(configMap.Data)+len(configMap.BinaryData))
+	for key := range configMap.Data {
+		keys = append(keys, key)
+	}
+	for key := range configMap.BinaryData {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	parts := []string{config.Tool, config.Directory}
+	for _, key := range keys {
+		parts = append(parts, key, configMap.Data[key], string(configMap.BinaryData[key]))
+	}
+
+	return shortHash(parts...), nil
 }
 
 func (m *MigrationRunner) detectMigrationConfig(ctx context.Context, cxs *cloudxv1.CloudExpressService) (*MigrationConfig, error) {
+	// Migrations declared in the spec take precedence over naming conventions
+	if cxs.Spec.Migrations != nil {
+		return m.migrationConfigFromSpec(ctx, cxs)
+	}
+
 	// Check ConfigMap for migration configuration
 	configMap := &corev1.ConfigMap{}
 	err := m.client.Get(ctx, types.NamespacedName{
@@ -96,8 +357,13 @@ func (m *MigrationRunner) detectMigrationConfig(ctx context.Context, cxs *cloudx
 	// Look for migration tool configuration
 	if tool, ok := configMap.Data["migration.tool"]; ok {
 		config := &MigrationConfig{
-			Tool:      tool,
-			Directory: configMap.Data["migration.directory"],
+			Mode:         migrationModeTool,
+			Tool:         tool,
+			Directory:    configMap.Data["migration.directory"],
+			ConfigMap:    fmt.Sprintf("%s-migrations", cxs.Name),
+			Timeout:      5 * time.Minute,
+			BackoffLimit: 3,
+			BlockRollout: true,
 		}
 
 		// Get database URL from secret
@@ -111,34 +377,104 @@ func (m *MigrationRunner) detectMigrationConfig(ctx context.Context, cxs *cloudx
 			return nil, fmt.Errorf("failed to get database secret: %w", err)
 		}
 
+		config.SecretName = secret.Name
+		config.SecretKey = "DATABASE_URL"
 		config.DatabaseURL = string(secret.Data["DATABASE_URL"])
+		if config.Endpoint, err = parseDatabaseURL(config.DatabaseURL); err != nil {
+			return nil, fmt.Errorf("failed to parse database URL from secret %s: %w", secret.Name, err)
+		}
 		return config, nil
 	}
 
 	return nil, nil
 }
 
-func (m *MigrationRunner) constructMigrationJob(cxs *cloudxv1.CloudExpressService, config *MigrationConfig) *batchv1.Job {
-	jobName := fmt.Sprintf("%s-migrate-%s", cxs.Name, time.Now().Format("20060102-150405"))
-	
+// migrationConfigFromSpec builds the migration config from a declared migrations block
+func (m *MigrationRunner) migrationConfigFromSpec(ctx context.Context, cxs *cloudxv1.CloudExpressService) (*MigrationConfig, error) {
+	spec := cxs.Spec.Migrations
+	if err := validateMigrationSpec(spec); err != nil {
+		return nil, fmt.Errorf("invalid migrations spec: %w", err)
+	}
+
+	config := &MigrationConfig{
+		Mode:           spec.Mode,
+		Command:        spec.Command,
+		Args:           spec.Args,
+		PlanCommand:    spec.PlanCommand,
+		Tool:           spec.Tool,
+		Directory:      spec.Source.Directory,
+		ConfigMap:      spec.Source.ConfigMap,
+		OCI:            spec.Source.OCI,
+		Git:            spec.Source.Git,
+		SourceChecksum: spec.Source.Checksum,
+		Timeout:        5 * time.Minute,
+		BackoffLimit:   3,
+		BlockRollout:   migrationBlocksRollout(cxs),
+	}
+
+	if config.Mode == "" {
+		config.Mode = migrationModeTool
+	}
+	if config.ConfigMap == "" && config.OCI == nil && config.Git == nil {
+		config.ConfigMap = fmt.Sprintf("%s-migrations", cxs.Name)
+	}
+	if spec.Timeout != "" {
+		config.Timeout, _ = time.ParseDuration(spec.Timeout)
+	}
+	if spec.BackoffLimit != nil {
+		config.BackoffLimit = *spec.BackoffLimit
+	}
+
+	key := spec.DatabaseSecretRef.Key
+	if key == "" {
+		key = "DATABASE_URL"
+	}
+
+	secret := &corev1.Secret{}
+	if err := m.client.Get(ctx, types.NamespacedName{
+		Name:      spec.DatabaseSecretRef.Name,
+		Namespace: cxs.Namespace,
+	}, secret); err != nil {
+		return nil, fmt.Errorf("failed to get database secret: %w", err)
+	}
+
+	databaseURL, ok := secret.Data[key]
+	if !ok {
+		return nil, fmt.Errorf("database secret %s has no key %s", spec.DatabaseSecretRef.Name, key)
+	}
+	config.SecretName = spec.DatabaseSecretRef.Name
+	config.SecretKey = key
+	config.DatabaseURL = string(databaseURL)
+
+	endpoint, err := parseDatabaseURL(config.DatabaseURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse database URL from secret %s: %w", config.SecretName, err)
+	}
+	config.Endpoint = endpoint
+
+	return config, nil
+}
+
+func (m *MigrationRunner) constructMigrationJob(cxs *cloudxv1.CloudExpressService, config *MigrationConfig, jobName string) *batchv1.Job {
 	// Select migration image based on tool
 	migrationImage := m.getMigrationImage(config.Tool)
 	
 	// Build command based on tool
-	command := m.getMigrationCommand(config.Tool, config.Directory)
+	command := m.getMigrationCommand(config.Tool, migrationsPath(config))
 
 	job := &batchv1.Job{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      jobName,
 			Namespace: cxs.Namespace,
 			Labels: map[string]string{
-				"cygni.io/service":  cxs.Name,
-				"cygni.io/type":     "migration",
-				"cygni.io/image":    cxs.Spec.Image,
+				"cygni.io/service":    cxs.Name,
+				"cygni.io/type":       "migration",
+				"cygni.io/image-hash": shortHash(cxs.Spec.Image),
 			},
 		},
 		Spec: batchv1.JobSpec{
-			BackoffLimit: &[]int32{3}[0],
+			BackoffLimit:          &config.BackoffLimit,
+			ActiveDeadlineSeconds: &[]int64{int64(config.Timeout.Seconds())}[0],
 			TTLSecondsAfterFinished: &[]int32{3600}[0], // Clean up after 1 hour
 			Template: corev1.PodTemplateSpec{
 				ObjectMeta: metav1.ObjectMeta{
@@ -158,7 +494,7 @@ func (m *MigrationRunner) constructMigrationJob(cxs *cloudxv1.CloudExpressServic
 								"-c",
 								"until nc -z $DB_HOST $DB_PORT; do echo waiting for database...; sleep 2; done",
 							},
-							Env: m.getDatabaseEnvVars(config.DatabaseURL),
+							Env: m.getDatabaseEnvVars(config.Endpoint),
 						},
 					},
 					Containers: []corev1.Container{
@@ -166,13 +502,7 @@ func (m *MigrationRunner) constructMigrationJob(cxs *cloudxv1.CloudExpressServic
 							Name:    "migrate",
 							Image:   migrationImage,
 							Command: command,
-							Env: append(
-								m.getDatabaseEnvVars(config.DatabaseURL),
-								corev1.EnvVar{
-									Name:  "DATABASE_URL",
-									Value: config.DatabaseURL,
-								},
-							),
+							Env: m.getMigrationEnvVars(cxs, config),
 							VolumeMounts: []corev1.VolumeMount{
 								{
 									Name:      "migrations",
@@ -187,7 +517,7 @@ func (m *MigrationRunner) constructMigrationJob(cxs *cloudxv1.CloudExpressServic
 							VolumeSource: corev1.VolumeSource{
 								ConfigMap: &corev1.ConfigMapVolumeSource{
 									LocalObjectReference: corev1.LocalObjectReference{
-										Name: fmt.Sprintf("%s-migrations", cxs.Name),
+										Name: config.ConfigMap,
 									},
 								},
 							},
@@ -198,6 +528,23 @@ func (m *MigrationRunner) constructMigrationJob(cxs *cloudxv1.CloudExpressServic
 		},
 	}
 
+	if config.Mode != migrationModeApp && (config.OCI != nil || config.Git != nil) {
+		m.applyMigrationSource(job, config)
+	}
+
+	// App mode runs the service image with its own env and secrets, so the
+	// migrations always match the code being deployed
+	if config.Mode == migrationModeApp {
+		container := &job.Spec.Template.Spec.Containers[0]
+		container.Image = cxs.Spec.Image
+		container.Command = config.Command
+		container.Args = config.Args
+		container.Env = append(serviceEnvVars(cxs), container.Env...)
+		container.EnvFrom = serviceEnvFrom(cxs)
+		container.VolumeMounts = nil
+		job.Spec.Template.Spec.Volumes = nil
+	}
+
 	return job
 }
 
@@ -217,32 +564,40 @@ func (m *MigrationRunner) getMigrationImage(tool string) string {
 	return images["flyway"]
 }
 
+// migrationsPath returns where the migration files are found inside the job's
+// volume. ConfigMap volumes are flat, so only OCI and git sources have directories.
+func migrationsPath(config *MigrationConfig) string {
+	if config.OCI == nil && config.Git == nil {
+		return "/migrations"
+	}
+	return filepath.Join("/migrations", config.Directory)
+}
+
 func (m *MigrationRunner) getMigrationCommand(tool, directory string) []string {
 	switch tool {
 	case "flyway":
 		return []string{
 			"flyway",
-			"-url=${DATABASE_URL}",
-			"-locations=filesystem:/migrations",
+			"-locations=filesystem:" + directory,
 			"migrate",
 		}
 	case "migrate":
 		return []string{
 			"migrate",
-			"-path", "/migrations",
-			"-database", "${DATABASE_URL}",
+			"-path", directory,
+			"-database", "$(MIGRATE_DATABASE_URL)",
 			"up",
 		}
 	case "sql-migrate":
 		return []string{
 			"sql-migrate",
 			"up",
-			"-config=/migrations/dbconfig.yml",
+			"-config=" + filepath.Join(directory, "dbconfig.yml"),
 		}
 	case "goose":
 		return []string{
 			"goose",
-			"-dir", "/migrations",
+			"-dir", directory,
 			"up",
 		}
 	default:
@@ -250,110 +605,394 @@ func (m *MigrationRunner) getMigrationCommand(tool, directory string) []string {
 	}
 }
 
-func (m *MigrationRunner) getDatabaseEnvVars(databaseURL string) []corev1.EnvVar {
-	// Parse database URL to extract host and port
-	// This is a simplified version - in production, use proper URL parsing
+// getPlanCommand returns a command that reports pending migrations without applying them
+func (m *MigrationRunner) getPlanCommand(config *MigrationConfig) []string {
+	if config.Mode == migrationModeApp {
+		return config.PlanCommand
+	}
+
+	directory := migrationsPath(config)
+	switch config.Tool {
+	case "flyway":
+		return []string{
+			"flyway",
+			"-locations=filesystem:" + directory,
+			"info",
+		}
+	case "migrate":
+		return []string{
+			"migrate",
+			"-path", directory,
+			"-database", "$(MIGRATE_DATABASE_URL)",
+			"version",
+		}
+	case "sql-migrate":
+		return []string{
+			"sql-migrate",
+			"status",
+			"-config=" + filepath.Join(directory, "dbconfig.yml"),
+		}
+	case "goose":
+		return []string{
+			"goose",
+			"-dir", directory,
+			"status",
+		}
+	default:
+		return []string{"echo", "Unknown migration tool"}
+	}
+}
+
+// getDatabaseEnvVars returns the non-secret connection details used to wait for the database
+func (m *MigrationRunner) getDatabaseEnvVars(endpoint *DatabaseEndpoint) []corev1.EnvVar {
 	return []corev1.EnvVar{
 		{
 			Name:  "DB_HOST",
-			Value: "postgres", // This should be parsed from URL
+			Value: endpoint.Host,
 		},
 		{
 			Name:  "DB_PORT",
-			Value: "5432",
+			Value: endpoint.Port,
 		},
 	}
 }
 
-func (m *MigrationRunner) waitForJob(ctx context.Context, job *batchv1.Job) error {
-	timeout := time.After(5 * time.Minute)
-	ticker := time.NewTicker(5 * time.Second)
-	defer ticker.Stop()
-
-	for {
-		select {
-		case <-timeout:
-			return fmt.Errorf("migration job timed out")
-		case <-ticker.C:
-			currentJob := &batchv1.Job{}
-			err := m.client.Get(ctx, types.NamespacedName{
-				Name:      job.Name,
-				Namespace: job.Namespace,
-			}, currentJob)
+// getMigrationEnvVars returns the migrate container's environment. Credentials are
+// only ever referenced from Secrets so they never appear in the Job spec.
+func (m *MigrationRunner) getMigrationEnvVars(cxs *cloudxv1.CloudExpressService, config *MigrationConfig) []corev1.EnvVar {
+	credentials := migrationCredentialsSecretName(cxs)
+	envVars := append(m.getDatabaseEnvVars(config.Endpoint),
+		corev1.EnvVar{
+			Name:      "DATABASE_URL",
+			ValueFrom: secretKeyRef(config.SecretName, config.SecretKey),
+		},
+		corev1.EnvVar{
+			Name:  "DB_NAME",
+			Value: config.Endpoint.Database,
+		},
+	)
 
-			if err != nil {
-				return fmt.Errorf("failed to get job status: %w", err)
-			}
+	switch config.Tool {
+	case "flyway":
+		envVars = append(envVars,
+			corev1.EnvVar{
+				Name:  "FLYWAY_URL",
+				Value: config.Endpoint.JDBCURL(),
+			},
+			corev1.EnvVar{
+				Name:      "FLYWAY_USER",
+				ValueFrom: secretKeyRef(credentials, "DB_USER"),
+			},
+			corev1.EnvVar{
+				Name:      "FLYWAY_PASSWORD",
+				ValueFrom: secretKeyRef(credentials, "DB_PASSWORD"),
+			},
+		)
+	case "migrate":
+		envVars = append(envVars, corev1.EnvVar{
+			Name:      "MIGRATE_DATABASE_URL",
+			ValueFrom: secretKeyRef(credentials, "MIGRATE_DATABASE_URL"),
+		})
+	case "goose":
+		envVars = append(envVars,
+			corev1.EnvVar{
+				Name:  "GOOSE_DRIVER",
+				Value: config.Endpoint.GooseDriver(),
+			},
+			corev1.EnvVar{
+				Name:      "GOOSE_DBSTRING",
+				ValueFrom: secretKeyRef(credentials, "GOOSE_DBSTRING"),
+			},
+		)
+	}
 
-			if currentJob.Status.Succeeded > 0 {
-				m.log.Info("Migration completed successfully", "job", job.Name)
-				return nil
-			}
+	return envVars
+}
 
-			if currentJob.Status.Failed > 0 {
-				// Get pod logs for debugging
-				pods := &corev1.PodList{}
-				err = m.client.List(ctx, pods, 
-					client.InNamespace(job.Namespace),
-					client.MatchingLabels{
-						"job-name": job.Name,
-					})
-
-				if err == nil && len(pods.Items) > 0 {
-					// Log the pod status for debugging
-					for _, pod := range pods.Items {
-						m.log.Error(nil, "Migration pod failed", 
-							"pod", pod.Name,
-							"status", pod.Status.Phase,
-							"reason", pod.Status.Reason)
-					}
-				}
-
-				return fmt.Errorf("migration job failed")
-			}
+// migrationCredentialsSecretName is the Secret holding tool-specific connection strings
+func migrationCredentialsSecretName(cxs *cloudxv1.CloudExpressService) string {
+	return fmt.Sprintf("%s-migration-credentials", cxs.Name)
+}
+
+// ensureCredentialsSecret maintains the tool-specific connection strings derived
+// from the database URL, since tools disagree on the connection string format
+func (m *MigrationRunner) ensureCredentialsSecret(ctx context.Context, cxs *cloudxv1.CloudExpressService, config *MigrationConfig) error {
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      migrationCredentialsSecretName(cxs),
+			Namespace: cxs.Namespace,
+			Labels: map[string]string{
+				"cygni.io/service": cxs.Name,
+				"cygni.io/type":    "migration",
+			},
+		},
+		Type: corev1.SecretTypeOpaque,
+		Data: map[string][]byte{
+			"DB_USER":              []byte(config.Endpoint.User),
+			"DB_PASSWORD":          []byte(config.Endpoint.Password),
+			"MIGRATE_DATABASE_URL": []byte(config.Endpoint.DriverURL()),
+			"GOOSE_DBSTRING":       []byte(config.Endpoint.GooseDSN()),
+		},
+	}
+
+	if m.scheme != nil {
+		if err := controllerutil.SetControllerReference(cxs, secret, m.scheme); err != nil {
+			return fmt.Errorf("failed to set controller reference: %w", err)
+		}
+	}
+
+	existing := &corev1.Secret{}
+	err := m.client.Get(ctx, types.NamespacedName{
+		Name:      secret.Name,
+		Namespace: secret.Namespace,
+	}, existing)
+
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return m.client.Create(ctx, secret)
+		}
+		return err
+	}
+
+	existing.Data = secret.Data
+	return m.client.Update(ctx, existing)
+}
+
+// secretKeyRef references a key of a Secret in the pod's namespace
+func secretKeyRef(name, key string) *corev1.EnvVarSource {
+	return &corev1.EnvVarSource{
+		SecretKeyRef: &corev1.SecretKeySelector{
+			LocalObjectReference: corev1.LocalObjectReference{
+				Name: name,
+			},
+			Key: key,
+		},
+	}
+}
+
+// logFailedPods logs the status of a failed job's pods for debugging
+func (m *MigrationRunner) logFailedPods(ctx context.Context, job *batchv1.Job) {
+	pods := &corev1.PodList{}
+	err := m.client.List(ctx, pods, 
+		client.InNamespace(job.Namespace),
+		client.MatchingLabels{
+			"job-name": job.Name,
+		})
+
+	if err == nil && len(pods.Items) > 0 {
+		for _, pod := range pods.Items {
+			m.log.Error(nil, "Migration pod failed", 
+				"pod", pod.Name,
+				"status", pod.Status.Phase,
+				"reason", pod.Status.Reason)
+		}
+	}
+}
+
+// Safety classifications for a revision's migrations
+const (
+	// MigrationSafetyReversible migrations have down migrations that are safe to run automatically
+	MigrationSafetyReversible = "reversible"
+
+	// MigrationSafetyExpandOnly migrations only add schema, so the previous image keeps working
+	MigrationSafetyExpandOnly = "expand-only"
+
+	// MigrationSafetyDestructive migrations drop or rewrite data and are never reverted automatically
+	MigrationSafetyDestructive = "destructive"
+)
+
+// maxSchemaHistory bounds the schema revisions kept in status
+const maxSchemaHistory = 10
+
+// recordSchemaRevision remembers which schema version an image expects once its
+// migrations have been applied
+func recordSchemaRevision(cxs *cloudxv1.CloudExpressService) {
+	spec := cxs.Spec.Migrations
+	if spec == nil || spec.SchemaVersion == "" {
+		return
+	}
+
+	revision := cloudxv1.SchemaRevision{
+		Image:         cxs.Spec.Image,
+		SchemaVersion: spec.SchemaVersion,
+		Safety:        spec.Safety,
+		AppliedAt:     metav1.Now(),
+	}
+	if cxs.Status.Migration != nil {
+		revision.SourceVersion = cxs.Status.Migration.SourceVersion
+	}
+
+	history := []cloudxv1.SchemaRevision{}
+	for _, existing := range cxs.Status.SchemaHistory {
+		if existing.Image != revision.Image {
+			history = append(history, existing)
+		}
+	}
+	history = append(history, revision)
+	if len(history) > maxSchemaHistory {
+		history = history[len(history)-maxSchemaHistory:]
+	}
+	cxs.Status.SchemaHistory = history
+}
+
+// schemaRevisionFor returns the recorded schema revision of an image
+func schemaRevisionFor(cxs *cloudxv1.CloudExpressService, image string) *cloudxv1.SchemaRevision {
+	for i := range cxs.Status.SchemaHistory {
+		if cxs.Status.SchemaHistory[i].Image == image {
+			return &cxs.Status.SchemaHistory[i]
 		}
 	}
+	return nil
 }
 
-// RollbackMigrations runs down migrations in case of deployment failure
-func (m *MigrationRunner) RollbackMigrations(ctx context.Context, cxs *cloudxv1.CloudExpressService) error {
-	// Similar to RunMigrations but executes down/rollback commands
+// RollbackMigrations reverts the schema to the version expected by targetImage when a
+// rollout is rolled back. It is opt-in through migrations.rollbackOnFailure and refuses
+// to run down migrations unless the current revision is classified as reversible.
+// Unless it returns an error, the returned status records targetImage's migrations
+// as applied, so that the next reconcile does not run them against the current
+// schema. It is nil when no migrations were recorded for the current image.
+func (m *MigrationRunner) RollbackMigrations(ctx context.Context, cxs *cloudxv1.CloudExpressService, targetImage string) (*cloudxv1.MigrationStatus, error) {
+	if cxs.Spec.Migrations == nil || !cxs.Spec.Migrations.RollbackOnFailure {
+		return nil, nil
+	}
+
+	current := schemaRevisionFor(cxs, cxs.Spec.Image)
+	if current == nil {
+		// No migrations were applied for the image being rolled back
+		return nil, nil
+	}
+
+	target := schemaRevisionFor(cxs, targetImage)
+	if target == nil {
+		return nil, fmt.Errorf("no schema version recorded for %s", targetImage)
+	}
+
 	migrationConfig, err := m.detectMigrationConfig(ctx, cxs)
-	if err != nil || migrationConfig == nil {
-		return nil // No migrations to rollback
+	if err != nil {
+		return nil, fmt.Errorf("failed to detect migration config: %w", err)
+	}
+	if migrationConfig == nil {
+		return nil, nil
 	}
 
-	// Modify command for rollback
-	job := m.constructMigrationJob(cxs, migrationConfig)
-	job.Name = fmt.Sprintf("%s-rollback-%s", cxs.Name, time.Now().Format("20060102-150405"))
-	
-	// Update command for rollback
-	switch migrationConfig.Tool {
+	checksum, err := m.migrationChecksum(ctx, cxs, migrationConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	if current.SchemaVersion == target.SchemaVersion {
+		return rolledBackMigrationStatus(cxs, migrationConfig, targetImage, checksum,
+			fmt.Sprintf("schema %s is shared with %s", target.SchemaVersion, cxs.Spec.Image)), nil
+	}
+
+	switch current.Safety {
+	case MigrationSafetyExpandOnly:
+		// The previous image keeps working against the expanded schema
+		m.log.Info("Migrations are expand-only, keeping schema during rollback",
+			"service", cxs.Name,
+			"schemaVersion", current.SchemaVersion)
+		return rolledBackMigrationStatus(cxs, migrationConfig, targetImage, checksum,
+			fmt.Sprintf("schema kept at %s: migrations are expand-only", current.SchemaVersion)), nil
+	case MigrationSafetyReversible:
+	default:
+		return nil, fmt.Errorf("refusing automatic down-migration from schema %s to %s: migrations are classified %q",
+			current.SchemaVersion, target.SchemaVersion, current.Safety)
+	}
+
+	jobName := fmt.Sprintf("%s-rollback-%s", cxs.Name, shortHash(cxs.Spec.Image, target.SchemaVersion, checksum))
+	job := m.constructMigrationJob(cxs, migrationConfig, jobName)
+	container := &job.Spec.Template.Spec.Containers[0]
+	container.Command = m.getDownCommand(migrationConfig, cxs.Spec.Migrations.DownCommand, target.SchemaVersion)
+	container.Args = nil
+	container.Env = append(container.Env, corev1.EnvVar{
+		Name:  "TARGET_SCHEMA_VERSION",
+		Value: target.SchemaVersion,
+	})
+
+	if err := m.ensureCredentialsSecret(ctx, cxs, migrationConfig); err != nil {
+		return nil, fmt.Errorf("failed to prepare migration credentials: %w", err)
+	}
+
+	// A rollback retried after a failure runs the job again
+	job, err = createOrRerunJob(ctx, m.client, job)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start rollback job: %w", err)
+	}
+
+	m.log.Info("Rolling back migrations",
+		"service", cxs.Name,
+		"from", current.SchemaVersion,
+		"to", target.SchemaVersion,
+		"job", jobName)
+
+	// The job's own backoff limit decides when it has failed
+	succeeded, err := waitForJobCompletion(ctx, m.client, job, migrationConfig.Timeout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to wait for rollback job %s: %w", jobName, err)
+	}
+	if !succeeded {
+		m.logFailedPods(ctx, job)
+		logs, err := jobLogs(ctx, m.client, m.kubeClient, job, "migrate")
+		if err != nil {
+			m.log.Error(err, "Failed to capture rollback logs", "job", jobName)
+		}
+		return nil, fmt.Errorf("rollback job %s failed:\n%s", jobName, logs)
+	}
+
+	return rolledBackMigrationStatus(cxs, migrationConfig, targetImage, checksum,
+		fmt.Sprintf("schema rolled back to %s by job %s", target.SchemaVersion, jobName)), nil
+}
+
+// rolledBackMigrationStatus marks targetImage's migrations as applied, so that
+// RunMigrations does not re-run them once the image is reverted
+func rolledBackMigrationStatus(cxs *cloudxv1.CloudExpressService, config *MigrationConfig, targetImage, checksum, message string) *cloudxv1.MigrationStatus {
+	return &cloudxv1.MigrationStatus{
+		Phase:         MigrationPhaseSucceeded,
+		JobName:       fmt.Sprintf("%s-migrate-%s", cxs.Name, shortHash(targetImage, checksum)),
+		Image:         targetImage,
+		Checksum:      checksum,
+		SourceVersion: migrationSourceVersion(config, checksum),
+		CompletedAt:   metav1.Now(),
+		Message:       message,
+	}
+}
+
+// getDownCommand returns a command that migrates the schema down to the target version
+func (m *MigrationRunner) getDownCommand(config *MigrationConfig, appCommand []string, version string) []string {
+	if config.Mode == migrationModeApp {
+		return appCommand
+	}
+
+	directory := migrationsPath(config)
+	switch config.Tool {
 	case "flyway":
-		job.Spec.Template.Spec.Containers[0].Command = []string{
+		return []string{
 			"flyway",
-			"-url=${DATABASE_URL}",
-			"-locations=filesystem:/migrations",
+			"-locations=filesystem:" + directory,
+			"-target=" + version,
 			"undo",
 		}
 	case "migrate":
-		job.Spec.Template.Spec.Containers[0].Command = []string{
+		return []string{
 			"migrate",
-			"-path", "/migrations",
-			"-database", "${DATABASE_URL}",
-			"down", "1", // Rollback one version
+			"-path", directory,
+			"-database", "$(MIGRATE_DATABASE_URL)",
+			"goto", version,
+		}
+	case "sql-migrate":
+		return []string{
+			"sql-migrate",
+			"down",
+			"-config=" + filepath.Join(directory, "dbconfig.yml"),
+			"-version=" + version,
 		}
 	case "goose":
-		job.Spec.Template.Spec.Containers[0].Command = []string{
+		return []string{
 			"goose",
-			"-dir", "/migrations",
-			"down",
+			"-dir", directory,
+			"down-to", version,
 		}
+	default:
+		return []string{"echo", "Unknown migration tool"}
 	}
-
-	if err := m.client.Create(ctx, job); err != nil {
-		return fmt.Errorf("failed to create rollback job: %w", err)
-	}
-
-	return m.waitForJob(ctx, job)
-}
\ No newline at end of file
+}
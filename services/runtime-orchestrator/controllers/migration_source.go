@@ -0,0 +1,211 @@
+package controllers
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+
+	cloudxv1 "github.com/cygni/runtime-orchestrator/api/v1"
+)
+
+// sha256Checksum matches a hex-encoded sha256 digest, optionally prefixed with "sha256:"
+var sha256Checksum = regexp.MustCompile(`^(sha256:)?[a-f0-9]{64}$`)
+
+// gitCommit matches a full SHA-1 or SHA-256 git commit ID
+var gitCommit = regexp.MustCompile(`^([a-f0-9]{40}|[a-f0-9]{64})$`)
+
+// validateMigrationSource checks that exactly one source is configured and is complete
+func validateMigrationSource(source *cloudxv1.MigrationSource) error {
+	configured := 0
+	if source.ConfigMap != "" {
+		configured++
+	}
+	if source.OCI != nil {
+		configured++
+		if source.OCI.Ref == "" {
+			return fmt.Errorf("source.oci.ref is required")
+		}
+	}
+	if source.Git != nil {
+		configured++
+		if source.Git.Repository == "" || source.Git.Ref == "" {
+			return fmt.Errorf("source.git.repository and source.git.ref are required")
+		}
+	}
+
+	if configured > 1 {
+		return fmt.Errorf("only one of source.configMap, source.oci and source.git may be set")
+	}
+
+	if source.Directory != "" && source.OCI == nil && source.Git == nil {
+		return fmt.Errorf("source.directory only applies to OCI and git sources")
+	}
+
+	if source.Checksum != "" && !sha256Checksum.MatchString(source.Checksum) {
+		return fmt.Errorf("source.checksum must be a sha256 hex digest")
+	}
+
+	// Tags and branches can move, so the migration set must be pinned either by
+	// an immutable reference or by the checksum of its files. The job is keyed
+	// on both, so a pinned set never changes under an existing job.
+	if source.Checksum == "" {
+		if source.OCI != nil && !strings.Contains(source.OCI.Ref, "@sha256:") {
+			return fmt.Errorf("source.oci.ref must be pinned by digest unless source.checksum is set")
+		}
+		if source.Git != nil && !gitCommit.MatchString(source.Git.Ref) {
+			return fmt.Errorf("source.git.ref must be a full commit SHA unless source.checksum is set")
+		}
+	}
+
+	return nil
+}
+
+// migrationSourceVersion describes the migration set so it can be recorded with the deployment
+func migrationSourceVersion(config *MigrationConfig, checksum string) string {
+	switch {
+	case config.Mode == migrationModeApp:
+		return "image"
+	case config.OCI != nil && config.SourceChecksum != "":
+		return fmt.Sprintf("oci:%s#%s", config.OCI.Ref, config.SourceChecksum)
+	case config.OCI != nil:
+		return "oci:" + config.OCI.Ref
+	case config.Git != nil && config.SourceChecksum != "":
+		return fmt.Sprintf("git:%s@%s#%s", config.Git.Repository, config.Git.Ref, config.SourceChecksum)
+	case config.Git != nil:
+		return fmt.Sprintf("git:%s@%s", config.Git.Repository, config.Git.Ref)
+	default:
+		return fmt.Sprintf("configmap:%s@%s", config.ConfigMap, checksum)
+	}
+}
+
+// applyMigrationSource replaces the ConfigMap volume with an emptyDir populated by
+// init containers that pull the migration set from an OCI artifact or git, and
+// optionally verify its checksum before any migration runs
+func (m *MigrationRunner) applyMigrationSource(job *batchv1.Job, config *MigrationConfig) {
+	podSpec := &job.Spec.Template.Spec
+
+	podSpec.Volumes = []corev1.Volume{
+		{
+			Name: "migrations",
+			VolumeSource: corev1.VolumeSource{
+				EmptyDir: &corev1.EmptyDirVolumeSource{},
+			},
+		},
+	}
+
+	mounts := []corev1.VolumeMount{
+		{
+			Name:      "migrations",
+			MountPath: "/migrations",
+		},
+	}
+
+	var fetch corev1.Container
+	if config.OCI != nil {
+		fetch = m.ociFetchContainer(podSpec, config.OCI)
+	} else {
+		fetch = m.gitFetchContainer(config.Git)
+	}
+	fetch.VolumeMounts = append(mounts, fetch.VolumeMounts...)
+	podSpec.InitContainers = append(podSpec.InitContainers, fetch)
+
+	if config.SourceChecksum != "" {
+		expected := strings.TrimPrefix(config.SourceChecksum, "sha256:")
+		podSpec.InitContainers = append(podSpec.InitContainers, corev1.Container{
+			Name:  "verify-migrations",
+			Image: "busybox:1.35",
+			Command: []string{
+				"sh",
+				"-c",
+				`cd /migrations && actual=$(find . -type f -print0 | sort -z | xargs -0 sha256sum | sha256sum | cut -d' ' -f1); ` +
+					`if [ "$actual" != "$EXPECTED_CHECKSUM" ]; then echo "migration checksum mismatch: expected $EXPECTED_CHECKSUM, got $actual"; exit 1; fi`,
+			},
+			Env: []corev1.EnvVar{
+				{
+					Name:  "EXPECTED_CHECKSUM",
+					Value: expected,
+				},
+			},
+			VolumeMounts: mounts,
+		})
+	}
+}
+
+// ociFetchContainer pulls an OCI artifact into the migrations volume with oras
+func (m *MigrationRunner) ociFetchContainer(podSpec *corev1.PodSpec, source *cloudxv1.OCIMigrationSource) corev1.Container {
+	container := corev1.Container{
+		Name:    "fetch-migrations",
+		Image:   "ghcr.io/oras-project/oras:v1.1.0",
+		Command: []string{"oras", "pull", source.Ref, "-o", "/migrations"},
+	}
+
+	if source.PullSecret != "" {
+		podSpec.Volumes = append(podSpec.Volumes, corev1.Volume{
+			Name: "registry-auth",
+			VolumeSource: corev1.VolumeSource{
+				Secret: &corev1.SecretVolumeSource{
+					SecretName: source.PullSecret,
+					Items: []corev1.KeyToPath{
+						{
+							Key:  corev1.DockerConfigJsonKey,
+							Path: "config.json",
+						},
+					},
+				},
+			},
+		})
+		container.Command = append(container.Command, "--registry-config", "/auth/config.json")
+		container.VolumeMounts = []corev1.VolumeMount{
+			{
+				Name:      "registry-auth",
+				MountPath: "/auth",
+				ReadOnly:  true,
+			},
+		}
+	}
+
+	return container
+}
+
+// gitFetchContainer checks out a single ref of a git repository into the migrations volume
+func (m *MigrationRunner) gitFetchContainer(source *cloudxv1.GitMigrationSource) corev1.Container {
+	container := corev1.Container{
+		Name:  "fetch-migrations",
+		Image: "alpine/git:2.43.0",
+		Command: []string{
+			"sh",
+			"-c",
+			`set -e; cd /migrations; git init -q .; git remote add origin "$GIT_REPOSITORY"; ` +
+				`git -c credential.helper='!f() { echo "username=${GIT_USERNAME:-git}"; echo "password=${GIT_PASSWORD:-}"; }; f' fetch -q --depth 1 origin "$GIT_REF"; ` +
+				`git checkout -q FETCH_HEAD; git rev-parse HEAD; rm -rf .git`,
+		},
+		Env: []corev1.EnvVar{
+			{
+				Name:  "GIT_REPOSITORY",
+				Value: source.Repository,
+			},
+			{
+				Name:  "GIT_REF",
+				Value: source.Ref,
+			},
+		},
+	}
+
+	if source.CredentialsSecret != "" {
+		container.Env = append(container.Env,
+			corev1.EnvVar{
+				Name:      "GIT_USERNAME",
+				ValueFrom: secretKeyRef(source.CredentialsSecret, "username"),
+			},
+			corev1.EnvVar{
+				Name:      "GIT_PASSWORD",
+				ValueFrom: secretKeyRef(source.CredentialsSecret, "password"),
+			},
+		)
+	}
+
+	return container
+}
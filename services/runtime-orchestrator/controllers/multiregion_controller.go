@@ -3,34 +3,48 @@ package controllers
 import (
 	"context"
 	"fmt"
+	"net/http"
 	"time"
 
 	"github.com/go-logr/logr"
 	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/discovery"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
 
 	cloudxv1 "github.com/cygni/runtime-orchestrator/api/v1"
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/route53"
 )
 
 // MultiRegionServiceReconciler reconciles a MultiRegionService object
 type MultiRegionServiceReconciler struct {
 	client.Client
-	Log            logr.Logger
-	Scheme         *runtime.Scheme
-	Route53Client  *route53.Route53
-	RegionClusters map[string]*RegionCluster
+	Log          logr.Logger
+	Scheme       *runtime.Scheme
+	DNSProviders map[string]DNSProvider // by provider name
+	Clusters     *ClusterRegistry
+	HealthClient *http.Client
 }
 
+// RegionCluster is a cluster registered for a region
 type RegionCluster struct {
 	Name     string
 	Endpoint string
 	Client   client.Client
+
+	// ClusterRegistration the cluster was registered by
+	Registration string
+
+	// Result of the last health check
+	Healthy         bool
+	LastHealthCheck time.Time
+
+	discovery discovery.DiscoveryInterface
+	source    string // registration generation and credentials version the client was built from
 }
 
 func (r *MultiRegionServiceReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
@@ -59,23 +73,43 @@ func (r *MultiRegionServiceReconciler) Reconcile(ctx context.Context, req ctrl.R
 	mrs.Status.Phase = "Reconciling"
 	mrs.Status.LastUpdateTime = metav1.Now()
 
+	// Health check results carry over between reconciles
+	previousStatuses := map[string]cloudxv1.RegionStatus{}
+	for _, status := range mrs.Status.RegionStatus {
+		previousStatuses[status.Region] = status
+	}
+	healthCheck := regionHealthCheckFor(mrs, cxs)
+
 	// Deploy to each region
 	regionStatuses := []cloudxv1.RegionStatus{}
 	allHealthy := true
+	healthyRegions := 0
 
 	for _, region := range mrs.Spec.Regions {
 		if !region.Enabled {
 			continue
 		}
 
-		status, err := r.deployToRegion(ctx, mrs, cxs, region)
+		previous := previousStatuses[region.Name]
+		status, err := r.deployToRegion(ctx, mrs, cxs, region, healthCheck, previous)
 		if err != nil {
 			log.Error(err, "Failed to deploy to region", "region", region.Name)
 			status = cloudxv1.RegionStatus{
-				Region:  region.Name,
-				Status:  "Failed",
-				Healthy: false,
+				Region:              region.Name,
+				Status:              "Failed",
+				Healthy:             false,
+				ConsecutiveFailures: previous.ConsecutiveFailures + 1,
+				Message:             err.Error(),
+				LastHealthCheck:     metav1.Now(),
 			}
+		}
+
+		if status.Healthy != previous.Healthy {
+			log.Info("Region health changed", "region", region.Name, "healthy", status.Healthy, "message", status.Message)
+		}
+		if status.Healthy {
+			healthyRegions++
+		} else {
 			allHealthy = false
 		}
 
@@ -84,8 +118,8 @@ func (r *MultiRegionServiceReconciler) Reconcile(ctx context.Context, req ctrl.R
 
 	mrs.Status.RegionStatus = regionStatuses
 
-	// Configure global load balancing
-	if allHealthy && mrs.Spec.LoadBalancer.Domain != "" {
+	// Configure global load balancing, routing around unhealthy regions
+	if healthyRegions > 0 && mrs.Spec.LoadBalancer.Domain != "" {
 		endpoint, err := r.configureGlobalLoadBalancer(ctx, mrs)
 		if err != nil {
 			log.Error(err, "Failed to configure global load balancer")
@@ -93,6 +127,9 @@ func (r *MultiRegionServiceReconciler) Reconcile(ctx context.Context, req ctrl.R
 		} else {
 			mrs.Status.Endpoint = endpoint
 			mrs.Status.Phase = "Ready"
+			if !allHealthy {
+				mrs.Status.Phase = "Degraded"
+			}
 		}
 	} else if !allHealthy {
 		mrs.Status.Phase = "Degraded"
@@ -103,15 +140,18 @@ func (r *MultiRegionServiceReconciler) Reconcile(ctx context.Context, req ctrl.R
 		return ctrl.Result{}, err
 	}
 
-	// Requeue for health checks
-	return ctrl.Result{RequeueAfter: 60 * time.Second}, nil
+	// Requeue for the next health check
+	return ctrl.Result{RequeueAfter: healthCheck.interval}, nil
 }
 
-func (r *MultiRegionServiceReconciler) deployToRegion(ctx context.Context, mrs *cloudxv1.MultiRegionService, cxs *cloudxv1.CloudExpressService, region cloudxv1.RegionConfig) (cloudxv1.RegionStatus, error) {
-	regionCluster, ok := r.RegionClusters[region.Name]
+func (r *MultiRegionServiceReconciler) deployToRegion(ctx context.Context, mrs *cloudxv1.MultiRegionService, cxs *cloudxv1.CloudExpressService, region cloudxv1.RegionConfig, healthCheck regionHealthCheck, previous cloudxv1.RegionStatus) (cloudxv1.RegionStatus, error) {
+	regionCluster, ok := r.Clusters.Get(region.Name)
 	if !ok {
 		return cloudxv1.RegionStatus{}, fmt.Errorf("region cluster not configured: %s", region.Name)
 	}
+	if !regionCluster.Healthy {
+		return cloudxv1.RegionStatus{}, fmt.Errorf("region cluster %s is unreachable", region.Name)
+	}
 
 	// Create a copy of the CloudExpressService for this region
 	regionalCXS := cxs.DeepCopy()
@@ -166,138 +206,64 @@ func (r *MultiRegionServiceReconciler) deployToRegion(ctx context.Context, mrs *
 		return cloudxv1.RegionStatus{}, fmt.Errorf("failed to get deployment status: %w", err)
 	}
 
+	status := cloudxv1.RegionStatus{
+		Region:        region.Name,
+		Status:        string(deploymentStatus.Status.Phase),
+		Endpoint:      fmt.Sprintf("https://%s.%s.cygni.app", cxs.Name, region.Name),
+		ReadyReplicas: deploymentStatus.Status.ReadyReplicas,
+	}
+
 	// Perform health check
-	healthy := r.checkRegionHealth(ctx, region, deploymentStatus)
-
-	return cloudxv1.RegionStatus{
-		Region:          region.Name,
-		Status:          string(deploymentStatus.Status.Phase),
-		Endpoint:        fmt.Sprintf("https://%s.%s.cygni.app", cxs.Name, region.Name),
-		ReadyReplicas:   deploymentStatus.Status.ReadyReplicas,
-		Healthy:         healthy,
-		LastHealthCheck: metav1.Now(),
-	}, nil
+	r.checkRegionHealth(ctx, healthCheck, &status, deploymentStatus, previous)
+
+	return status, nil
 }
 
 func (r *MultiRegionServiceReconciler) configureGlobalLoadBalancer(ctx context.Context, mrs *cloudxv1.MultiRegionService) (string, error) {
-	// Configure Route53 for global load balancing
-	hostedZoneID := r.getHostedZoneID(mrs.Spec.LoadBalancer.Domain)
-	
-	// Create weighted routing policy records
-	changeSet := &route53.ChangeBatch{
-		Changes: []*route53.Change{},
+	providerName := mrs.Spec.LoadBalancer.Provider
+	if providerName == "" {
+		providerName = DNSProviderRoute53
 	}
-
-	for _, regionStatus := range mrs.Status.RegionStatus {
-		if !regionStatus.Healthy {
-			continue
-		}
-
-		// Find region config
-		var regionConfig *cloudxv1.RegionConfig
-		for _, rc := range mrs.Spec.Regions {
-			if rc.Name == regionStatus.Region {
-				regionConfig = &rc
-				break
-			}
-		}
-
-		if regionConfig == nil {
-			continue
-		}
-
-		weight := int64(100 / len(mrs.Spec.Regions)) // Default equal weight
-		if regionConfig.Weight > 0 {
-			weight = int64(regionConfig.Weight)
-		}
-
-		change := &route53.Change{
-			Action: aws.String("UPSERT"),
-			ResourceRecordSet: &route53.ResourceRecordSet{
-				Name: aws.String(mrs.Spec.LoadBalancer.Domain),
-				Type: aws.String("A"),
-				SetIdentifier: aws.String(regionStatus.Region),
-				Weight: aws.Int64(weight),
-				AliasTarget: &route53.AliasTarget{
-					HostedZoneId: aws.String(r.getRegionalHostedZoneID(regionStatus.Region)),
-					DNSName:      aws.String(regionStatus.Endpoint),
-					EvaluateTargetHealth: aws.Bool(true),
-				},
-			},
-		}
-
-		changeSet.Changes = append(changeSet.Changes, change)
+	provider, ok := r.DNSProviders[providerName]
+	if !ok {
+		return "", fmt.Errorf("DNS provider not configured: %s", providerName)
 	}
 
-	// Apply Route53 changes
-	_, err := r.Route53Client.ChangeResourceRecordSets(&route53.ChangeResourceRecordSetsInput{
-		HostedZoneId: aws.String(hostedZoneID),
-		ChangeBatch:  changeSet,
-	})
-
+	records, err := buildDNSRecords(mrs)
 	if err != nil {
-		return "", fmt.Errorf("failed to update Route53: %w", err)
-	}
-
-	return fmt.Sprintf("https://%s", mrs.Spec.LoadBalancer.Domain), nil
-}
-
-func (r *MultiRegionServiceReconciler) checkRegionHealth(ctx context.Context, region cloudxv1.RegionConfig, deployment *cloudxv1.CloudExpressService) bool {
-	// Simple health check - verify deployment is running and has ready replicas
-	if deployment.Status.Phase != "Running" {
-		return false
+		return "", err
 	}
 
-	if deployment.Status.ReadyReplicas == 0 {
-		return false
+	if err := provider.ApplyRecords(ctx, mrs.Spec.LoadBalancer.Domain, records); err != nil {
+		return "", fmt.Errorf("failed to publish DNS records with %s: %w", providerName, err)
 	}
 
-	// TODO: Implement actual HTTP health checks
-	return true
-}
-
-func (r *MultiRegionServiceReconciler) getHostedZoneID(domain string) string {
-	// In production, this would look up the hosted zone ID from Route53
-	return "Z1234567890ABC"
+	return fmt.Sprintf("https://%s", mrs.Spec.LoadBalancer.Domain), nil
 }
 
-func (r *MultiRegionServiceReconciler) getRegionalHostedZoneID(region string) string {
-	// Regional hosted zone IDs for ALB/NLB
-	regionalZones := map[string]string{
-		"us-east-1": "Z35SXDOTRQ7X7K",
-		"us-west-2": "Z1H1FL5HABSF5",
-		"eu-west-1": "Z32O12XQLNTSW2",
-		"eu-central-1": "Z3F0SRJ5LGBH90",
-		"ap-southeast-1": "Z1LMS91P8CMLE5",
+func (r *MultiRegionServiceReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	if r.DNSProviders == nil {
+		providers, err := DNSProvidersFromEnv()
+		if err != nil {
+			return fmt.Errorf("failed to configure DNS providers: %w", err)
+		}
+		r.DNSProviders = providers
 	}
 
-	if zoneID, ok := regionalZones[region]; ok {
-		return zoneID
+	if r.HealthClient == nil {
+		// Probes set their own timeout
+		r.HealthClient = &http.Client{}
 	}
-	
-	return "Z35SXDOTRQ7X7K" // Default to us-east-1
-}
 
-func (r *MultiRegionServiceReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	// Initialize Route53 client
-	sess := session.Must(session.NewSession())
-	r.Route53Client = route53.New(sess)
-
-	// Initialize region clusters (would be configured from environment)
-	r.RegionClusters = map[string]*RegionCluster{
-		"us-east-1": {
-			Name:     "us-east-1",
-			Endpoint: "https://k8s-us-east-1.cygni.io",
-			Client:   mgr.GetClient(), // In production, would create client for remote cluster
-		},
-		"eu-west-1": {
-			Name:     "eu-west-1", 
-			Endpoint: "https://k8s-eu-west-1.cygni.io",
-			Client:   mgr.GetClient(), // In production, would create client for remote cluster
-		},
+	// Region clusters are registered at runtime through ClusterRegistrations,
+	// so the registry must be the one the ClusterRegistration controller fills
+	if r.Clusters == nil {
+		return fmt.Errorf("MultiRegionServiceReconciler requires the Registry shared with the ClusterRegistration controller")
 	}
 
+	// Status is written on every pass, so only spec changes trigger a
+	// reconcile; health checks run on the requeue interval
 	return ctrl.NewControllerManagedBy(mgr).
-		For(&cloudxv1.MultiRegionService{}).
+		For(&cloudxv1.MultiRegionService{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
 		Complete(r)
 }
\ No newline at end of file
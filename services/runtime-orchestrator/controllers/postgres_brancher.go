@@ -0,0 +1,442 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/lib/pq"
+)
+
+// pgObjectInUse is the SQLSTATE returned when a template database has other sessions
+const pgObjectInUse = "55006"
+
+// previewDatabaseMarker starts the comment the brancher puts on the databases
+// it creates, followed by their creation time
+const previewDatabaseMarker = "cygni.io/preview created-at="
+
+// PostgresBrancher branches preview databases on a single Postgres server,
+// using CREATE DATABASE ... TEMPLATE or pg_dump/pg_restore
+type PostgresBrancher struct {
+	admin *DatabaseEndpoint
+	log   logr.Logger
+}
+
+// NewPostgresBrancher returns a brancher that connects with an administrative
+// connection URL. The role needs CREATEDB and CREATEROLE.
+func NewPostgresBrancher(adminURL string, log logr.Logger) (*PostgresBrancher, error) {
+	endpoint, err := parseDatabaseURL(adminURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid admin URL: %w", err)
+	}
+	if endpoint.Scheme != "postgres" {
+		return nil, fmt.Errorf("admin URL must be a postgres URL")
+	}
+
+	return &PostgresBrancher{
+		admin: endpoint,
+		log:   log,
+	}, nil
+}
+
+// Branch creates the preview's role and database
+func (p *PostgresBrancher) Branch(ctx context.Context, req BranchRequest) (*DatabaseBranch, error) {
+	if err := checkPreviewDatabaseName(req.Name); err != nil {
+		return nil, err
+	}
+
+	admin, err := p.connect(ctx, p.admin)
+	if err != nil {
+		return nil, err
+	}
+	defer admin.Close()
+
+	password, err := generatePassword()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := p.ensureRole(ctx, admin, req.Name, password); err != nil {
+		return nil, err
+	}
+
+	branch := &DatabaseBranch{
+		Name:     req.Name,
+		User:     req.Name,
+		Password: password,
+		URL:      p.endpointFor(req.Name, req.Name, password).DriverURL(),
+	}
+
+	var exists bool
+	if err := admin.QueryRowContext(ctx,
+		"SELECT EXISTS (SELECT 1 FROM pg_database WHERE datname = $1)", req.Name).Scan(&exists); err != nil {
+		return nil, fmt.Errorf("failed to check for database %s: %w", req.Name, err)
+	}
+	if exists {
+		// The role's password was rotated above, so the database is usable again
+		return branch, nil
+	}
+
+	branch.Strategy, branch.SourceSize, err = p.createDatabase(ctx, admin, req)
+	if err == nil {
+		err = p.markDatabase(ctx, admin, req.Name)
+	}
+	if err != nil {
+		// Leave nothing behind so the next attempt starts from scratch
+		if _, dropErr := admin.ExecContext(ctx, "DROP DATABASE IF EXISTS "+pq.QuoteIdentifier(req.Name)); dropErr != nil {
+			p.log.Error(dropErr, "Failed to drop partially created database", "database", req.Name)
+		}
+		return nil, err
+	}
+
+	return branch, nil
+}
+
+// Delete terminates the database's sessions and drops it along with its role
+func (p *PostgresBrancher) Delete(ctx context.Context, name string) error {
+	if err := checkPreviewDatabaseName(name); err != nil {
+		return err
+	}
+
+	admin, err := p.connect(ctx, p.admin)
+	if err != nil {
+		return err
+	}
+	defer admin.Close()
+
+	if _, err := admin.ExecContext(ctx,
+		"SELECT pg_terminate_backend(pid) FROM pg_stat_activity WHERE datname = $1 AND pid <> pg_backend_pid()", name); err != nil {
+		return fmt.Errorf("failed to disconnect sessions from %s: %w", name, err)
+	}
+
+	if _, err := admin.ExecContext(ctx, "DROP DATABASE IF EXISTS "+pq.QuoteIdentifier(name)); err != nil {
+		return fmt.Errorf("failed to drop database %s: %w", name, err)
+	}
+
+	if _, err := admin.ExecContext(ctx, "DROP ROLE IF EXISTS "+pq.QuoteIdentifier(name)); err != nil {
+		return fmt.Errorf("failed to drop role %s: %w", name, err)
+	}
+
+	p.log.Info("Dropped preview database", "database", name)
+	return nil
+}
+
+// List returns the preview databases on the server that carry the brancher's
+// marker
+func (p *PostgresBrancher) List(ctx context.Context) ([]PreviewDatabase, error) {
+	admin, err := p.connect(ctx, p.admin)
+	if err != nil {
+		return nil, err
+	}
+	defer admin.Close()
+
+	rows, err := admin.QueryContext(ctx, `SELECT datname, COALESCE(shobj_description(oid, 'pg_database'), '')
+		FROM pg_database WHERE datname LIKE 'preview\_%' ORDER BY datname`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list preview databases: %w", err)
+	}
+	defer rows.Close()
+
+	databases := []PreviewDatabase{}
+	for rows.Next() {
+		var name, comment string
+		if err := rows.Scan(&name, &comment); err != nil {
+			return nil, err
+		}
+		if !strings.HasPrefix(comment, previewDatabaseMarker) {
+			continue
+		}
+		createdAt, err := time.Parse(time.RFC3339, strings.TrimPrefix(comment, previewDatabaseMarker))
+		if err != nil {
+			continue
+		}
+		databases = append(databases, PreviewDatabase{Name: name, CreatedAt: createdAt})
+	}
+	return databases, rows.Err()
+}
+
+// markDatabase records that the brancher created a database, and when
+func (p *PostgresBrancher) markDatabase(ctx context.Context, admin *sql.DB, name string) error {
+	comment := previewDatabaseMarker + time.Now().UTC().Format(time.RFC3339)
+	if _, err := admin.ExecContext(ctx, fmt.Sprintf("COMMENT ON DATABASE %s IS %s",
+		pq.QuoteIdentifier(name), pq.QuoteLiteral(comment))); err != nil {
+		return fmt.Errorf("failed to mark database %s: %w", name, err)
+	}
+	return nil
+}
+
+// ensureRole creates the preview's login role, or resets its password
+func (p *PostgresBrancher) ensureRole(ctx context.Context, admin *sql.DB, name, password string) error {
+	var exists bool
+	if err := admin.QueryRowContext(ctx,
+		"SELECT EXISTS (SELECT 1 FROM pg_roles WHERE rolname = $1)", name).Scan(&exists); err != nil {
+		return fmt.Errorf("failed to check for role %s: %w", name, err)
+	}
+
+	verb := "CREATE"
+	if exists {
+		verb = "ALTER"
+	}
+
+	// Identifiers and passwords cannot be bound as query parameters
+	if _, err := admin.ExecContext(ctx, fmt.Sprintf("%s ROLE %s LOGIN PASSWORD %s",
+		verb, pq.QuoteIdentifier(name), pq.QuoteLiteral(password))); err != nil {
+		return fmt.Errorf("failed to %s role %s: %w", strings.ToLower(verb), name, err)
+	}
+
+	// pg_restore --role needs the admin to be able to act as the role
+	if _, err := admin.ExecContext(ctx, fmt.Sprintf("GRANT %s TO CURRENT_USER", pq.QuoteIdentifier(name))); err != nil {
+		return fmt.Errorf("failed to grant role %s: %w", name, err)
+	}
+
+	return nil
+}
+
+// createDatabase creates the preview's database, cloning the source when one
+// is given, and reports the strategy used and the size of the source
+func (p *PostgresBrancher) createDatabase(ctx context.Context, admin *sql.DB, req BranchRequest) (string, int64, error) {
+	create := fmt.Sprintf("CREATE DATABASE %s OWNER %s", pq.QuoteIdentifier(req.Name), pq.QuoteIdentifier(req.Name))
+
+	if req.Source == "" {
+		if _, err := admin.ExecContext(ctx, create); err != nil {
+			return "", 0, fmt.Errorf("failed to create database %s: %w", req.Name, err)
+		}
+		return BranchStrategyEmpty, 0, nil
+	}
+
+	source, local, err := p.sourceEndpoint(req.Source)
+	if err != nil {
+		return "", 0, err
+	}
+
+	size, err := p.sourceSize(ctx, source)
+	if err != nil {
+		return "", 0, err
+	}
+
+	// Sources over the cap are cloned without data
+	if !req.MaxSize.IsZero() && size > req.MaxSize.Value() {
+		p.log.Info("Source database exceeds the size cap, cloning schema only",
+			"database", req.Name,
+			"sourceSize", size,
+			"maxSize", req.MaxSize.String())
+		if _, err := admin.ExecContext(ctx, create); err != nil {
+			return "", 0, fmt.Errorf("failed to create database %s: %w", req.Name, err)
+		}
+		if err := p.dump(ctx, source, req.Name, true); err != nil {
+			return "", 0, err
+		}
+		return BranchStrategySchemaOnly, size, nil
+	}
+
+	if local && req.Strategy != BranchStrategyDump {
+		_, err := admin.ExecContext(ctx, fmt.Sprintf("%s TEMPLATE %s", create, pq.QuoteIdentifier(source.Database)))
+		if err == nil {
+			if err := p.reassignOwnership(ctx, req.Name); err != nil {
+				return "", 0, err
+			}
+			return BranchStrategyTemplate, size, nil
+		}
+
+		// A template must have no other sessions; a busy source is dumped instead
+		var pqErr *pq.Error
+		if req.Strategy == BranchStrategyTemplate || !errors.As(err, &pqErr) || pqErr.Code != pgObjectInUse {
+			return "", 0, fmt.Errorf("failed to create database %s from template %s: %w", req.Name, source.Database, err)
+		}
+		p.log.Info("Template database is in use, falling back to pg_dump",
+			"database", req.Name,
+			"source", source.Database)
+	}
+
+	if _, err := admin.ExecContext(ctx, create); err != nil {
+		return "", 0, fmt.Errorf("failed to create database %s: %w", req.Name, err)
+	}
+	if err := p.dump(ctx, source, req.Name, false); err != nil {
+		return "", 0, err
+	}
+	return BranchStrategyDump, size, nil
+}
+
+// sourceEndpoint resolves a source given as a database name on the admin
+// server or as a connection URL, and reports whether it is on the admin server
+func (p *PostgresBrancher) sourceEndpoint(source string) (*DatabaseEndpoint, bool, error) {
+	if !strings.Contains(source, "://") {
+		return p.endpointFor(source, p.admin.User, p.admin.Password), true, nil
+	}
+
+	endpoint, err := parseDatabaseURL(source)
+	if err != nil {
+		return nil, false, fmt.Errorf("invalid source URL: %w", err)
+	}
+	if endpoint.Scheme != "postgres" {
+		return nil, false, fmt.Errorf("source must be a postgres database")
+	}
+
+	local := endpoint.Host == p.admin.Host && endpoint.Port == p.admin.Port
+	return endpoint, local, nil
+}
+
+// sourceSize returns the size of the source database in bytes
+func (p *PostgresBrancher) sourceSize(ctx context.Context, source *DatabaseEndpoint) (int64, error) {
+	db, err := p.connect(ctx, source)
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+
+	var size int64
+	if err := db.QueryRowContext(ctx, "SELECT pg_database_size(current_database())").Scan(&size); err != nil {
+		return 0, fmt.Errorf("failed to get size of %s: %w", source.Database, err)
+	}
+	return size, nil
+}
+
+// dump copies the source into the target database with pg_dump and pg_restore,
+// creating every object as the preview's role
+func (p *PostgresBrancher) dump(ctx context.Context, source *DatabaseEndpoint, target string, schemaOnly bool) error {
+	dumpArgs := []string{"--format=custom", "--no-owner", "--no-acl"}
+	if schemaOnly {
+		dumpArgs = append(dumpArgs, "--schema-only")
+	}
+	dumpCmd := libpqCommand(ctx, "pg_dump", source, dumpArgs...)
+
+	restoreCmd := libpqCommand(ctx, "pg_restore", p.endpointFor(target, p.admin.User, p.admin.Password),
+		"--no-owner", "--no-acl", "--exit-on-error", "--role="+target)
+
+	pipe, err := dumpCmd.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("failed to connect pg_dump to pg_restore: %w", err)
+	}
+	restoreCmd.Stdin = pipe
+
+	var dumpErr, restoreErr bytes.Buffer
+	dumpCmd.Stderr = &dumpErr
+	restoreCmd.Stderr = &restoreErr
+
+	if err := restoreCmd.Start(); err != nil {
+		return fmt.Errorf("failed to start pg_restore: %w", err)
+	}
+	if err := dumpCmd.Run(); err != nil {
+		restoreCmd.Wait()
+		return fmt.Errorf("pg_dump failed: %w: %s", err, truncateLog(dumpErr.String(), maxLogTailBytes))
+	}
+	if err := restoreCmd.Wait(); err != nil {
+		return fmt.Errorf("pg_restore failed: %w: %s", err, truncateLog(restoreErr.String(), maxLogTailBytes))
+	}
+
+	return nil
+}
+
+// reassignOwnership hands the schemas, tables, views and sequences of a
+// database cloned from a template to the preview's role, so its migrations
+// can alter them
+func (p *PostgresBrancher) reassignOwnership(ctx context.Context, database string) error {
+	db, err := p.connect(ctx, p.endpointFor(database, p.admin.User, p.admin.Password))
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	owner := pq.QuoteIdentifier(database)
+	statements := []string{}
+
+	schemas, err := db.QueryContext(ctx, `SELECT nspname FROM pg_namespace
+		WHERE nspname NOT LIKE 'pg\_%' AND nspname <> 'information_schema'`)
+	if err != nil {
+		return fmt.Errorf("failed to list schemas of %s: %w", database, err)
+	}
+	for schemas.Next() {
+		var schema string
+		if err := schemas.Scan(&schema); err != nil {
+			schemas.Close()
+			return fmt.Errorf("failed to read schema: %w", err)
+		}
+		statements = append(statements, fmt.Sprintf("ALTER SCHEMA %s OWNER TO %s", pq.QuoteIdentifier(schema), owner))
+	}
+	schemas.Close()
+
+	// Sequences backing serial and identity columns follow their table
+	relations, err := db.QueryContext(ctx, `SELECT n.nspname, c.relname, c.relkind FROM pg_class c
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE n.nspname NOT LIKE 'pg\_%' AND n.nspname <> 'information_schema'
+		AND (c.relkind IN ('r', 'p', 'v', 'm', 'f') OR (c.relkind = 'S' AND NOT EXISTS (
+			SELECT 1 FROM pg_depend d
+			WHERE d.classid = 'pg_class'::regclass AND d.objid = c.oid AND d.deptype IN ('a', 'i'))))`)
+	if err != nil {
+		return fmt.Errorf("failed to list relations of %s: %w", database, err)
+	}
+	kinds := map[string]string{
+		"r": "TABLE",
+		"p": "TABLE",
+		"f": "FOREIGN TABLE",
+		"v": "VIEW",
+		"m": "MATERIALIZED VIEW",
+		"S": "SEQUENCE",
+	}
+	for relations.Next() {
+		var schema, name, kind string
+		if err := relations.Scan(&schema, &name, &kind); err != nil {
+			relations.Close()
+			return fmt.Errorf("failed to read relation: %w", err)
+		}
+		statements = append(statements, fmt.Sprintf("ALTER %s %s.%s OWNER TO %s",
+			kinds[kind], pq.QuoteIdentifier(schema), pq.QuoteIdentifier(name), owner))
+	}
+	relations.Close()
+
+	for _, statement := range statements {
+		if _, err := db.ExecContext(ctx, statement); err != nil {
+			return fmt.Errorf("failed to reassign ownership in %s: %w", database, err)
+		}
+	}
+
+	return nil
+}
+
+// endpointFor returns the admin server's endpoint for another database and user
+func (p *PostgresBrancher) endpointFor(database, user, password string) *DatabaseEndpoint {
+	endpoint := *p.admin
+	endpoint.Database = database
+	endpoint.User = user
+	endpoint.Password = password
+	return &endpoint
+}
+
+func (p *PostgresBrancher) connect(ctx context.Context, endpoint *DatabaseEndpoint) (*sql.DB, error) {
+	db, err := sql.Open("postgres", endpoint.DriverURL())
+	if err != nil {
+		return nil, fmt.Errorf("failed to open connection to %s: %w", endpoint.Host, err)
+	}
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to connect to %s/%s: %w", endpoint.Host, endpoint.Database, err)
+	}
+	return db, nil
+}
+
+// libpqCommand runs a Postgres client tool against an endpoint, passing the
+// password through the environment rather than the command line
+func libpqCommand(ctx context.Context, name string, endpoint *DatabaseEndpoint, args ...string) *exec.Cmd {
+	withoutPassword := *endpoint
+	withoutPassword.Password = ""
+
+	cmd := exec.CommandContext(ctx, name, append(args, "--dbname="+withoutPassword.DriverURL())...)
+	cmd.Env = append(os.Environ(), "PGPASSWORD="+endpoint.Password)
+	return cmd
+}
+
+// checkPreviewDatabaseName guards against branching or dropping databases
+// that were not created for a preview
+func checkPreviewDatabaseName(name string) error {
+	if !strings.HasPrefix(name, "preview_") || invalidIdentifierChars.MatchString(name) {
+		return fmt.Errorf("refusing to manage database %q: not a preview database", name)
+	}
+	return nil
+}
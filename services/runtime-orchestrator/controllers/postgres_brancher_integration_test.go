@@ -0,0 +1,336 @@
+//go:build integration
+
+package controllers
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/lib/pq"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// The integration tests run against a throwaway Postgres container:
+//
+//	go test -tags integration -run PostgresBrancher ./controllers/
+//
+// POSTGRES_ADMIN_URL points them at an existing server instead. The dump
+// tests need pg_dump and pg_restore on the PATH.
+
+// startPostgres returns an admin URL for a fresh Postgres server
+func startPostgres(t *testing.T) string {
+	t.Helper()
+
+	if url := os.Getenv("POSTGRES_ADMIN_URL"); url != "" {
+		return url
+	}
+	if _, err := exec.LookPath("docker"); err != nil {
+		t.Skip("docker is not available and POSTGRES_ADMIN_URL is not set")
+	}
+
+	out, err := exec.Command("docker", "run", "-d", "--rm",
+		"-e", "POSTGRES_PASSWORD=admin",
+		"-p", "127.0.0.1::5432",
+		"postgres:16-alpine").Output()
+	if err != nil {
+		t.Fatalf("failed to start postgres container: %v", err)
+	}
+	container := strings.TrimSpace(string(out))
+	t.Cleanup(func() {
+		exec.Command("docker", "rm", "-f", container).Run()
+	})
+
+	out, err = exec.Command("docker", "port", container, "5432/tcp").Output()
+	if err != nil {
+		t.Fatalf("failed to get postgres port: %v", err)
+	}
+	address := strings.TrimSpace(strings.Split(string(out), "\n")[0])
+	url := fmt.Sprintf("postgres://postgres:admin@%s/postgres?sslmode=disable", address)
+
+	// The server restarts once after initdb, so wait for a query to succeed
+	deadline := time.Now().Add(60 * time.Second)
+	for {
+		db, err := sql.Open("postgres", url)
+		if err == nil {
+			err = db.Ping()
+			db.Close()
+		}
+		if err == nil {
+			return url
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("postgres did not become ready: %v", err)
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+}
+
+// requireTools skips dump tests when the Postgres client tools are missing
+func requireTools(t *testing.T) {
+	t.Helper()
+	for _, tool := range []string{"pg_dump", "pg_restore"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			t.Skipf("%s is not available", tool)
+		}
+	}
+}
+
+func openDatabase(t *testing.T, url string) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("postgres", url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Ping(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// createSource creates a source database holding one table with rows
+func createSource(t *testing.T, brancher *PostgresBrancher, admin *sql.DB, name string) {
+	t.Helper()
+	if _, err := admin.Exec("CREATE DATABASE " + pq.QuoteIdentifier(name)); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		admin.Exec("DROP DATABASE IF EXISTS " + pq.QuoteIdentifier(name) + " WITH (FORCE)")
+	})
+
+	source := openDatabase(t, brancher.endpointFor(name, brancher.admin.User, brancher.admin.Password).DriverURL())
+	for _, statement := range []string{
+		"CREATE TABLE customers (id serial PRIMARY KEY, email text NOT NULL)",
+		"INSERT INTO customers (email) VALUES ('a@example.com'), ('b@example.com')",
+		"CREATE VIEW customer_emails AS SELECT email FROM customers",
+	} {
+		if _, err := source.Exec(statement); err != nil {
+			t.Fatal(err)
+		}
+	}
+	source.Close()
+}
+
+func countCustomers(t *testing.T, url string) int {
+	t.Helper()
+	var count int
+	if err := openDatabase(t, url).QueryRow("SELECT count(*) FROM customers").Scan(&count); err != nil {
+		t.Fatalf("failed to query the branch: %v", err)
+	}
+	return count
+}
+
+// assertOwnedByBranch checks that the preview's role can alter the cloned schema
+func assertOwnedByBranch(t *testing.T, branch *DatabaseBranch) {
+	t.Helper()
+	db := openDatabase(t, branch.URL)
+	if _, err := db.Exec("ALTER TABLE customers ADD COLUMN name text"); err != nil {
+		t.Errorf("preview role cannot alter cloned tables: %v", err)
+	}
+	if _, err := db.Exec("INSERT INTO customers (email) VALUES ('c@example.com')"); err != nil {
+		t.Errorf("preview role cannot use cloned sequences: %v", err)
+	}
+}
+
+func newTestBrancher(t *testing.T) (*PostgresBrancher, *sql.DB) {
+	t.Helper()
+	url := startPostgres(t)
+	brancher, err := NewPostgresBrancher(url, logr.Discard())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return brancher, openDatabase(t, url)
+}
+
+func TestPostgresBrancherTemplateClone(t *testing.T) {
+	ctx := context.Background()
+	brancher, admin := newTestBrancher(t)
+	createSource(t, brancher, admin, "shop_template")
+
+	branch, err := brancher.Branch(ctx, BranchRequest{Name: "preview_template_clone", Source: "shop_template"})
+	if err != nil {
+		t.Fatalf("Branch: %v", err)
+	}
+	t.Cleanup(func() { brancher.Delete(ctx, branch.Name) })
+
+	if branch.Strategy != BranchStrategyTemplate {
+		t.Errorf("strategy = %q, want %q", branch.Strategy, BranchStrategyTemplate)
+	}
+	if branch.SourceSize <= 0 {
+		t.Errorf("source size = %d, want it measured", branch.SourceSize)
+	}
+	if got := countCustomers(t, branch.URL); got != 2 {
+		t.Errorf("branch has %d customers, want 2", got)
+	}
+	assertOwnedByBranch(t, branch)
+
+	// Branching again rotates the password and keeps the data
+	again, err := brancher.Branch(ctx, BranchRequest{Name: "preview_template_clone", Source: "shop_template"})
+	if err != nil {
+		t.Fatalf("second Branch: %v", err)
+	}
+	if again.Password == branch.Password {
+		t.Error("branching an existing database did not rotate the password")
+	}
+	if got := countCustomers(t, again.URL); got != 3 {
+		t.Errorf("branch has %d customers after rebranching, want 3", got)
+	}
+}
+
+func TestPostgresBrancherDumpFallback(t *testing.T) {
+	requireTools(t)
+	ctx := context.Background()
+	brancher, admin := newTestBrancher(t)
+	createSource(t, brancher, admin, "shop_busy")
+
+	// An open session makes the source unusable as a template
+	busy := openDatabase(t, brancher.endpointFor("shop_busy", brancher.admin.User, brancher.admin.Password).DriverURL())
+	if _, err := busy.Exec("SELECT 1"); err != nil {
+		t.Fatal(err)
+	}
+
+	branch, err := brancher.Branch(ctx, BranchRequest{Name: "preview_dump_fallback", Source: "shop_busy"})
+	if err != nil {
+		t.Fatalf("Branch: %v", err)
+	}
+	t.Cleanup(func() { brancher.Delete(ctx, branch.Name) })
+
+	if branch.Strategy != BranchStrategyDump {
+		t.Errorf("strategy = %q, want %q", branch.Strategy, BranchStrategyDump)
+	}
+	if got := countCustomers(t, branch.URL); got != 2 {
+		t.Errorf("branch has %d customers, want 2", got)
+	}
+	assertOwnedByBranch(t, branch)
+}
+
+func TestPostgresBrancherTemplateStrategyDoesNotFallBack(t *testing.T) {
+	ctx := context.Background()
+	brancher, admin := newTestBrancher(t)
+	createSource(t, brancher, admin, "shop_pinned")
+
+	busy := openDatabase(t, brancher.endpointFor("shop_pinned", brancher.admin.User, brancher.admin.Password).DriverURL())
+	if _, err := busy.Exec("SELECT 1"); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := brancher.Branch(ctx, BranchRequest{Name: "preview_pinned", Source: "shop_pinned", Strategy: BranchStrategyTemplate})
+	if err == nil {
+		brancher.Delete(ctx, "preview_pinned")
+		t.Fatal("expected the template strategy to fail on a busy source")
+	}
+
+	// The failed attempt leaves no database behind
+	var exists bool
+	if err := admin.QueryRow("SELECT EXISTS (SELECT 1 FROM pg_database WHERE datname = 'preview_pinned')").Scan(&exists); err != nil {
+		t.Fatal(err)
+	}
+	if exists {
+		t.Error("failed branch left its database behind")
+	}
+	brancher.Delete(ctx, "preview_pinned")
+}
+
+func TestPostgresBrancherMaxSizeSchemaOnly(t *testing.T) {
+	requireTools(t)
+	ctx := context.Background()
+	brancher, admin := newTestBrancher(t)
+	createSource(t, brancher, admin, "shop_large")
+
+	branch, err := brancher.Branch(ctx, BranchRequest{
+		Name:    "preview_schema_only",
+		Source:  "shop_large",
+		MaxSize: resource.MustParse("1Ki"),
+	})
+	if err != nil {
+		t.Fatalf("Branch: %v", err)
+	}
+	t.Cleanup(func() { brancher.Delete(ctx, branch.Name) })
+
+	if branch.Strategy != BranchStrategySchemaOnly {
+		t.Errorf("strategy = %q, want %q", branch.Strategy, BranchStrategySchemaOnly)
+	}
+	if got := countCustomers(t, branch.URL); got != 0 {
+		t.Errorf("schema-only branch has %d customers, want 0", got)
+	}
+	assertOwnedByBranch(t, branch)
+}
+
+func TestPostgresBrancherEmptyAndDelete(t *testing.T) {
+	ctx := context.Background()
+	brancher, admin := newTestBrancher(t)
+
+	branch, err := brancher.Branch(ctx, BranchRequest{Name: "preview_empty"})
+	if err != nil {
+		t.Fatalf("Branch: %v", err)
+	}
+	if branch.Strategy != BranchStrategyEmpty {
+		t.Errorf("strategy = %q, want %q", branch.Strategy, BranchStrategyEmpty)
+	}
+
+	// Databases the brancher did not create are never listed, even with a preview name
+	if _, err := admin.Exec("CREATE DATABASE preview_unmarked"); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { admin.Exec("DROP DATABASE IF EXISTS preview_unmarked") })
+
+	databases, err := brancher.List(ctx)
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	listed, ok := findDatabase(databases, "preview_empty")
+	if !ok {
+		t.Errorf("List() = %v, want it to include preview_empty", databases)
+	} else if time.Since(listed.CreatedAt) > time.Minute {
+		t.Errorf("preview_empty was created at %s, want about now", listed.CreatedAt)
+	}
+	if _, ok := findDatabase(databases, "preview_unmarked"); ok {
+		t.Errorf("List() = %v, want it to leave out the unmarked database", databases)
+	}
+
+	// A session on the branch must not keep it from being dropped
+	open := openDatabase(t, branch.URL)
+	if _, err := open.Exec("SELECT 1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := brancher.Delete(ctx, branch.Name); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	var databases, roles int
+	if err := admin.QueryRow("SELECT count(*) FROM pg_database WHERE datname = 'preview_empty'").Scan(&databases); err != nil {
+		t.Fatal(err)
+	}
+	if err := admin.QueryRow("SELECT count(*) FROM pg_roles WHERE rolname = 'preview_empty'").Scan(&roles); err != nil {
+		t.Fatal(err)
+	}
+	if databases != 0 || roles != 0 {
+		t.Errorf("Delete left %d databases and %d roles behind", databases, roles)
+	}
+
+	// Deleting again is a no-op
+	if err := brancher.Delete(ctx, branch.Name); err != nil {
+		t.Errorf("second Delete: %v", err)
+	}
+
+	// Databases that are not previews are refused
+	if err := brancher.Delete(ctx, "postgres"); err == nil {
+		t.Error("Delete accepted a database that is not a preview")
+	}
+}
+
+func findDatabase(databases []PreviewDatabase, name string) (PreviewDatabase, bool) {
+	for _, database := range databases {
+		if database.Name == name {
+			return database, true
+		}
+	}
+	return PreviewDatabase{}, false
+}
@@ -0,0 +1,211 @@
+package controllers
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Ways a preview URL can be protected
+const (
+	AccessModeNone        = "none"
+	AccessModeBasicAuth   = "basic-auth"
+	AccessModeIPAllowlist = "ip-allowlist"
+	AccessModeOAuth2      = "oauth2"
+)
+
+// previewBasicAuthSecret holds the generated basic auth credentials of a preview
+const previewBasicAuthSecret = "preview-basic-auth"
+
+// Ingress annotations managed for access protection
+var previewAccessAnnotations = []string{
+	"nginx.ingress.kubernetes.io/auth-type",
+	"nginx.ingress.kubernetes.io/auth-secret",
+	"nginx.ingress.kubernetes.io/auth-realm",
+	"nginx.ingress.kubernetes.io/whitelist-source-range",
+	"nginx.ingress.kubernetes.io/auth-url",
+	"nginx.ingress.kubernetes.io/auth-signin",
+	"nginx.ingress.kubernetes.io/auth-response-headers",
+}
+
+// getPreviewOAuth2ProxyURL returns the oauth2-proxy shared by all previews
+func getPreviewOAuth2ProxyURL() string {
+	proxyURL := os.Getenv("PREVIEW_OAUTH2_PROXY_URL")
+	if proxyURL == "" {
+		proxyURL = "https://auth.preview.cygni.app"
+	}
+	return strings.TrimSuffix(proxyURL, "/")
+}
+
+// previewAccessMode returns the protection mode of a preview, defaulting to
+// PREVIEW_ACCESS_MODE and then to none
+func previewAccessMode(preview *PreviewEnvironment) string {
+	if preview.Spec.Access != nil && preview.Spec.Access.Mode != "" {
+		return preview.Spec.Access.Mode
+	}
+	if mode := os.Getenv("PREVIEW_ACCESS_MODE"); mode != "" {
+		return mode
+	}
+	return AccessModeNone
+}
+
+// previewAccessAnnotationValues returns the ingress annotations protecting the preview
+func (r *PreviewEnvironmentReconciler) previewAccessAnnotationValues(ctx context.Context, preview *PreviewEnvironment) (map[string]string, error) {
+	access := preview.Spec.Access
+	if access == nil {
+		access = &PreviewAccessSpec{}
+	}
+
+	switch mode := previewAccessMode(preview); mode {
+	case AccessModeNone:
+		return map[string]string{}, nil
+
+	case AccessModeBasicAuth:
+		if err := r.ensureBasicAuthSecret(ctx, preview); err != nil {
+			return nil, err
+		}
+		return map[string]string{
+			"nginx.ingress.kubernetes.io/auth-type":   "basic",
+			"nginx.ingress.kubernetes.io/auth-secret": previewBasicAuthSecret,
+			"nginx.ingress.kubernetes.io/auth-realm":  fmt.Sprintf("Preview of PR #%d", preview.Spec.PullRequest),
+		}, nil
+
+	case AccessModeIPAllowlist:
+		if len(access.AllowedCIDRs) == 0 {
+			return nil, fmt.Errorf("access mode %s requires allowedCidrs", mode)
+		}
+		for _, cidr := range access.AllowedCIDRs {
+			if _, _, err := net.ParseCIDR(cidr); err != nil {
+				return nil, fmt.Errorf("invalid allowed CIDR %q: %w", cidr, err)
+			}
+		}
+		return map[string]string{
+			"nginx.ingress.kubernetes.io/whitelist-source-range": strings.Join(access.AllowedCIDRs, ","),
+		}, nil
+
+	case AccessModeOAuth2:
+		if access.OAuth2 == nil || access.OAuth2.Organization == "" {
+			return nil, fmt.Errorf("access mode %s requires an organization", mode)
+		}
+
+		// oauth2-proxy reports GitHub memberships as "org" and "org:team" groups
+		groups := []string{}
+		for _, team := range access.OAuth2.Teams {
+			groups = append(groups, fmt.Sprintf("%s:%s", access.OAuth2.Organization, team))
+		}
+		if len(groups) == 0 {
+			groups = append(groups, access.OAuth2.Organization)
+		}
+
+		proxyURL := getPreviewOAuth2ProxyURL()
+		query := url.Values{"allowed_groups": []string{strings.Join(groups, ",")}}
+		return map[string]string{
+			"nginx.ingress.kubernetes.io/auth-url":              fmt.Sprintf("%s/oauth2/auth?%s", proxyURL, query.Encode()),
+			"nginx.ingress.kubernetes.io/auth-signin":           fmt.Sprintf("%s/oauth2/start?rd=$scheme://$host$escaped_request_uri", proxyURL),
+			"nginx.ingress.kubernetes.io/auth-response-headers": "X-Auth-Request-User,X-Auth-Request-Email",
+		}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported access mode %q", previewAccessMode(preview))
+}
+
+// protectPreviewIngresses applies the access annotations to every Ingress in
+// the preview namespace. The services' own Ingresses are only created with
+// them, so changes to the access mode are applied here.
+func (r *PreviewEnvironmentReconciler) protectPreviewIngresses(ctx context.Context, preview *PreviewEnvironment, annotations map[string]string) error {
+	ingresses := &networkingv1.IngressList{}
+	if err := r.List(ctx, ingresses, client.InNamespace(preview.Status.Namespace)); err != nil {
+		return fmt.Errorf("failed to list preview ingresses: %w", err)
+	}
+
+	for i := range ingresses.Items {
+		ingress := &ingresses.Items[i]
+
+		changed := false
+		for _, key := range previewAccessAnnotations {
+			if _, ok := annotations[key]; !ok {
+				if _, ok := ingress.Annotations[key]; ok {
+					delete(ingress.Annotations, key)
+					changed = true
+				}
+			}
+		}
+		for key, value := range annotations {
+			if ingress.Annotations[key] != value {
+				if ingress.Annotations == nil {
+					ingress.Annotations = map[string]string{}
+				}
+				ingress.Annotations[key] = value
+				changed = true
+			}
+		}
+		if !changed {
+			continue
+		}
+
+		if err := r.Update(ctx, ingress); err != nil {
+			return fmt.Errorf("failed to protect ingress %s: %w", ingress.Name, err)
+		}
+		r.Log.Info("Applied access protection to ingress", "preview", preview.Name, "ingress", ingress.Name)
+	}
+
+	return nil
+}
+
+// ensureBasicAuthSecret generates the preview's credentials once. The Secret
+// holds the htpasswd entry read by the ingress controller next to the plain
+// credentials for developers.
+func (r *PreviewEnvironmentReconciler) ensureBasicAuthSecret(ctx context.Context, preview *PreviewEnvironment) error {
+	existing := &corev1.Secret{}
+	err := r.Get(ctx, types.NamespacedName{
+		Name:      previewBasicAuthSecret,
+		Namespace: preview.Status.Namespace,
+	}, existing)
+	if err == nil {
+		return nil
+	}
+	if !errors.IsNotFound(err) {
+		return fmt.Errorf("failed to get basic auth secret: %w", err)
+	}
+
+	username := "preview"
+	if preview.Spec.Access != nil && preview.Spec.Access.Username != "" {
+		username = preview.Spec.Access.Username
+	}
+	password, err := generatePassword()
+	if err != nil {
+		return err
+	}
+
+	// ingress-nginx accepts SHA1 htpasswd entries
+	digest := sha1.Sum([]byte(password))
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      previewBasicAuthSecret,
+			Namespace: preview.Status.Namespace,
+		},
+		Data: map[string][]byte{
+			"auth":     []byte(fmt.Sprintf("%s:{SHA}%s", username, base64.StdEncoding.EncodeToString(digest[:]))),
+			"username": []byte(username),
+			"password": []byte(password),
+		},
+	}
+	if err := r.Create(ctx, secret); err != nil && !errors.IsAlreadyExists(err) {
+		return fmt.Errorf("failed to create basic auth secret: %w", err)
+	}
+
+	r.Log.Info("Generated basic auth credentials", "preview", preview.Name, "secret", previewBasicAuthSecret)
+	return nil
+}
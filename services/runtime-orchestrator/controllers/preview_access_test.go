@@ -0,0 +1,207 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	cloudxv1 "github.com/cygni/runtime-orchestrator/api/v1"
+)
+
+func newTestPreviewReconciler(t *testing.T, objects ...client.Object) *PreviewEnvironmentReconciler {
+	t.Helper()
+
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := cloudxv1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	scheme.AddKnownTypes(cloudxv1.GroupVersion, &PreviewEnvironment{}, &PreviewEnvironmentList{})
+
+	return &PreviewEnvironmentReconciler{
+		Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(objects...).Build(),
+		Log:    logr.Discard(),
+		Scheme: scheme,
+	}
+}
+
+func baseService(name string, port int32) *cloudxv1.CloudExpressService {
+	return &cloudxv1.CloudExpressService{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "cygni-staging"},
+		Spec: cloudxv1.CloudExpressServiceSpec{
+			Image: "registry.example.com/shop/" + name + ":1.0.0",
+			Ports: []int32{port},
+		},
+	}
+}
+
+func testPreview(access *PreviewAccessSpec) *PreviewEnvironment {
+	return &PreviewEnvironment{
+		ObjectMeta: metav1.ObjectMeta{Name: "shop-pr-7", Namespace: "previews"},
+		Spec: PreviewEnvironmentSpec{
+			PullRequest:     7,
+			ProjectID:       "shop",
+			BaseEnvironment: "staging",
+			Access:          access,
+		},
+		Status: PreviewEnvironmentStatus{Namespace: "shop-pr-7"},
+	}
+}
+
+// createServiceIngresses creates the Ingresses the CloudExpressService
+// controller creates for the preview's services
+func createServiceIngresses(t *testing.T, r *PreviewEnvironmentReconciler, services []cloudxv1.CloudExpressService) {
+	t.Helper()
+	cxsReconciler := &CloudExpressServiceReconciler{}
+	for i := range services {
+		if err := r.Create(context.Background(), cxsReconciler.constructIngress(&services[i])); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// assertIngressesProtected checks every Ingress in the preview namespace
+// against the annotations of the access mode
+func assertIngressesProtected(t *testing.T, r *PreviewEnvironmentReconciler, want map[string]string) {
+	t.Helper()
+
+	ingresses := &networkingv1.IngressList{}
+	if err := r.List(context.Background(), ingresses, client.InNamespace("shop-pr-7")); err != nil {
+		t.Fatal(err)
+	}
+	if len(ingresses.Items) == 0 {
+		t.Fatal("no ingresses in the preview namespace")
+	}
+
+	for _, ingress := range ingresses.Items {
+		for _, key := range previewAccessAnnotations {
+			got, ok := ingress.Annotations[key]
+			if value, wanted := want[key]; wanted && got != value {
+				t.Errorf("ingress %s (%s): %s = %q, want %q", ingress.Name, ingress.Spec.Rules[0].Host, key, got, value)
+			}
+			if _, wanted := want[key]; !wanted && ok {
+				t.Errorf("ingress %s (%s): stale annotation %s = %q", ingress.Name, ingress.Spec.Rules[0].Host, key, got)
+			}
+		}
+	}
+}
+
+func TestPreviewServiceIngressesAreProtected(t *testing.T) {
+	ctx := context.Background()
+	r := newTestPreviewReconciler(t, baseService("web", 3000), baseService("api", 8080))
+	preview := testPreview(&PreviewAccessSpec{Mode: AccessModeBasicAuth})
+
+	services, err := r.deployServices(ctx, preview)
+	if err != nil {
+		t.Fatalf("deployServices: %v", err)
+	}
+	createServiceIngresses(t, r, services)
+
+	// The services' Ingresses are protected from the moment they are created
+	want := map[string]string{
+		"nginx.ingress.kubernetes.io/auth-type":   "basic",
+		"nginx.ingress.kubernetes.io/auth-secret": previewBasicAuthSecret,
+		"nginx.ingress.kubernetes.io/auth-realm":  "Preview of PR #7",
+	}
+	assertIngressesProtected(t, r, want)
+
+	// The Secret they reference exists next to them
+	secret := &corev1.Secret{}
+	if err := r.Get(ctx, types.NamespacedName{Name: previewBasicAuthSecret, Namespace: "shop-pr-7"}, secret); err != nil {
+		t.Fatalf("basic auth secret: %v", err)
+	}
+	if len(secret.Data["auth"]) == 0 {
+		t.Error("basic auth secret has no htpasswd entry")
+	}
+}
+
+func TestProtectPreviewIngressesFollowsAccessMode(t *testing.T) {
+	ctx := context.Background()
+
+	// Ingresses created before the preview had access protection
+	unprotected := &networkingv1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{Name: "worker", Namespace: "shop-pr-7"},
+		Spec: networkingv1.IngressSpec{
+			Rules: []networkingv1.IngressRule{{Host: "worker--pr-7--shop.preview.cygni.app"}},
+		},
+	}
+	r := newTestPreviewReconciler(t, baseService("web", 3000), baseService("api", 8080), unprotected)
+
+	preview := testPreview(nil)
+	services, err := r.deployServices(ctx, preview)
+	if err != nil {
+		t.Fatalf("deployServices: %v", err)
+	}
+	createServiceIngresses(t, r, services)
+
+	for _, access := range []*PreviewAccessSpec{
+		{Mode: AccessModeBasicAuth},
+		{Mode: AccessModeIPAllowlist, AllowedCIDRs: []string{"203.0.113.0/24"}},
+		{Mode: AccessModeOAuth2, OAuth2: &PreviewOAuth2Spec{Organization: "acme"}},
+	} {
+		preview.Spec.Access = access
+
+		annotations, err := r.previewAccessAnnotationValues(ctx, preview)
+		if err != nil {
+			t.Fatalf("%s: %v", access.Mode, err)
+		}
+		if err := r.protectPreviewIngresses(ctx, preview, annotations); err != nil {
+			t.Fatalf("%s: protectPreviewIngresses: %v", access.Mode, err)
+		}
+		if len(annotations) == 0 {
+			t.Fatalf("%s: no access annotations", access.Mode)
+		}
+		assertIngressesProtected(t, r, annotations)
+	}
+}
+
+func TestConstructIngressPassesThroughAccessAnnotations(t *testing.T) {
+	cxs := baseService("api", 8080)
+	cxs.Annotations = map[string]string{
+		"nginx.ingress.kubernetes.io/auth-type":              "basic",
+		"nginx.ingress.kubernetes.io/auth-secret":            previewBasicAuthSecret,
+		"nginx.ingress.kubernetes.io/configuration-snippet":  "more_set_headers \"X-Leak: 1\";",
+		"nginx.ingress.kubernetes.io/server-snippet":         "location /admin { return 200; }",
+		"nginx.ingress.kubernetes.io/mirror-target":          "http://attacker.example.com",
+		"nginx.ingress.kubernetes.io/permanent-redirect":     "https://attacker.example.com",
+		"nginx.ingress.kubernetes.io/whitelist-source-range": "203.0.113.0/24",
+		"cygni.io/host": "api--pr-7--shop.preview.cygni.app",
+	}
+
+	ingress := (&CloudExpressServiceReconciler{}).constructIngress(cxs)
+	if ingress.Annotations["nginx.ingress.kubernetes.io/auth-type"] != "basic" ||
+		ingress.Annotations["nginx.ingress.kubernetes.io/auth-secret"] != previewBasicAuthSecret {
+		t.Errorf("access annotations were not passed through: %v", ingress.Annotations)
+	}
+	if ingress.Annotations["nginx.ingress.kubernetes.io/whitelist-source-range"] != "203.0.113.0/24" {
+		t.Errorf("allowlist was not passed through: %v", ingress.Annotations)
+	}
+	for _, key := range []string{
+		"nginx.ingress.kubernetes.io/configuration-snippet",
+		"nginx.ingress.kubernetes.io/server-snippet",
+		"nginx.ingress.kubernetes.io/mirror-target",
+		"nginx.ingress.kubernetes.io/permanent-redirect",
+		"cygni.io/host",
+	} {
+		if _, ok := ingress.Annotations[key]; ok {
+			t.Errorf("annotation %s was passed through: %v", key, ingress.Annotations)
+		}
+	}
+	if ingress.Annotations["nginx.ingress.kubernetes.io/proxy-body-size"] != "100m" {
+		t.Errorf("default annotations were dropped: %v", ingress.Annotations)
+	}
+	if ingress.Spec.Rules[0].Host != "api--pr-7--shop.preview.cygni.app" {
+		t.Errorf("host = %q", ingress.Spec.Rules[0].Host)
+	}
+}
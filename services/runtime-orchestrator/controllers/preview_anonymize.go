@@ -0,0 +1,307 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/lib/pq"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/yaml"
+)
+
+// Anonymization strategies
+const (
+	AnonymizeNull      = "null"
+	AnonymizeFixed     = "fixed"
+	AnonymizeFakeEmail = "fake-email"
+	AnonymizeFakeName  = "fake-name"
+	AnonymizeFakePhone = "fake-phone"
+	AnonymizeHash      = "hash"
+	AnonymizeTruncate  = "truncate"
+)
+
+// anonymizationRulesKey is the ConfigMap key holding anonymization rules
+const anonymizationRulesKey = "rules.yaml"
+
+var fakeFirstNames = []string{"Alex", "Sam", "Robin", "Jamie", "Charlie", "Kim", "Taylor", "Morgan", "Riley", "Jordan"}
+var fakeLastNames = []string{"Andersson", "Berg", "Lindqvist", "Nilsson", "Holm", "Ek", "Dahl", "Lund", "Sjöberg", "Wikström"}
+
+// anonymizationRules returns the preview's rules from the spec and the referenced ConfigMap
+func (r *PreviewEnvironmentReconciler) anonymizationRules(ctx context.Context, preview *PreviewEnvironment) ([]AnonymizationRule, error) {
+	rules := append([]AnonymizationRule{}, preview.Spec.Database.AnonymizationRules...)
+
+	if name := preview.Spec.Database.AnonymizationConfigMap; name != "" {
+		configMap := &corev1.ConfigMap{}
+		if err := r.Get(ctx, types.NamespacedName{
+			Name:      name,
+			Namespace: preview.Namespace,
+		}, configMap); err != nil {
+			return nil, fmt.Errorf("failed to get anonymization rules ConfigMap %s: %w", name, err)
+		}
+
+		fromConfigMap := []AnonymizationRule{}
+		if err := yaml.Unmarshal([]byte(configMap.Data[anonymizationRulesKey]), &fromConfigMap); err != nil {
+			return nil, fmt.Errorf("failed to parse %s in ConfigMap %s: %w", anonymizationRulesKey, name, err)
+		}
+		rules = append(rules, fromConfigMap...)
+	}
+
+	// Fail closed: cloning production data without rules would copy its PII
+	if len(rules) == 0 {
+		return nil, fmt.Errorf("anonymize is set but no anonymization rules are configured")
+	}
+
+	return rules, validateAnonymizationRules(rules)
+}
+
+// validateAnonymizationRules checks rules before any SQL is generated
+func validateAnonymizationRules(rules []AnonymizationRule) error {
+	seen := map[string]bool{}
+	for _, rule := range rules {
+		if rule.Table == "" {
+			return fmt.Errorf("anonymization rule without a table")
+		}
+
+		switch rule.Strategy {
+		case AnonymizeTruncate:
+			continue
+		case AnonymizeNull, AnonymizeFixed, AnonymizeFakeEmail, AnonymizeFakeName, AnonymizeFakePhone, AnonymizeHash:
+		default:
+			return fmt.Errorf("unsupported anonymization strategy %q for %s", rule.Strategy, rule.Table)
+		}
+
+		if rule.Column == "" {
+			return fmt.Errorf("anonymization rule for %s requires a column", rule.Table)
+		}
+
+		target := rule.Table + "." + rule.Column
+		if seen[target] {
+			return fmt.Errorf("conflicting anonymization rules for %s", target)
+		}
+		seen[target] = true
+	}
+
+	return nil
+}
+
+// buildAnonymizationSQL renders the rules as a psql script. Values derived from
+// the original data are salted with the psql variable "salt", so they stay
+// consistent across tables within a run but cannot be reversed.
+func buildAnonymizationSQL(rules []AnonymizationRule) string {
+	truncates := []string{}
+	updates := map[string][]string{}
+	tables := []string{}
+
+	for _, rule := range rules {
+		table := quoteQualifiedIdentifier(rule.Table)
+		if rule.Strategy == AnonymizeTruncate {
+			truncates = append(truncates, table)
+			continue
+		}
+
+		if _, ok := updates[table]; !ok {
+			tables = append(tables, table)
+		}
+		column := pq.QuoteIdentifier(rule.Column)
+		updates[table] = append(updates[table], fmt.Sprintf("%s = %s", column, anonymizedValue(column, rule)))
+	}
+	sort.Strings(truncates)
+	sort.Strings(tables)
+
+	var script strings.Builder
+	script.WriteString("\\set ON_ERROR_STOP on\n")
+	for _, table := range truncates {
+		// CASCADE also empties tables with foreign keys into the truncated one
+		fmt.Fprintf(&script, "TRUNCATE TABLE %s CASCADE;\n", table)
+	}
+	for _, table := range tables {
+		fmt.Fprintf(&script, "UPDATE %s SET %s;\n", table, strings.Join(updates[table], ", "))
+	}
+	return script.String()
+}
+
+// anonymizedValue returns the SQL expression replacing a column's value
+func anonymizedValue(column string, rule AnonymizationRule) string {
+	salted := fmt.Sprintf("%s::text || :'salt'", column)
+	bucket := func(n int, suffix string) string {
+		return fmt.Sprintf("1 + abs(hashtext(%s || '%s')::bigint) %% %d", salted, suffix, n)
+	}
+	keepNull := func(expression string) string {
+		return fmt.Sprintf("CASE WHEN %s IS NULL THEN NULL ELSE %s END", column, expression)
+	}
+
+	switch rule.Strategy {
+	case AnonymizeNull:
+		return "NULL"
+	case AnonymizeFixed:
+		return pq.QuoteLiteral(rule.Value)
+	case AnonymizeFakeEmail:
+		return keepNull(fmt.Sprintf("'user-' || substr(md5(%s), 1, 16) || '@example.com'", salted))
+	case AnonymizeFakeName:
+		return keepNull(fmt.Sprintf("(%s)[%s] || ' ' || (%s)[%s]",
+			sqlTextArray(fakeFirstNames), bucket(len(fakeFirstNames), "first"),
+			sqlTextArray(fakeLastNames), bucket(len(fakeLastNames), "last")))
+	case AnonymizeFakePhone:
+		return keepNull(fmt.Sprintf("'+1555' || lpad((abs(hashtext(%s)::bigint) %% 10000000)::text, 7, '0')", salted))
+	case AnonymizeHash:
+		return keepNull(fmt.Sprintf("md5(%s)", salted))
+	}
+	return column
+}
+
+// quoteQualifiedIdentifier quotes an optionally schema-qualified name
+func quoteQualifiedIdentifier(name string) string {
+	parts := strings.Split(name, ".")
+	for i, part := range parts {
+		parts[i] = pq.QuoteIdentifier(part)
+	}
+	return strings.Join(parts, ".")
+}
+
+func sqlTextArray(values []string) string {
+	quoted := make([]string, len(values))
+	for i, value := range values {
+		quoted[i] = pq.QuoteLiteral(value)
+	}
+	return fmt.Sprintf("ARRAY[%s]", strings.Join(quoted, ", "))
+}
+
+// anonymizeDatabase runs the anonymization rules against the preview's
+// database as a Job. It reports whether the rules have been applied.
+func (r *PreviewEnvironmentReconciler) anonymizeDatabase(ctx context.Context, preview *PreviewEnvironment) (bool, error) {
+	rules, err := r.anonymizationRules(ctx, preview)
+	if err != nil {
+		return false, err
+	}
+
+	script := buildAnonymizationSQL(rules)
+	jobName := fmt.Sprintf("preview-anonymize-%s", shortHash(script))
+	preview.Status.Database.AnonymizationJob = jobName
+
+	configMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      jobName,
+			Namespace: preview.Status.Namespace,
+		},
+	}
+	if _, err := controllerutil.CreateOrUpdate(ctx, r.Client, configMap, func() error {
+		configMap.Data = map[string]string{
+			"anonymize.sql": script,
+		}
+		return nil
+	}); err != nil {
+		return false, fmt.Errorf("failed to store anonymization script: %w", err)
+	}
+
+	job := &batchv1.Job{}
+	err = r.Get(ctx, types.NamespacedName{
+		Name:      jobName,
+		Namespace: preview.Status.Namespace,
+	}, job)
+
+	if err != nil && !errors.IsNotFound(err) {
+		return false, fmt.Errorf("failed to check anonymization job: %w", err)
+	}
+
+	if errors.IsNotFound(err) {
+		salt, err := generatePassword()
+		if err != nil {
+			return false, err
+		}
+
+		job = constructAnonymizationJob(preview, jobName, salt)
+		if err := r.Create(ctx, job); err != nil {
+			return false, fmt.Errorf("failed to create anonymization job: %w", err)
+		}
+		r.Log.Info("Created anonymization job", "preview", preview.Name, "job", jobName)
+		return false, nil
+	}
+
+	finished, succeeded := jobFinished(job)
+	if !finished {
+		return false, nil
+	}
+
+	if !succeeded {
+		logs, logErr := jobLogs(ctx, r.Client, r.KubeClient, job, "anonymize")
+		if logErr != nil {
+			r.Log.Error(logErr, "Failed to capture anonymization logs", "job", jobName)
+		}
+		return false, fmt.Errorf("anonymization job %s failed: %s", jobName, logs)
+	}
+
+	return true, nil
+}
+
+func constructAnonymizationJob(preview *PreviewEnvironment, jobName, salt string) *batchv1.Job {
+	labels := map[string]string{
+		"cygni.io/preview": "true",
+		"cygni.io/type":    "anonymize",
+	}
+
+	return &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      jobName,
+			Namespace: preview.Status.Namespace,
+			Labels:    labels,
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit:          &[]int32{2}[0],
+			ActiveDeadlineSeconds: &[]int64{1800}[0],
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: labels,
+				},
+				Spec: corev1.PodSpec{
+					RestartPolicy: corev1.RestartPolicyNever,
+					Containers: []corev1.Container{
+						{
+							Name:  "anonymize",
+							Image: "postgres:16-alpine",
+							Command: []string{
+								"sh",
+								"-c",
+								`psql "$DATABASE_URL" --single-transaction -v salt="$ANONYMIZE_SALT" -f /scripts/anonymize.sql`,
+							},
+							Env: []corev1.EnvVar{
+								{
+									Name:      "DATABASE_URL",
+									ValueFrom: secretKeyRef(preview.Status.Database.SecretName, "DATABASE_URL"),
+								},
+								{
+									Name:  "ANONYMIZE_SALT",
+									Value: salt,
+								},
+							},
+							VolumeMounts: []corev1.VolumeMount{
+								{
+									Name:      "scripts",
+									MountPath: "/scripts",
+								},
+							},
+						},
+					},
+					Volumes: []corev1.Volume{
+						{
+							Name: "scripts",
+							VolumeSource: corev1.VolumeSource{
+								ConfigMap: &corev1.ConfigMapVolumeSource{
+									LocalObjectReference: corev1.LocalObjectReference{
+										Name: jobName,
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
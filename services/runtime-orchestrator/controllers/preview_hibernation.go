@@ -0,0 +1,278 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/api"
+	promv1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+const (
+	// defaultPreviewIdleAfter is how long a preview may be idle before it is hibernated
+	defaultPreviewIdleAfter = 2 * time.Hour
+
+	// previewActivityInterval is how often an awake preview's activity is checked
+	previewActivityInterval = 5 * time.Minute
+
+	// previewActivityWindow is the range of the activity queries
+	previewActivityWindow = "5m"
+
+	// minPreviewNetworkBytes ignores traffic from probes and metrics scrapes
+	// when activity is derived from pod network counters
+	minPreviewNetworkBytes = 256 * 1024
+
+	// previewActivatorService routes a hibernated preview's traffic to the activator
+	previewActivatorService = "preview-activator"
+)
+
+// getPreviewActivatorHost returns the in-cluster host of the activator
+func getPreviewActivatorHost() string {
+	host := os.Getenv("PREVIEW_ACTIVATOR_HOST")
+	if host == "" {
+		host = "runtime-orchestrator-activator.runtime-orchestrator.svc.cluster.local"
+	}
+	return host
+}
+
+// previewIdleAfter returns how long a preview may be idle before hibernating,
+// or zero if hibernation is disabled
+func previewIdleAfter(preview *PreviewEnvironment) time.Duration {
+	if preview.Spec.Hibernation == nil {
+		return 0
+	}
+	if preview.Spec.Hibernation.IdleAfter.Duration > 0 {
+		return preview.Spec.Hibernation.IdleAfter.Duration
+	}
+	return defaultPreviewIdleAfter
+}
+
+// promAPI returns the Prometheus client used to track preview activity
+func (r *PreviewEnvironmentReconciler) promAPI() (promv1.API, error) {
+	if r.PromAPI != nil {
+		return r.PromAPI, nil
+	}
+
+	promClient, err := api.NewClient(api.Config{Address: getPrometheusURL()})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Prometheus client: %w", err)
+	}
+	r.PromAPI = promv1.NewAPI(promClient)
+	return r.PromAPI, nil
+}
+
+// previewRecentlyActive reports whether the preview served traffic within the
+// activity window. Ingress request metrics are preferred; pod network counters
+// are used when the ingress controller does not export any for the namespace.
+func (r *PreviewEnvironmentReconciler) previewRecentlyActive(ctx context.Context, preview *PreviewEnvironment) (bool, error) {
+	promAPI, err := r.promAPI()
+	if err != nil {
+		return false, err
+	}
+
+	requests, found, err := queryPreviewActivity(ctx, promAPI, fmt.Sprintf(
+		`sum(increase(nginx_ingress_controller_requests{exported_namespace="%s"}[%s]))`,
+		preview.Status.Namespace, previewActivityWindow))
+	if err != nil {
+		return false, fmt.Errorf("failed to query ingress requests: %w", err)
+	}
+	if found {
+		return requests > 0, nil
+	}
+
+	received, found, err := queryPreviewActivity(ctx, promAPI, fmt.Sprintf(
+		`sum(increase(container_network_receive_bytes_total{namespace="%s"}[%s]))`,
+		preview.Status.Namespace, previewActivityWindow))
+	if err != nil {
+		return false, fmt.Errorf("failed to query network counters: %w", err)
+	}
+	return found && received > minPreviewNetworkBytes, nil
+}
+
+// queryPreviewActivity runs an instant query and reports whether it returned a sample
+func queryPreviewActivity(ctx context.Context, promAPI promv1.API, query string) (float64, bool, error) {
+	result, _, err := promAPI.Query(ctx, query, time.Now())
+	if err != nil {
+		return 0, false, err
+	}
+
+	switch v := result.(type) {
+	case model.Vector:
+		if len(v) == 0 {
+			return 0, false, nil
+		}
+		return float64(v[0].Value), true, nil
+	case *model.Scalar:
+		return float64(v.Value), true, nil
+	default:
+		return 0, false, fmt.Errorf("unexpected result type: %T", result)
+	}
+}
+
+// updateHibernation records the preview's activity and hibernates, wakes or
+// deletes it. It reports whether the preview was deleted.
+func (r *PreviewEnvironmentReconciler) updateHibernation(ctx context.Context, preview *PreviewEnvironment) (bool, error) {
+	idleAfter := previewIdleAfter(preview)
+	if idleAfter == 0 {
+		if !preview.Status.Hibernated {
+			return false, nil
+		}
+		// Hibernation was turned off while the preview slept
+		preview.Status.Hibernated = false
+		preview.Status.HibernatedAt = nil
+		return false, r.Status().Update(ctx, preview)
+	}
+
+	changed := false
+
+	active, err := r.previewRecentlyActive(ctx, preview)
+	if err != nil {
+		// Without metrics the preview is neither hibernated nor deleted
+		r.Log.Error(err, "Failed to check preview activity", "preview", preview.Name)
+		return false, nil
+	}
+	if active {
+		preview.Status.LastActivity = metav1.Now()
+		changed = true
+	}
+
+	idle := time.Since(preview.Status.LastActivity.Time)
+
+	if deleteAfter := preview.Spec.Hibernation.DeleteAfter.Duration; deleteAfter > 0 && idle > deleteAfter {
+		r.Log.Info("Preview environment idle, deleting", "preview", preview.Name, "idle", idle.Round(time.Minute))
+		if err := r.Delete(ctx, preview); err != nil {
+			return false, err
+		}
+		return true, nil
+	}
+
+	switch {
+	case !preview.Status.Hibernated && idle > idleAfter:
+		now := metav1.Now()
+		preview.Status.Hibernated = true
+		preview.Status.HibernatedAt = &now
+		changed = true
+		r.Log.Info("Hibernating idle preview", "preview", preview.Name, "idle", idle.Round(time.Minute))
+	case preview.Status.Hibernated && idle < idleAfter:
+		preview.Status.Hibernated = false
+		preview.Status.HibernatedAt = nil
+		changed = true
+		r.Log.Info("Waking preview", "preview", preview.Name)
+	}
+
+	if changed {
+		if err := r.Status().Update(ctx, preview); err != nil {
+			return false, err
+		}
+	}
+	return false, nil
+}
+
+// ensurePreviewActivatorService points a Service in the preview namespace at
+// the activator, so the preview ingress can route to it while hibernated
+func (r *PreviewEnvironmentReconciler) ensurePreviewActivatorService(ctx context.Context, preview *PreviewEnvironment) error {
+	service := &corev1.Service{}
+	service.Name = previewActivatorService
+	service.Namespace = preview.Status.Namespace
+
+	_, err := controllerutil.CreateOrUpdate(ctx, r.Client, service, func() error {
+		service.Spec.Type = corev1.ServiceTypeExternalName
+		service.Spec.ExternalName = getPreviewActivatorHost()
+		service.Spec.Ports = []corev1.ServicePort{
+			{
+				Name: "http",
+				Port: 80,
+			},
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create activator service: %w", err)
+	}
+	return nil
+}
+
+// PreviewActivator receives requests for hibernated previews. It records the
+// request as activity, which wakes the preview, and serves a holding page
+// that reloads until the preview's services are running again.
+type PreviewActivator struct {
+	client client.Client
+	log    logr.Logger
+	addr   string
+}
+
+func NewPreviewActivator(c client.Client, log logr.Logger, addr string) *PreviewActivator {
+	return &PreviewActivator{
+		client: c,
+		log:    log,
+		addr:   addr,
+	}
+}
+
+func (a *PreviewActivator) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	host := req.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	previews := &PreviewEnvironmentList{}
+	if err := a.client.List(req.Context(), previews); err != nil {
+		a.log.Error(err, "Failed to list previews")
+		http.Error(w, "preview unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	var preview *PreviewEnvironment
+	for i := range previews.Items {
+		if strings.EqualFold(previewHost(&previews.Items[i]), host) {
+			preview = &previews.Items[i]
+		}
+	}
+	if preview == nil {
+		http.NotFound(w, req)
+		return
+	}
+
+	if preview.Status.Hibernated {
+		preview.Status.LastActivity = metav1.Now()
+		if err := a.client.Status().Update(req.Context(), preview); err != nil {
+			// A concurrent request has most likely woken the preview already
+			a.log.Info("Failed to record preview activity", "preview", preview.Name, "error", err.Error())
+		} else {
+			a.log.Info("Woke preview on request", "preview", preview.Name)
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Retry-After", "5")
+	w.WriteHeader(http.StatusServiceUnavailable)
+	fmt.Fprintf(w, `<!DOCTYPE html>
+<html>
+<head><meta http-equiv="refresh" content="5"><title>Starting preview</title></head>
+<body><p>Preview for PR #%d of %s is starting, this page reloads automatically.</p></body>
+</html>
+`, preview.Spec.PullRequest, html.EscapeString(preview.Spec.ProjectID))
+}
+
+// Start serves the activator until the context is cancelled, so it can be
+// added to the manager as a Runnable
+func (a *PreviewActivator) Start(ctx context.Context) error {
+	a.log.Info("Starting preview activator", "addr", a.addr)
+	if err := serveHTTP(ctx, a.addr, a); err != nil {
+		return fmt.Errorf("failed to serve preview activator: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,308 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// namespaceNameLabel is set on every namespace by Kubernetes
+const namespaceNameLabel = "kubernetes.io/metadata.name"
+
+// getPreviewIngressNamespace returns the namespace of the ingress controller serving previews
+func getPreviewIngressNamespace() string {
+	namespace := os.Getenv("PREVIEW_INGRESS_NAMESPACE")
+	if namespace == "" {
+		namespace = "ingress-nginx"
+	}
+	return namespace
+}
+
+// getPreviewMonitoringNamespace returns the namespace of the Prometheus scraping previews
+func getPreviewMonitoringNamespace() string {
+	namespace := os.Getenv("PREVIEW_MONITORING_NAMESPACE")
+	if namespace == "" {
+		namespace = "monitoring"
+	}
+	return namespace
+}
+
+// getPreviewEgressCIDRs returns the CIDRs every preview may reach, such as shared external APIs
+func getPreviewEgressCIDRs() []string {
+	cidrs := []string{}
+	for _, cidr := range strings.Split(os.Getenv("PREVIEW_EGRESS_CIDRS"), ",") {
+		if cidr = strings.TrimSpace(cidr); cidr != "" {
+			cidrs = append(cidrs, cidr)
+		}
+	}
+	return cidrs
+}
+
+// namespacePeer selects every pod in a namespace
+func namespacePeer(namespace string) networkingv1.NetworkPolicyPeer {
+	return networkingv1.NetworkPolicyPeer{
+		NamespaceSelector: &metav1.LabelSelector{
+			MatchLabels: map[string]string{
+				namespaceNameLabel: namespace,
+			},
+		},
+	}
+}
+
+// ensureNetworkPolicies isolates the preview namespace: all traffic is denied
+// except within the namespace, from the ingress controller and monitoring, to
+// DNS and to the preview's explicitly allowed dependencies
+func (r *PreviewEnvironmentReconciler) ensureNetworkPolicies(ctx context.Context, preview *PreviewEnvironment) error {
+	dependencies, err := r.previewEgressRules(ctx, preview)
+	if err != nil {
+		return err
+	}
+
+	udp := corev1.ProtocolUDP
+	tcp := corev1.ProtocolTCP
+	dnsPort := intstr.FromInt(53)
+	sameNamespace := networkingv1.NetworkPolicyPeer{
+		PodSelector: &metav1.LabelSelector{},
+	}
+
+	policies := map[string]networkingv1.NetworkPolicySpec{
+		"preview-default-deny": {
+			PolicyTypes: []networkingv1.PolicyType{
+				networkingv1.PolicyTypeIngress,
+				networkingv1.PolicyTypeEgress,
+			},
+		},
+		"preview-allow-ingress": {
+			PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress},
+			Ingress: []networkingv1.NetworkPolicyIngressRule{
+				{
+					From: []networkingv1.NetworkPolicyPeer{
+						sameNamespace,
+						namespacePeer(getPreviewIngressNamespace()),
+						namespacePeer(getPreviewMonitoringNamespace()),
+					},
+				},
+			},
+		},
+		"preview-allow-egress": {
+			PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeEgress},
+			Egress: append([]networkingv1.NetworkPolicyEgressRule{
+				{
+					To: []networkingv1.NetworkPolicyPeer{sameNamespace},
+				},
+				{
+					To: []networkingv1.NetworkPolicyPeer{
+						{
+							NamespaceSelector: &metav1.LabelSelector{
+								MatchLabels: map[string]string{
+									namespaceNameLabel: "kube-system",
+								},
+							},
+							PodSelector: &metav1.LabelSelector{
+								MatchLabels: map[string]string{
+									"k8s-app": "kube-dns",
+								},
+							},
+						},
+					},
+					Ports: []networkingv1.NetworkPolicyPort{
+						{Protocol: &udp, Port: &dnsPort},
+						{Protocol: &tcp, Port: &dnsPort},
+					},
+				},
+			}, dependencies...),
+		},
+	}
+
+	for name, spec := range policies {
+		policy := &networkingv1.NetworkPolicy{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: preview.Status.Namespace,
+			},
+		}
+		spec := spec
+		if _, err := controllerutil.CreateOrUpdate(ctx, r.Client, policy, func() error {
+			if policy.Labels == nil {
+				policy.Labels = map[string]string{}
+			}
+			policy.Labels["cygni.io/preview"] = "true"
+			policy.Spec = spec
+			return nil
+		}); err != nil {
+			return fmt.Errorf("failed to apply network policy %s: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+// previewEgressRules allows the preview to reach its database, the allowlisted
+// namespaces and the allowlisted CIDRs
+func (r *PreviewEnvironmentReconciler) previewEgressRules(ctx context.Context, preview *PreviewEnvironment) ([]networkingv1.NetworkPolicyEgressRule, error) {
+	rules := []networkingv1.NetworkPolicyEgressRule{}
+
+	databaseURL, err := r.previewDatabaseURL(ctx, preview)
+	if err != nil {
+		return nil, err
+	}
+	if databaseURL != "" {
+		rule, err := r.databaseEgressRule(ctx, preview, databaseURL)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+
+	peers := []networkingv1.NetworkPolicyPeer{}
+	cidrs := getPreviewEgressCIDRs()
+	if preview.Spec.Network != nil {
+		for _, namespace := range preview.Spec.Network.AllowedNamespaces {
+			// The base environment is production for the PR's purposes
+			if namespace == baseNamespace(preview) {
+				return nil, fmt.Errorf("previews may not reach their base environment namespace %s", namespace)
+			}
+			peers = append(peers, namespacePeer(namespace))
+		}
+		cidrs = append(cidrs, preview.Spec.Network.EgressCIDRs...)
+	}
+
+	for _, cidr := range cidrs {
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			return nil, fmt.Errorf("invalid egress CIDR %q: %w", cidr, err)
+		}
+		peers = append(peers, networkingv1.NetworkPolicyPeer{
+			IPBlock: &networkingv1.IPBlock{CIDR: cidr},
+		})
+	}
+
+	if len(peers) > 0 {
+		rules = append(rules, networkingv1.NetworkPolicyEgressRule{To: peers})
+	}
+	return rules, nil
+}
+
+// databaseEgressRule allows traffic to the database server of a connection URL.
+// In-cluster services, named as <svc>.<ns>.svc[.cluster.local], <svc>.<ns> or
+// <svc> in the preview's namespace, are matched by namespace; other hosts by
+// their addresses.
+func (r *PreviewEnvironmentReconciler) databaseEgressRule(ctx context.Context, preview *PreviewEnvironment, databaseURL string) (networkingv1.NetworkPolicyEgressRule, error) {
+	rule := networkingv1.NetworkPolicyEgressRule{}
+
+	u, err := url.Parse(databaseURL)
+	if err != nil {
+		return rule, fmt.Errorf("failed to parse database URL: %w", err)
+	}
+
+	port := 5432
+	if p := u.Port(); p != "" {
+		if port, err = strconv.Atoi(p); err != nil {
+			return rule, fmt.Errorf("invalid database port %q", p)
+		}
+	}
+	tcp := corev1.ProtocolTCP
+	target := intstr.FromInt(port)
+	rule.Ports = []networkingv1.NetworkPolicyPort{{Protocol: &tcp, Port: &target}}
+
+	host := strings.TrimSuffix(u.Hostname(), ".")
+	namespace, err := r.serviceNamespace(ctx, preview, host)
+	if err != nil {
+		return rule, err
+	}
+	if namespace != "" {
+		rule.To = []networkingv1.NetworkPolicyPeer{namespacePeer(namespace)}
+		return rule, nil
+	}
+
+	addrs := []string{host}
+	if net.ParseIP(host) == nil {
+		if addrs, err = net.DefaultResolver.LookupHost(ctx, host); err != nil {
+			return rule, fmt.Errorf("failed to resolve database host %s: %w", host, err)
+		}
+	}
+
+	// Policies see traffic after a Service's ClusterIP is translated to pod
+	// IPs, so an ipBlock for a ClusterIP would never match
+	clusterIPs, err := r.serviceClusterIPs(ctx)
+	if err != nil {
+		return rule, err
+	}
+	for _, addr := range addrs {
+		if service, ok := clusterIPs[addr]; ok {
+			return rule, fmt.Errorf("database host %s resolves to the ClusterIP of Service %s; use %s.svc as the host",
+				host, service, service)
+		}
+	}
+
+	for _, addr := range addrs {
+		cidr := addr + "/32"
+		if strings.Contains(addr, ":") {
+			cidr = addr + "/128"
+		}
+		rule.To = append(rule.To, networkingv1.NetworkPolicyPeer{
+			IPBlock: &networkingv1.IPBlock{CIDR: cidr},
+		})
+	}
+	return rule, nil
+}
+
+// serviceNamespace returns the namespace of the in-cluster Service a database
+// host names, or "" for hosts outside the cluster. Two-label and bare names
+// only count as Services when such a Service exists, so external hosts such as
+// db.internal are still resolved.
+func (r *PreviewEnvironmentReconciler) serviceNamespace(ctx context.Context, preview *PreviewEnvironment, host string) (string, error) {
+	if net.ParseIP(host) != nil {
+		return "", nil
+	}
+
+	parts := strings.Split(host, ".")
+	var key types.NamespacedName
+	switch {
+	case len(parts) >= 3 && parts[2] == "svc":
+		return parts[1], nil
+	case len(parts) == 2:
+		key = types.NamespacedName{Name: parts[0], Namespace: parts[1]}
+	case len(parts) == 1:
+		key = types.NamespacedName{Name: parts[0], Namespace: preview.Status.Namespace}
+	default:
+		return "", nil
+	}
+
+	if err := r.Get(ctx, key, &corev1.Service{}); err != nil {
+		if errors.IsNotFound(err) {
+			return "", nil
+		}
+		return "", fmt.Errorf("failed to look up database service %s: %w", host, err)
+	}
+	return key.Namespace, nil
+}
+
+// serviceClusterIPs maps the ClusterIPs of every Service to <name>.<namespace>
+func (r *PreviewEnvironmentReconciler) serviceClusterIPs(ctx context.Context) (map[string]string, error) {
+	services := &corev1.ServiceList{}
+	if err := r.List(ctx, services); err != nil {
+		return nil, fmt.Errorf("failed to list services: %w", err)
+	}
+
+	clusterIPs := map[string]string{}
+	for _, service := range services.Items {
+		for _, ip := range append([]string{service.Spec.ClusterIP}, service.Spec.ClusterIPs...) {
+			if ip != "" && ip != corev1.ClusterIPNone {
+				clusterIPs[ip] = service.Name + "." + service.Namespace
+			}
+		}
+	}
+	return clusterIPs, nil
+}
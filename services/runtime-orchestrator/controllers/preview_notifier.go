@@ -0,0 +1,152 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+const (
+	// previewCommentMarker identifies the preview's comment on a pull request
+	previewCommentMarker = "<!-- cygni-preview -->"
+
+	// previewStatusContext names the commit status of previews
+	previewStatusContext = "cygni/preview"
+)
+
+// PreviewNotifier reports a preview's state on its pull request
+type PreviewNotifier struct {
+	providers map[string]GitProvider
+	log       logr.Logger
+}
+
+func NewPreviewNotifier(providers map[string]GitProvider, log logr.Logger) *PreviewNotifier {
+	return &PreviewNotifier{
+		providers: providers,
+		log:       log,
+	}
+}
+
+func (n *PreviewNotifier) provider(preview *PreviewEnvironment) (GitProvider, bool) {
+	if preview.Spec.Repository == "" || preview.Spec.PullRequest == 0 {
+		return nil, false
+	}
+	provider, ok := n.providers[preview.Spec.Provider]
+	return provider, ok
+}
+
+// Notify updates the pull request comment and commit status for the preview's phase
+func (n *PreviewNotifier) Notify(ctx context.Context, preview *PreviewEnvironment) error {
+	provider, ok := n.provider(preview)
+	if !ok {
+		return nil
+	}
+
+	if err := provider.UpsertComment(ctx, preview.Spec.Repository, preview.Spec.PullRequest,
+		previewCommentMarker, previewComment(preview)); err != nil {
+		return err
+	}
+
+	if preview.Spec.CommitSHA == "" {
+		return nil
+	}
+	return provider.SetCommitStatus(ctx, preview.Spec.Repository, preview.Spec.CommitSHA, previewCommitStatus(preview))
+}
+
+// NotifyDeleted marks the preview as gone on its pull request
+func (n *PreviewNotifier) NotifyDeleted(ctx context.Context, preview *PreviewEnvironment) error {
+	provider, ok := n.provider(preview)
+	if !ok {
+		return nil
+	}
+
+	body := fmt.Sprintf("%s\n### Preview environment\n\nThe preview for this pull request has been removed.\n",
+		previewCommentMarker)
+	if err := provider.UpsertComment(ctx, preview.Spec.Repository, preview.Spec.PullRequest,
+		previewCommentMarker, body); err != nil {
+		return err
+	}
+
+	if preview.Spec.CommitSHA == "" {
+		return nil
+	}
+	return provider.SetCommitStatus(ctx, preview.Spec.Repository, preview.Spec.CommitSHA, CommitStatus{
+		State:       CommitStateSuccess,
+		Description: "Preview removed",
+		Context:     previewStatusContext,
+	})
+}
+
+// previewNotificationKey identifies what was last reported for a preview
+func previewNotificationKey(preview *PreviewEnvironment) string {
+	return fmt.Sprintf("%s@%s", preview.Status.Phase, preview.Spec.CommitSHA)
+}
+
+func previewCommitStatus(preview *PreviewEnvironment) CommitStatus {
+	status := CommitStatus{
+		State:       CommitStatePending,
+		TargetURL:   preview.Status.URL,
+		Description: fmt.Sprintf("Preview is %s", strings.ToLower(preview.Status.Phase)),
+		Context:     previewStatusContext,
+	}
+
+	switch preview.Status.Phase {
+	case "Ready", "Hibernated":
+		status.State = CommitStateSuccess
+	case "Failed":
+		status.State = CommitStateFailure
+	}
+	return status
+}
+
+func previewComment(preview *PreviewEnvironment) string {
+	var b strings.Builder
+	b.WriteString(previewCommentMarker + "\n")
+	b.WriteString("### Preview environment\n\n")
+	b.WriteString("| | |\n|---|---|\n")
+
+	if preview.Status.URL != "" {
+		fmt.Fprintf(&b, "| URL | %s |\n", preview.Status.URL)
+	}
+	fmt.Fprintf(&b, "| Phase | %s |\n", preview.Status.Phase)
+	// Failure messages can carry job logs, which may include secrets, so the
+	// pull request only gets a pointer to the preview's status
+	if preview.Status.Phase == "Failed" {
+		fmt.Fprintf(&b, "| Details | The preview failed; see `kubectl describe previewenvironment %s -n %s` |\n",
+			preview.Name, preview.Namespace)
+	} else if preview.Status.Message != "" {
+		fmt.Fprintf(&b, "| Details | %s |\n", strings.ReplaceAll(preview.Status.Message, "|", "\\|"))
+	}
+	if preview.Spec.CommitSHA != "" {
+		fmt.Fprintf(&b, "| Commit | %s |\n", preview.Spec.CommitSHA)
+	}
+
+	switch previewAccessMode(preview) {
+	case AccessModeBasicAuth:
+		fmt.Fprintf(&b, "| Access | basic auth, credentials in Secret %s/%s |\n", preview.Status.Namespace, previewBasicAuthSecret)
+	case AccessModeIPAllowlist:
+		b.WriteString("| Access | IP allowlist |\n")
+	case AccessModeOAuth2:
+		b.WriteString("| Access | organization sign-in |\n")
+	}
+
+	if database := preview.Status.Database; database != nil {
+		state := fmt.Sprintf("%s (%s)", database.Name, database.Strategy)
+		if database.SourceSize != "" {
+			state += fmt.Sprintf(", %s source", database.SourceSize)
+		}
+		if database.Anonymized {
+			state += ", anonymized"
+		}
+		fmt.Fprintf(&b, "| Database | %s |\n", state)
+	}
+
+	if !preview.Status.ExpiresAt.IsZero() {
+		fmt.Fprintf(&b, "| Expires | %s |\n", preview.Status.ExpiresAt.UTC().Format(time.RFC1123))
+	}
+
+	return b.String()
+}
@@ -0,0 +1,63 @@
+package controllers
+
+import (
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestPreviewCommentOmitsFailureDetails(t *testing.T) {
+	preview := &PreviewEnvironment{
+		ObjectMeta: metav1.ObjectMeta{Name: "shop-pr-7", Namespace: "previews"},
+		Spec:       PreviewEnvironmentSpec{CommitSHA: "abc123"},
+		Status: PreviewEnvironmentStatus{
+			Phase:   "Failed",
+			Message: "seed job failed:\nERROR: password authentication failed for user \"admin\" (password=hunter2)",
+		},
+	}
+
+	comment := previewComment(preview)
+	if strings.Contains(comment, "hunter2") || strings.Contains(comment, "seed job failed") {
+		t.Errorf("comment leaks the failure message:\n%s", comment)
+	}
+	if !strings.Contains(comment, "kubectl describe previewenvironment shop-pr-7 -n previews") {
+		t.Errorf("comment does not point at the preview's status:\n%s", comment)
+	}
+	if !strings.HasPrefix(comment, previewCommentMarker) {
+		t.Errorf("comment does not start with the marker:\n%s", comment)
+	}
+}
+
+func TestPreviewCommentShowsProgress(t *testing.T) {
+	preview := &PreviewEnvironment{
+		ObjectMeta: metav1.ObjectMeta{Name: "shop-pr-7", Namespace: "previews"},
+		Status: PreviewEnvironmentStatus{
+			Phase:   "Seeding",
+			Message: "Waiting for seed job shop-pr-7-seed",
+		},
+	}
+
+	if comment := previewComment(preview); !strings.Contains(comment, "| Details | Waiting for seed job shop-pr-7-seed |") {
+		t.Errorf("comment does not show the preview's progress:\n%s", comment)
+	}
+}
+
+func TestPreviewCommitStatus(t *testing.T) {
+	tests := []struct {
+		phase string
+		want  string
+	}{
+		{phase: "Creating", want: CommitStatePending},
+		{phase: "Ready", want: CommitStateSuccess},
+		{phase: "Hibernated", want: CommitStateSuccess},
+		{phase: "Failed", want: CommitStateFailure},
+	}
+
+	for _, tt := range tests {
+		preview := &PreviewEnvironment{Status: PreviewEnvironmentStatus{Phase: tt.phase}}
+		if got := previewCommitStatus(preview).State; got != tt.want {
+			t.Errorf("state for phase %s = %q, want %q", tt.phase, got, tt.want)
+		}
+	}
+}
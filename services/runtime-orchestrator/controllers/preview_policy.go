@@ -0,0 +1,211 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// PreviewProjectPolicy limits the previews of a project
+type PreviewProjectPolicy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec PreviewProjectPolicySpec `json:"spec,omitempty"`
+}
+
+// PreviewProjectPolicyList contains a list of PreviewProjectPolicy
+type PreviewProjectPolicyList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []PreviewProjectPolicy `json:"items"`
+}
+
+type PreviewProjectPolicySpec struct {
+	// Project the policy applies to
+	ProjectID string `json:"projectId"`
+
+	// Maximum concurrent previews; the least recently active is evicted
+	// to make room for a new one (unlimited if not set)
+	MaxPreviews int `json:"maxPreviews,omitempty"`
+
+	// ResourceQuota tier of the preview namespaces (small, medium or large)
+	QuotaTier string `json:"quotaTier,omitempty"`
+
+	// TTL of previews that do not set one
+	DefaultTTL metav1.Duration `json:"defaultTtl,omitempty"`
+}
+
+// Preview ResourceQuota tiers
+const (
+	QuotaTierSmall  = "small"
+	QuotaTierMedium = "medium"
+	QuotaTierLarge  = "large"
+)
+
+const (
+	// defaultPreviewTTL applies when neither the preview nor its policy sets a TTL
+	defaultPreviewTTL = 72 * time.Hour
+
+	// extendTTLAnnotation pushes a preview's expiry forward by a duration, such as "24h"
+	extendTTLAnnotation = "cygni.io/extend-ttl"
+)
+
+// previewQuota returns the ResourceQuota limits of a tier
+func previewQuota(tier string) (corev1.ResourceList, error) {
+	switch tier {
+	case QuotaTierSmall:
+		return corev1.ResourceList{
+			corev1.ResourceCPU:                    resource.MustParse("2"),
+			corev1.ResourceMemory:                 resource.MustParse("4Gi"),
+			corev1.ResourcePods:                   resource.MustParse("6"),
+			corev1.ResourcePersistentVolumeClaims: resource.MustParse("2"),
+		}, nil
+	case "", QuotaTierMedium:
+		return corev1.ResourceList{
+			corev1.ResourceCPU:                    resource.MustParse("4"),
+			corev1.ResourceMemory:                 resource.MustParse("8Gi"),
+			corev1.ResourcePods:                   resource.MustParse("10"),
+			corev1.ResourcePersistentVolumeClaims: resource.MustParse("5"),
+		}, nil
+	case QuotaTierLarge:
+		return corev1.ResourceList{
+			corev1.ResourceCPU:                    resource.MustParse("8"),
+			corev1.ResourceMemory:                 resource.MustParse("16Gi"),
+			corev1.ResourcePods:                   resource.MustParse("20"),
+			corev1.ResourcePersistentVolumeClaims: resource.MustParse("10"),
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown quota tier %q", tier)
+}
+
+// projectPolicy returns the policy of the preview's project, or nil if it has none
+func (r *PreviewEnvironmentReconciler) projectPolicy(ctx context.Context, preview *PreviewEnvironment) (*PreviewProjectPolicy, error) {
+	policies := &PreviewProjectPolicyList{}
+	if err := r.List(ctx, policies, client.InNamespace(preview.Namespace)); err != nil {
+		return nil, fmt.Errorf("failed to list preview project policies: %w", err)
+	}
+
+	for i := range policies.Items {
+		if policies.Items[i].Spec.ProjectID == preview.Spec.ProjectID {
+			return &policies.Items[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// previewTTL returns the lifetime of a preview
+func previewTTL(preview *PreviewEnvironment, policy *PreviewProjectPolicy) time.Duration {
+	if preview.Spec.TTL.Duration > 0 {
+		return preview.Spec.TTL.Duration
+	}
+	if policy != nil && policy.Spec.DefaultTTL.Duration > 0 {
+		return policy.Spec.DefaultTTL.Duration
+	}
+	return defaultPreviewTTL
+}
+
+// enforcePreviewLimit evicts the project's least recently active previews
+// until a new preview fits within the policy's limit
+func (r *PreviewEnvironmentReconciler) enforcePreviewLimit(ctx context.Context, preview *PreviewEnvironment, policy *PreviewProjectPolicy) error {
+	if policy == nil || policy.Spec.MaxPreviews <= 0 {
+		return nil
+	}
+
+	previews := &PreviewEnvironmentList{}
+	if err := r.List(ctx, previews, client.InNamespace(preview.Namespace)); err != nil {
+		return fmt.Errorf("failed to list previews: %w", err)
+	}
+
+	active := []*PreviewEnvironment{}
+	for i := range previews.Items {
+		other := &previews.Items[i]
+		if other.UID == preview.UID || other.Spec.ProjectID != preview.Spec.ProjectID ||
+			!other.DeletionTimestamp.IsZero() || other.Status.Namespace == "" {
+			continue
+		}
+		active = append(active, other)
+	}
+
+	sort.Slice(active, func(i, j int) bool {
+		return active[i].Status.LastActivity.Before(&active[j].Status.LastActivity)
+	})
+
+	for len(active) >= policy.Spec.MaxPreviews {
+		evicted := active[0]
+		active = active[1:]
+
+		r.Log.Info("Evicting least recently active preview",
+			"preview", evicted.Name,
+			"project", preview.Spec.ProjectID,
+			"lastActivity", evicted.Status.LastActivity.Time,
+			"for", preview.Name)
+		if err := r.Delete(ctx, evicted); err != nil && client.IgnoreNotFound(err) != nil {
+			return fmt.Errorf("failed to evict preview %s: %w", evicted.Name, err)
+		}
+	}
+	return nil
+}
+
+// extendTTL applies the extend-ttl annotation: ExpiresAt is pushed forward
+// from now or the current expiry, whichever is later, and the annotation is
+// removed. The annotation is only removed once the new expiry is saved, so a
+// failed status update is retried rather than losing the extension.
+func (r *PreviewEnvironmentReconciler) extendTTL(ctx context.Context, preview *PreviewEnvironment) error {
+	value, ok := preview.Annotations[extendTTLAnnotation]
+	if !ok {
+		return nil
+	}
+
+	extension, err := time.ParseDuration(value)
+	if err != nil || extension <= 0 {
+		r.Log.Info("Ignoring invalid TTL extension", "preview", preview.Name, "value", value)
+		return r.removeExtendTTLAnnotation(ctx, preview)
+	}
+
+	from := time.Now()
+	if preview.Status.ExpiresAt.After(from) {
+		from = preview.Status.ExpiresAt.Time
+	}
+	expiresAt := metav1.NewTime(from.Add(extension))
+
+	preview.Status.ExpiresAt = expiresAt
+	if err := r.Status().Update(ctx, preview); err != nil {
+		return err
+	}
+	if err := r.removeExtendTTLAnnotation(ctx, preview); err != nil {
+		return err
+	}
+
+	if preview.Status.Namespace != "" {
+		namespace := &corev1.Namespace{}
+		namespace.Name = preview.Status.Namespace
+		patch := client.MergeFrom(namespace.DeepCopy())
+		namespace.Annotations = map[string]string{
+			"cygni.io/expires-at": expiresAt.Format(time.RFC3339),
+		}
+		if err := r.Patch(ctx, namespace, patch); client.IgnoreNotFound(err) != nil {
+			return fmt.Errorf("failed to update namespace expiry: %w", err)
+		}
+	}
+
+	r.Log.Info("Extended preview TTL", "preview", preview.Name, "expiresAt", expiresAt.Time)
+	return nil
+}
+
+// removeExtendTTLAnnotation drops the applied annotation. A merge patch does
+// not conflict with the status update that preceded it.
+func (r *PreviewEnvironmentReconciler) removeExtendTTLAnnotation(ctx context.Context, preview *PreviewEnvironment) error {
+	patch := client.MergeFrom(preview.DeepCopy())
+	delete(preview.Annotations, extendTTLAnnotation)
+	if err := r.Patch(ctx, preview, patch); err != nil {
+		return fmt.Errorf("failed to remove %s annotation: %w", extendTTLAnnotation, err)
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestExtendTTL(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		value      string
+		wantExtend time.Duration
+	}{
+		{value: "48h", wantExtend: 48 * time.Hour},
+		{value: "soon"},
+		{value: "-1h"},
+	}
+	for _, tt := range tests {
+		preview := testPreview(nil)
+		preview.Annotations = map[string]string{extendTTLAnnotation: tt.value}
+		r := newTestPreviewReconciler(t, preview)
+
+		if err := r.extendTTL(ctx, preview); err != nil {
+			t.Fatalf("%s: extendTTL: %v", tt.value, err)
+		}
+
+		stored := &PreviewEnvironment{}
+		if err := r.Get(ctx, types.NamespacedName{Name: preview.Name, Namespace: preview.Namespace}, stored); err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := stored.Annotations[extendTTLAnnotation]; ok {
+			t.Errorf("%s: annotation was not removed", tt.value)
+		}
+
+		if tt.wantExtend == 0 {
+			if !stored.Status.ExpiresAt.IsZero() {
+				t.Errorf("%s: expiry = %s, want it unchanged", tt.value, stored.Status.ExpiresAt)
+			}
+			continue
+		}
+		if until := time.Until(stored.Status.ExpiresAt.Time); until < tt.wantExtend-time.Minute || until > tt.wantExtend {
+			t.Errorf("%s: preview expires in %s, want %s", tt.value, until, tt.wantExtend)
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// How copied secrets follow changes to their base environment secret
+const (
+	SecretSyncPolicySync = "Sync"
+	SecretSyncPolicyFlag = "Flag"
+)
+
+// Annotations on secrets copied into previews
+const (
+	secretSourceHashAnnotation    = "cygni.io/source-hash"
+	secretSourceChangedAnnotation = "cygni.io/source-changed"
+)
+
+// getPreviewSecretsNamespace returns the namespace holding preview replacements for base secrets
+func getPreviewSecretsNamespace() string {
+	namespace := os.Getenv("PREVIEW_SECRETS_NAMESPACE")
+	if namespace == "" {
+		namespace = "preview-secrets"
+	}
+	return namespace
+}
+
+// getPreviewSecretsAllow returns the operator-wide glob patterns of secret
+// names copied into previews that do not list their own
+func getPreviewSecretsAllow() []string {
+	patterns := []string{}
+	for _, pattern := range strings.Split(os.Getenv("PREVIEW_SECRETS_ALLOW"), ",") {
+		if pattern = strings.TrimSpace(pattern); pattern != "" {
+			patterns = append(patterns, pattern)
+		}
+	}
+	return patterns
+}
+
+// previewSecretAllowed reports whether a base environment secret may be copied
+// into a preview. Only secrets matching the preview's allow patterns, or the
+// operator's when it has none, are copied; nothing is copied by default.
+func previewSecretAllowed(secret *corev1.Secret, spec *PreviewSecretsSpec) bool {
+	// Skip system secrets
+	if secret.Type == corev1.SecretTypeServiceAccountToken ||
+		strings.HasPrefix(secret.Name, "default-token-") ||
+		strings.HasSuffix(secret.Name, "-tls") {
+		return false
+	}
+
+	allow := getPreviewSecretsAllow()
+	if spec != nil {
+		for _, pattern := range spec.Deny {
+			if matched, _ := path.Match(pattern, secret.Name); matched {
+				return false
+			}
+		}
+		if len(spec.Allow) > 0 {
+			allow = spec.Allow
+		}
+	}
+
+	for _, pattern := range allow {
+		if matched, _ := path.Match(pattern, secret.Name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// validatePreviewSecretsSpec checks patterns and overrides before anything is copied
+func validatePreviewSecretsSpec(spec *PreviewSecretsSpec) error {
+	if spec == nil {
+		return nil
+	}
+
+	for _, pattern := range append(append([]string{}, spec.Allow...), spec.Deny...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid secret pattern %q: %w", pattern, err)
+		}
+	}
+
+	for _, override := range spec.Overrides {
+		if override.Secret == "" || override.Key == "" {
+			return fmt.Errorf("secret overrides require a secret and a key")
+		}
+		sources := 0
+		if override.Value != "" {
+			sources++
+		}
+		if override.FromSecret != "" {
+			sources++
+		}
+		if override.Remove {
+			sources++
+		}
+		if sources != 1 {
+			return fmt.Errorf("override of %s/%s must set exactly one of value, fromSecret and remove",
+				override.Secret, override.Key)
+		}
+	}
+
+	switch spec.SyncPolicy {
+	case "", SecretSyncPolicySync, SecretSyncPolicyFlag:
+	default:
+		return fmt.Errorf("unsupported secret sync policy %q", spec.SyncPolicy)
+	}
+
+	return nil
+}
+
+// previewSecretReplacements returns the secrets of the preview secrets namespace by name
+func (r *PreviewEnvironmentReconciler) previewSecretReplacements(ctx context.Context) (map[string]*corev1.Secret, error) {
+	secrets := &corev1.SecretList{}
+	if err := r.List(ctx, secrets, client.InNamespace(getPreviewSecretsNamespace())); err != nil {
+		return nil, fmt.Errorf("failed to list preview secrets: %w", err)
+	}
+
+	replacements := map[string]*corev1.Secret{}
+	for i := range secrets.Items {
+		replacements[secrets.Items[i].Name] = &secrets.Items[i]
+	}
+	return replacements, nil
+}
+
+// previewSecretData builds the data of a copied secret: the base data with
+// same-named keys from the preview secrets namespace, the preview's database
+// URL and the spec's overrides applied in that order
+func previewSecretData(base *corev1.Secret, replacements map[string]*corev1.Secret, spec *PreviewSecretsSpec, databaseURL string) (map[string][]byte, error) {
+	data := map[string][]byte{}
+	for key, value := range base.Data {
+		data[key] = value
+	}
+
+	if replacement, ok := replacements[base.Name]; ok {
+		for key, value := range replacement.Data {
+			data[key] = value
+		}
+	}
+
+	// Point the preview at its own database rather than the base
+	// environment's, and never hand out the base database without one
+	if _, ok := data["DATABASE_URL"]; ok {
+		if databaseURL != "" {
+			data["DATABASE_URL"] = []byte(databaseURL)
+		} else {
+			delete(data, "DATABASE_URL")
+		}
+	}
+
+	if spec == nil {
+		return data, nil
+	}
+
+	for _, override := range spec.Overrides {
+		if override.Secret != base.Name {
+			continue
+		}
+
+		switch {
+		case override.Remove:
+			delete(data, override.Key)
+		case override.Value != "":
+			data[override.Key] = []byte(override.Value)
+		default:
+			// Copying the base value instead would defeat the override
+			source, ok := replacements[override.FromSecret]
+			if !ok {
+				return nil, fmt.Errorf("override of %s/%s references missing secret %s/%s",
+					base.Name, override.Key, getPreviewSecretsNamespace(), override.FromSecret)
+			}
+			fromKey := override.FromKey
+			if fromKey == "" {
+				fromKey = override.Key
+			}
+			value, ok := source.Data[fromKey]
+			if !ok {
+				return nil, fmt.Errorf("override of %s/%s references missing key %s in secret %s/%s",
+					base.Name, override.Key, fromKey, getPreviewSecretsNamespace(), override.FromSecret)
+			}
+			data[override.Key] = value
+		}
+	}
+
+	return data, nil
+}
+
+// secretDataHash identifies the contents of a secret
+func secretDataHash(data map[string][]byte) string {
+	keys := make([]string, 0, len(data))
+	for key := range data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	parts := []string{}
+	for _, key := range keys {
+		parts = append(parts, key, string(data[key]))
+	}
+	return shortHash(parts...)
+}
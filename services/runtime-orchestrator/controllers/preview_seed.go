@@ -0,0 +1,254 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	cloudxv1 "github.com/cygni/runtime-orchestrator/api/v1"
+)
+
+// Seed job phases
+const (
+	SeedPhaseRunning   = "Running"
+	SeedPhaseSucceeded = "Succeeded"
+	SeedPhaseFailed    = "Failed"
+)
+
+const (
+	// reseedAnnotation re-runs the seed job whenever its value changes
+	reseedAnnotation = "cygni.io/reseed"
+
+	// defaultSeedKey is the ConfigMap key holding seed SQL
+	defaultSeedKey = "seed.sql"
+)
+
+// seedJobName identifies a seed run by its spec and the reseed annotation,
+// so changing either starts a new job
+func seedJobName(preview *PreviewEnvironment) string {
+	seed := preview.Spec.Seed
+	return fmt.Sprintf("preview-seed-%s", shortHash(
+		seed.Service,
+		strings.Join(seed.Command, "\x00"),
+		seed.ConfigMap,
+		seed.Key,
+		preview.Annotations[reseedAnnotation],
+	))
+}
+
+// seedPreview runs the preview's seed job once its services, and so their
+// migrations, are running. It reports whether seeding has completed.
+func (r *PreviewEnvironmentReconciler) seedPreview(ctx context.Context, preview *PreviewEnvironment, services []cloudxv1.CloudExpressService) (bool, error) {
+	seed := preview.Spec.Seed
+	if (len(seed.Command) == 0) == (seed.ConfigMap == "") {
+		return false, fmt.Errorf("seed requires exactly one of command and configMap")
+	}
+
+	jobName := seedJobName(preview)
+	if preview.Status.Seed != nil && preview.Status.Seed.JobName == jobName {
+		switch preview.Status.Seed.Phase {
+		case SeedPhaseSucceeded:
+			return true, nil
+		case SeedPhaseFailed:
+			// Failed seeds are only retried through the reseed annotation
+			return false, fmt.Errorf("seed job %s failed: %s", jobName, preview.Status.Seed.Message)
+		}
+	}
+
+	job := &batchv1.Job{}
+	err := r.Get(ctx, types.NamespacedName{
+		Name:      jobName,
+		Namespace: preview.Status.Namespace,
+	}, job)
+	if err != nil && !errors.IsNotFound(err) {
+		return false, fmt.Errorf("failed to check seed job: %w", err)
+	}
+
+	if errors.IsNotFound(err) {
+		job, err = r.constructSeedJob(ctx, preview, services, jobName)
+		if err != nil {
+			return false, err
+		}
+		if err := r.Create(ctx, job); err != nil {
+			return false, fmt.Errorf("failed to create seed job: %w", err)
+		}
+
+		preview.Status.Seed = &PreviewSeedStatus{
+			JobName:   jobName,
+			Phase:     SeedPhaseRunning,
+			StartedAt: metav1.Now(),
+		}
+		r.Log.Info("Created seed job", "preview", preview.Name, "job", jobName)
+		return false, r.Status().Update(ctx, preview)
+	}
+
+	finished, succeeded := jobFinished(job)
+	if !finished {
+		return false, nil
+	}
+
+	if preview.Status.Seed == nil || preview.Status.Seed.JobName != jobName {
+		preview.Status.Seed = &PreviewSeedStatus{JobName: jobName}
+	}
+	now := metav1.Now()
+	preview.Status.Seed.CompletedAt = &now
+
+	if !succeeded {
+		logs, logErr := jobLogs(ctx, r.Client, r.KubeClient, job, "seed")
+		if logErr != nil {
+			r.Log.Error(logErr, "Failed to capture seed logs", "job", jobName)
+		}
+		preview.Status.Seed.Phase = SeedPhaseFailed
+		preview.Status.Seed.Message = truncateLog(logs, 1024)
+		if err := r.Status().Update(ctx, preview); err != nil {
+			return false, err
+		}
+		return false, fmt.Errorf("seed job %s failed: %s", jobName, preview.Status.Seed.Message)
+	}
+
+	preview.Status.Seed.Phase = SeedPhaseSucceeded
+	preview.Status.Seed.Message = ""
+	r.Log.Info("Seeded preview", "preview", preview.Name, "job", jobName)
+	return true, r.Status().Update(ctx, preview)
+}
+
+// constructSeedJob runs the seed command in a service's image with its
+// environment, or applies seed SQL with psql
+func (r *PreviewEnvironmentReconciler) constructSeedJob(ctx context.Context, preview *PreviewEnvironment, services []cloudxv1.CloudExpressService, jobName string) (*batchv1.Job, error) {
+	seed := preview.Spec.Seed
+	labels := map[string]string{
+		"cygni.io/preview": "true",
+		"cygni.io/type":    "seed",
+	}
+
+	container := corev1.Container{
+		Name: "seed",
+		EnvFrom: []corev1.EnvFromSource{
+			{
+				SecretRef: &corev1.SecretEnvSource{
+					LocalObjectReference: corev1.LocalObjectReference{Name: "preview-env"},
+				},
+			},
+		},
+	}
+	volumes := []corev1.Volume{}
+
+	if len(seed.Command) > 0 {
+		name := seed.Service
+		if name == "" {
+			target, _, err := previewIngressTarget(preview, services)
+			if err != nil {
+				return nil, err
+			}
+			name = target
+		}
+
+		var service *cloudxv1.CloudExpressService
+		for i := range services {
+			if services[i].Name == name {
+				service = &services[i]
+			}
+		}
+		if service == nil {
+			return nil, fmt.Errorf("seed service %q is not part of the preview", name)
+		}
+
+		container.Image = service.Spec.Image
+		container.Command = seed.Command
+		container.EnvFrom = append(serviceEnvFrom(service), container.EnvFrom...)
+		for _, key := range sortedKeys(service.Spec.Env) {
+			container.Env = append(container.Env, corev1.EnvVar{Name: key, Value: service.Spec.Env[key]})
+		}
+		container.Env = append(container.Env, serviceSecretEnvVars(service)...)
+	} else {
+		if preview.Status.Database == nil {
+			return nil, fmt.Errorf("seed SQL requires a preview database")
+		}
+
+		key := seed.Key
+		if key == "" {
+			key = defaultSeedKey
+		}
+		source := &corev1.ConfigMap{}
+		if err := r.Get(ctx, types.NamespacedName{
+			Name:      seed.ConfigMap,
+			Namespace: preview.Namespace,
+		}, source); err != nil {
+			return nil, fmt.Errorf("failed to get seed ConfigMap %s: %w", seed.ConfigMap, err)
+		}
+		sql, ok := source.Data[key]
+		if !ok {
+			return nil, fmt.Errorf("seed ConfigMap %s has no key %s", seed.ConfigMap, key)
+		}
+
+		// The job mounts a copy, as ConfigMaps cannot be mounted across namespaces
+		configMap := &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      jobName,
+				Namespace: preview.Status.Namespace,
+			},
+		}
+		if _, err := controllerutil.CreateOrUpdate(ctx, r.Client, configMap, func() error {
+			configMap.Data = map[string]string{defaultSeedKey: sql}
+			return nil
+		}); err != nil {
+			return nil, fmt.Errorf("failed to store seed SQL: %w", err)
+		}
+
+		container.Image = "postgres:16-alpine"
+		container.Command = []string{
+			"sh",
+			"-c",
+			`psql "$DATABASE_URL" --single-transaction -v ON_ERROR_STOP=1 -f /seed/seed.sql`,
+		}
+		container.Env = []corev1.EnvVar{
+			{
+				Name:      "DATABASE_URL",
+				ValueFrom: secretKeyRef(preview.Status.Database.SecretName, "DATABASE_URL"),
+			},
+		}
+		container.VolumeMounts = []corev1.VolumeMount{
+			{
+				Name:      "seed",
+				MountPath: "/seed",
+			},
+		}
+		volumes = append(volumes, corev1.Volume{
+			Name: "seed",
+			VolumeSource: corev1.VolumeSource{
+				ConfigMap: &corev1.ConfigMapVolumeSource{
+					LocalObjectReference: corev1.LocalObjectReference{Name: jobName},
+				},
+			},
+		})
+	}
+
+	return &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      jobName,
+			Namespace: preview.Status.Namespace,
+			Labels:    labels,
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit:          &[]int32{0}[0],
+			ActiveDeadlineSeconds: &[]int64{1800}[0],
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: labels,
+				},
+				Spec: corev1.PodSpec{
+					RestartPolicy: corev1.RestartPolicyNever,
+					Containers:    []corev1.Container{container},
+					Volumes:       volumes,
+				},
+			},
+		},
+	}, nil
+}
@@ -0,0 +1,279 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	cloudxv1 "github.com/cygni/runtime-orchestrator/api/v1"
+)
+
+// baseNamespace returns the namespace of the environment a preview is cloned from
+func baseNamespace(preview *PreviewEnvironment) string {
+	return fmt.Sprintf("cygni-%s", preview.Spec.BaseEnvironment)
+}
+
+// previewHost returns the public host of a preview
+func previewHost(preview *PreviewEnvironment) string {
+	return fmt.Sprintf("pr-%d--%s.preview.cygni.app",
+		preview.Spec.PullRequest,
+		strings.ReplaceAll(preview.Spec.ProjectID, "_", "-"))
+}
+
+// previewServiceHost returns the public host of a service cloned into a preview
+func previewServiceHost(preview *PreviewEnvironment, service string) string {
+	return fmt.Sprintf("%s--%s", service, previewHost(preview))
+}
+
+// deployServices clones every CloudExpressService of the base environment into
+// the preview namespace and returns the preview's services
+func (r *PreviewEnvironmentReconciler) deployServices(ctx context.Context, preview *PreviewEnvironment) ([]cloudxv1.CloudExpressService, error) {
+	baseNS := baseNamespace(preview)
+	base := &cloudxv1.CloudExpressServiceList{}
+	if err := r.List(ctx, base, client.InNamespace(baseNS)); err != nil {
+		return nil, fmt.Errorf("failed to list base environment services: %w", err)
+	}
+
+	if len(base.Items) == 0 {
+		return nil, fmt.Errorf("base environment %s has no services", baseNS)
+	}
+
+	overrides := map[string]string{}
+	if preview.Spec.Services != nil && preview.Spec.Services.ImageOverrides != nil {
+		overrides = preview.Spec.Services.ImageOverrides
+	}
+
+	known := map[string]bool{}
+	for _, source := range base.Items {
+		known[source.Name] = true
+	}
+	for name := range overrides {
+		if !known[name] {
+			return nil, fmt.Errorf("image override for unknown service %q", name)
+		}
+	}
+
+	hosts := r.previewHostReplacer(preview, base.Items)
+
+	// Every service gets a public Ingress of its own, protected like the preview's
+	access, err := r.previewAccessAnnotationValues(ctx, preview)
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure access protection: %w", err)
+	}
+
+	services := []cloudxv1.CloudExpressService{}
+	for i := range base.Items {
+		source := &base.Items[i]
+
+		clone := &cloudxv1.CloudExpressService{}
+		clone.Name = source.Name
+		clone.Namespace = preview.Status.Namespace
+
+		result, err := controllerutil.CreateOrUpdate(ctx, r.Client, clone, func() error {
+			clone.Spec = *source.Spec.DeepCopy()
+			adaptPreviewServiceSpec(&clone.Spec, overrides[source.Name], hosts)
+			if err := usePreviewDatabase(&clone.Spec, preview); err != nil {
+				return err
+			}
+
+			if clone.Labels == nil {
+				clone.Labels = map[string]string{}
+			}
+			clone.Labels["cygni.io/preview"] = "true"
+			clone.Labels["cygni.io/copied-from"] = baseNS
+
+			if clone.Annotations == nil {
+				clone.Annotations = map[string]string{}
+			}
+			clone.Annotations["cygni.io/host"] = previewServiceHost(preview, source.Name)
+			for _, key := range previewAccessAnnotations {
+				delete(clone.Annotations, key)
+			}
+			for key, value := range access {
+				clone.Annotations[key] = value
+			}
+			if preview.Status.Hibernated {
+				clone.Annotations[hibernatedAnnotation] = "true"
+			} else {
+				delete(clone.Annotations, hibernatedAnnotation)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to deploy service %s: %w", source.Name, err)
+		}
+
+		if result != controllerutil.OperationResultNone {
+			r.Log.Info("Deployed preview service",
+				"preview", preview.Name,
+				"service", clone.Name,
+				"image", clone.Spec.Image,
+				"operation", result)
+		}
+
+		services = append(services, *clone)
+	}
+
+	sort.Slice(services, func(i, j int) bool {
+		return services[i].Name < services[j].Name
+	})
+
+	return services, nil
+}
+
+// adaptPreviewServiceSpec turns a copy of a base environment service into its preview
+func adaptPreviewServiceSpec(spec *cloudxv1.CloudExpressServiceSpec, image string, hosts *strings.Replacer) {
+	if image != "" {
+		spec.Image = image
+	}
+
+	for key, value := range spec.Env {
+		spec.Env[key] = hosts.Replace(value)
+	}
+
+	// Previews run a single replica to stay within the namespace quota
+	spec.Autoscale.Min = 1
+	spec.Autoscale.Max = 0
+
+	// Canary traffic splitting needs gateway routes that previews do not have
+	spec.Strategy = nil
+}
+
+// usePreviewDatabase points the service and its migrations at the preview's
+// own database. Services that reference a database are refused when the
+// preview has none, so they never reach the base environment's data.
+func usePreviewDatabase(spec *cloudxv1.CloudExpressServiceSpec, preview *PreviewEnvironment) error {
+	_, plaintext := spec.Env["DATABASE_URL"]
+	_, fromSecret := spec.SecretEnv["DATABASE_URL"]
+
+	if preview.Status.Database == nil {
+		if plaintext || fromSecret || spec.Migrations != nil {
+			return fmt.Errorf("the service uses a database but the preview has none")
+		}
+		return nil
+	}
+
+	database := cloudxv1.SecretKeyReference{
+		Name: preview.Status.Database.SecretName,
+		Key:  "DATABASE_URL",
+	}
+
+	// Overrides both the plaintext variable and whatever the envFrom secret holds
+	delete(spec.Env, "DATABASE_URL")
+	if spec.SecretEnv == nil {
+		spec.SecretEnv = map[string]cloudxv1.SecretKeyReference{}
+	}
+	spec.SecretEnv["DATABASE_URL"] = database
+
+	if spec.Migrations != nil {
+		spec.Migrations.DatabaseSecretRef = database
+	}
+	return nil
+}
+
+// previewHostReplacer rewrites the base environment's public and in-cluster
+// hosts to those of the preview
+func (r *PreviewEnvironmentReconciler) previewHostReplacer(preview *PreviewEnvironment, base []cloudxv1.CloudExpressService) *strings.Replacer {
+	entry, _, _ := previewIngressTarget(preview, base)
+
+	pairs := []string{}
+	for i := range base {
+		host := previewServiceHost(preview, base[i].Name)
+		if base[i].Name == entry {
+			host = previewHost(preview)
+		}
+		pairs = append(pairs, serviceHost(&base[i]), host)
+	}
+	pairs = append(pairs,
+		fmt.Sprintf(".%s.svc", baseNamespace(preview)),
+		fmt.Sprintf(".%s.svc", preview.Status.Namespace))
+
+	return strings.NewReplacer(pairs...)
+}
+
+// previewIngressTarget selects the service and port the preview URL routes to
+func previewIngressTarget(preview *PreviewEnvironment, services []cloudxv1.CloudExpressService) (string, int32, error) {
+	isWeb := func(cxs *cloudxv1.CloudExpressService) bool {
+		return (cxs.Spec.ServiceType == "" || cxs.Spec.ServiceType == "web") && len(cxs.Spec.Ports) > 0
+	}
+
+	var target *cloudxv1.CloudExpressService
+	if preview.Spec.Services != nil && preview.Spec.Services.IngressService != "" {
+		for i := range services {
+			if services[i].Name == preview.Spec.Services.IngressService {
+				target = &services[i]
+			}
+		}
+		if target == nil {
+			return "", 0, fmt.Errorf("ingress service %q is not part of the preview", preview.Spec.Services.IngressService)
+		}
+		if !isWeb(target) {
+			return "", 0, fmt.Errorf("ingress service %q does not expose any ports", target.Name)
+		}
+	} else {
+		candidates := []*cloudxv1.CloudExpressService{}
+		for i := range services {
+			if isWeb(&services[i]) {
+				candidates = append(candidates, &services[i])
+			}
+		}
+		sort.Slice(candidates, func(i, j int) bool {
+			return candidates[i].Name < candidates[j].Name
+		})
+
+		for _, name := range []string{"web", "app"} {
+			for _, candidate := range candidates {
+				if target == nil && candidate.Name == name {
+					target = candidate
+				}
+			}
+		}
+		if target == nil && len(candidates) > 0 {
+			target = candidates[0]
+		}
+		if target == nil {
+			return "", 0, fmt.Errorf("no web service with ports to route the preview to")
+		}
+	}
+
+	port := target.Spec.Ports[0]
+	if preview.Spec.Services != nil && preview.Spec.Services.IngressPort != 0 {
+		port = preview.Spec.Services.IngressPort
+		found := false
+		for _, p := range target.Spec.Ports {
+			found = found || p == port
+		}
+		if !found {
+			return "", 0, fmt.Errorf("service %s does not expose port %d", target.Name, port)
+		}
+	}
+
+	return target.Name, port, nil
+}
+
+// previewServiceStatuses summarises the preview's services for status
+func previewServiceStatuses(services []cloudxv1.CloudExpressService) []PreviewServiceStatus {
+	statuses := []PreviewServiceStatus{}
+	for _, service := range services {
+		statuses = append(statuses, PreviewServiceStatus{
+			Name:  service.Name,
+			Image: service.Spec.Image,
+			Phase: service.Status.Phase,
+		})
+	}
+	return statuses
+}
+
+// previewServicesRunning reports whether every service of the preview is running
+func previewServicesRunning(services []cloudxv1.CloudExpressService) bool {
+	for _, service := range services {
+		if service.Status.Phase != "Running" {
+			return false
+		}
+	}
+	return true
+}
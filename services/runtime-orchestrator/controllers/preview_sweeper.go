@@ -0,0 +1,185 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// previewSweepGracePeriod protects namespaces and databases whose preview has
+// not recorded them yet
+const previewSweepGracePeriod = 10 * time.Minute
+
+// SweptResource is a leftover found by the sweeper
+type SweptResource struct {
+	Kind   string // Namespace, PreviewEnvironment or Database
+	Name   string
+	Reason string
+}
+
+// SweepReport lists what a sweep removed, or would remove in dry-run mode
+type SweepReport struct {
+	DryRun    bool
+	Resources []SweptResource
+	Errors    []error
+}
+
+// PreviewSweeper periodically removes preview namespaces and databases left
+// behind by previews that were force-deleted or whose finalizer was stripped
+type PreviewSweeper struct {
+	client   client.Client
+	brancher DatabaseBrancher
+	log      logr.Logger
+	interval time.Duration
+	dryRun   bool
+}
+
+// NewPreviewSweeper returns a sweeper. brancher may be nil to skip databases;
+// in dry-run mode leftovers are only reported.
+func NewPreviewSweeper(c client.Client, brancher DatabaseBrancher, log logr.Logger, interval time.Duration, dryRun bool) *PreviewSweeper {
+	return &PreviewSweeper{
+		client:   c,
+		brancher: brancher,
+		log:      log,
+		interval: interval,
+		dryRun:   dryRun,
+	}
+}
+
+// Start sweeps on every interval until the context is cancelled, so it can be
+// added to the manager as a Runnable
+func (s *PreviewSweeper) Start(ctx context.Context) error {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := s.Sweep(ctx); err != nil {
+			s.log.Error(err, "Preview sweep failed")
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// NeedLeaderElection ensures only one replica sweeps
+func (s *PreviewSweeper) NeedLeaderElection() bool {
+	return true
+}
+
+// Sweep finds and removes leftovers once
+func (s *PreviewSweeper) Sweep(ctx context.Context) (*SweepReport, error) {
+	report := &SweepReport{DryRun: s.dryRun}
+
+	previews := &PreviewEnvironmentList{}
+	if err := s.client.List(ctx, previews); err != nil {
+		return nil, fmt.Errorf("failed to list previews: %w", err)
+	}
+
+	owners := map[string]*PreviewEnvironment{}
+	databases := map[string]bool{}
+	for i := range previews.Items {
+		preview := &previews.Items[i]
+		if preview.Status.Namespace == "" {
+			continue
+		}
+		owners[preview.Status.Namespace] = preview
+		databases[previewDatabaseName(preview.Status.Namespace)] = true
+		if preview.Status.Database != nil {
+			databases[preview.Status.Database.Name] = true
+		}
+	}
+
+	namespaces := &corev1.NamespaceList{}
+	if err := s.client.List(ctx, namespaces, client.MatchingLabels{"cygni.io/preview": "true"}); err != nil {
+		return nil, fmt.Errorf("failed to list preview namespaces: %w", err)
+	}
+
+	for i := range namespaces.Items {
+		namespace := &namespaces.Items[i]
+		if !namespace.DeletionTimestamp.IsZero() ||
+			time.Since(namespace.CreationTimestamp.Time) < previewSweepGracePeriod {
+			continue
+		}
+
+		preview, owned := owners[namespace.Name]
+		if !owned {
+			s.remove(ctx, report, namespace, SweptResource{
+				Kind:   "Namespace",
+				Name:   namespace.Name,
+				Reason: "no owning PreviewEnvironment",
+			})
+			continue
+		}
+
+		// Expired previews are deleted through their finalizer, which also drops the database
+		expiresAt, err := time.Parse(time.RFC3339, namespace.Annotations["cygni.io/expires-at"])
+		if err == nil && time.Since(expiresAt) > previewSweepGracePeriod && preview.DeletionTimestamp.IsZero() {
+			s.remove(ctx, report, preview, SweptResource{
+				Kind:   "PreviewEnvironment",
+				Name:   fmt.Sprintf("%s/%s", preview.Namespace, preview.Name),
+				Reason: fmt.Sprintf("expired at %s", expiresAt.Format(time.RFC3339)),
+			})
+		}
+	}
+
+	if s.brancher != nil {
+		found, err := s.brancher.List(ctx)
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Errorf("failed to list preview databases: %w", err))
+		}
+		for _, database := range found {
+			// A database is branched before its preview records it
+			name := database.Name
+			if databases[name] || time.Since(database.CreatedAt) < previewSweepGracePeriod {
+				continue
+			}
+
+			swept := SweptResource{
+				Kind:   "Database",
+				Name:   name,
+				Reason: "no owning PreviewEnvironment",
+			}
+			if !s.dryRun {
+				if err := s.brancher.Delete(ctx, name); err != nil {
+					report.Errors = append(report.Errors, fmt.Errorf("failed to drop database %s: %w", name, err))
+					continue
+				}
+			}
+			s.record(report, swept)
+		}
+	}
+
+	if len(report.Errors) > 0 {
+		return report, fmt.Errorf("preview sweep finished with %d errors, first: %w", len(report.Errors), report.Errors[0])
+	}
+	return report, nil
+}
+
+// remove deletes a leftover object unless running in dry-run mode
+func (s *PreviewSweeper) remove(ctx context.Context, report *SweepReport, obj client.Object, swept SweptResource) {
+	if !s.dryRun {
+		if err := s.client.Delete(ctx, obj); client.IgnoreNotFound(err) != nil {
+			report.Errors = append(report.Errors, fmt.Errorf("failed to delete %s %s: %w", swept.Kind, swept.Name, err))
+			return
+		}
+	}
+	s.record(report, swept)
+}
+
+func (s *PreviewSweeper) record(report *SweepReport, swept SweptResource) {
+	report.Resources = append(report.Resources, swept)
+
+	message := "Swept preview leftover"
+	if s.dryRun {
+		message = "Would sweep preview leftover"
+	}
+	s.log.Info(message, "kind", swept.Kind, "name", swept.Name, "reason", swept.Reason)
+}
@@ -0,0 +1,74 @@
+package controllers
+
+import (
+	"context"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+// fakeBrancher lists a fixed set of databases and records deletions
+type fakeBrancher struct {
+	databases []PreviewDatabase
+	deleted   []string
+}
+
+func (b *fakeBrancher) Branch(ctx context.Context, req BranchRequest) (*DatabaseBranch, error) {
+	return &DatabaseBranch{Name: req.Name}, nil
+}
+
+func (b *fakeBrancher) Delete(ctx context.Context, name string) error {
+	b.deleted = append(b.deleted, name)
+	return nil
+}
+
+func (b *fakeBrancher) List(ctx context.Context) ([]PreviewDatabase, error) {
+	return b.databases, nil
+}
+
+func TestPreviewSweeperDatabases(t *testing.T) {
+	old := time.Now().Add(-2 * previewSweepGracePeriod)
+	preview := testPreview(nil)
+
+	brancher := &fakeBrancher{databases: []PreviewDatabase{
+		// Owned by a preview
+		{Name: previewDatabaseName(preview.Status.Namespace), CreatedAt: old},
+		// Just branched; its preview has not recorded it yet
+		{Name: "preview_shop_pr_8", CreatedAt: time.Now()},
+		// Orphaned
+		{Name: "preview_shop_pr_3", CreatedAt: old},
+		{Name: "preview_shop_pr_4", CreatedAt: old},
+	}}
+	r := newTestPreviewReconciler(t, preview)
+
+	for _, dryRun := range []bool{true, false} {
+		brancher.deleted = nil
+		sweeper := NewPreviewSweeper(r.Client, brancher, logr.Discard(), time.Hour, dryRun)
+
+		report, err := sweeper.Sweep(context.Background())
+		if err != nil {
+			t.Fatalf("Sweep: %v", err)
+		}
+
+		swept := []string{}
+		for _, resource := range report.Resources {
+			if resource.Kind == "Database" {
+				swept = append(swept, resource.Name)
+			}
+		}
+		sort.Strings(swept)
+		if len(swept) != 2 || swept[0] != "preview_shop_pr_3" || swept[1] != "preview_shop_pr_4" {
+			t.Errorf("dryRun=%v: swept %v, want the two orphaned databases", dryRun, swept)
+		}
+
+		wantDeleted := 2
+		if dryRun {
+			wantDeleted = 0
+		}
+		if len(brancher.deleted) != wantDeleted {
+			t.Errorf("dryRun=%v: dropped %v, want %d databases", dryRun, brancher.deleted, wantDeleted)
+		}
+	}
+}
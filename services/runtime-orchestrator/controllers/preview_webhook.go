@@ -0,0 +1,492 @@
+package controllers
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+)
+
+// Git providers sending pull request events
+const (
+	GitProviderGitHub = "github"
+	GitProviderGitLab = "gitlab"
+)
+
+const (
+	// defaultPreviewLabel is the pull request label that opts into a preview
+	defaultPreviewLabel = "preview"
+
+	// previewRepositoriesKey is the ConfigMap key mapping repositories to projects
+	previewRepositoriesKey = "repositories.yaml"
+
+	// maxWebhookPayload bounds the size of accepted webhook bodies
+	maxWebhookPayload = 5 << 20
+)
+
+// PreviewRepository maps a git repository to the preview it gets
+type PreviewRepository struct {
+	// Repository path, such as "acme/shop" or "group/subgroup/project"
+	Repository string `json:"repository"`
+
+	// Project the previews belong to
+	ProjectID string `json:"projectId"`
+
+	// Base environment the previews are cloned from
+	BaseEnvironment string `json:"baseEnvironment"`
+
+	// Namespace the PreviewEnvironments are created in (defaults to PREVIEW_NAMESPACE)
+	Namespace string `json:"namespace,omitempty"`
+
+	// Label required on the pull request (defaults to "preview")
+	Label string `json:"label,omitempty"`
+
+	// Images built for each commit keyed by service; "{sha}" is replaced with the commit
+	Images map[string]string `json:"images,omitempty"`
+
+	// TTL for the previews
+	TTL metav1.Duration `json:"ttl,omitempty"`
+
+	// Database configuration of the previews
+	Database *PreviewDatabaseSpec `json:"database,omitempty"`
+}
+
+// PreviewWebhookConfig configures the pull request webhook receiver
+type PreviewWebhookConfig struct {
+	// Secret GitHub signs payloads with
+	GitHubSecret string
+
+	// Token GitLab sends in X-Gitlab-Token
+	GitLabToken string
+
+	// ConfigMap holding the repository mapping under "repositories.yaml"
+	ConfigMapNamespace string
+	ConfigMapName      string
+}
+
+// PreviewWebhookConfigFromEnv reads the webhook configuration from the environment
+func PreviewWebhookConfigFromEnv() PreviewWebhookConfig {
+	config := PreviewWebhookConfig{
+		GitHubSecret:       os.Getenv("PREVIEW_WEBHOOK_GITHUB_SECRET"),
+		GitLabToken:        os.Getenv("PREVIEW_WEBHOOK_GITLAB_TOKEN"),
+		ConfigMapNamespace: os.Getenv("PREVIEW_WEBHOOK_CONFIGMAP_NAMESPACE"),
+		ConfigMapName:      os.Getenv("PREVIEW_WEBHOOK_CONFIGMAP"),
+	}
+	if config.ConfigMapNamespace == "" {
+		config.ConfigMapNamespace = "runtime-orchestrator"
+	}
+	if config.ConfigMapName == "" {
+		config.ConfigMapName = "preview-repositories"
+	}
+	return config
+}
+
+// getPreviewNamespace returns the default namespace for PreviewEnvironments
+func getPreviewNamespace() string {
+	namespace := os.Getenv("PREVIEW_NAMESPACE")
+	if namespace == "" {
+		namespace = "previews"
+	}
+	return namespace
+}
+
+// pullRequestEvent is a provider-neutral pull or merge request event
+type pullRequestEvent struct {
+	Provider   string
+	Repository string
+	Number     int
+	Action     string // open, update, close, label or unlabel
+	Branch     string
+	CommitSHA  string
+	Labels     []string
+}
+
+func (e *pullRequestEvent) hasLabel(label string) bool {
+	for _, l := range e.Labels {
+		if strings.EqualFold(l, label) {
+			return true
+		}
+	}
+	return false
+}
+
+// PreviewWebhook creates, updates and deletes PreviewEnvironments from
+// GitHub pull request and GitLab merge request events
+type PreviewWebhook struct {
+	client client.Client
+	log    logr.Logger
+	config PreviewWebhookConfig
+	addr   string
+}
+
+func NewPreviewWebhook(c client.Client, log logr.Logger, config PreviewWebhookConfig, addr string) *PreviewWebhook {
+	return &PreviewWebhook{
+		client: c,
+		log:    log,
+		config: config,
+		addr:   addr,
+	}
+}
+
+// Start serves the webhook until the context is cancelled, so it can be
+// added to the manager as a Runnable
+func (w *PreviewWebhook) Start(ctx context.Context) error {
+	w.log.Info("Starting preview webhook", "addr", w.addr)
+	if err := serveHTTP(ctx, w.addr, w); err != nil {
+		return fmt.Errorf("failed to serve preview webhook: %w", err)
+	}
+	return nil
+}
+
+func (w *PreviewWebhook) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(rw, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(req.Body, maxWebhookPayload))
+	if err != nil {
+		http.Error(rw, "failed to read payload", http.StatusBadRequest)
+		return
+	}
+
+	var event *pullRequestEvent
+	switch {
+	case req.Header.Get("X-GitHub-Event") != "":
+		if !w.verifyGitHub(req, body) {
+			http.Error(rw, "invalid signature", http.StatusUnauthorized)
+			return
+		}
+		if req.Header.Get("X-GitHub-Event") != "pull_request" {
+			rw.WriteHeader(http.StatusNoContent)
+			return
+		}
+		event, err = parseGitHubEvent(body)
+	case req.Header.Get("X-Gitlab-Event") != "":
+		if !w.verifyGitLab(req) {
+			http.Error(rw, "invalid token", http.StatusUnauthorized)
+			return
+		}
+		if req.Header.Get("X-Gitlab-Event") != "Merge Request Hook" {
+			rw.WriteHeader(http.StatusNoContent)
+			return
+		}
+		event, err = parseGitLabEvent(body)
+	default:
+		http.Error(rw, "unknown event source", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if event == nil {
+		rw.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	if err := w.handleEvent(req.Context(), event); err != nil {
+		w.log.Error(err, "Failed to handle pull request event",
+			"repository", event.Repository,
+			"number", event.Number,
+			"action", event.Action)
+		http.Error(rw, "failed to handle event", http.StatusInternalServerError)
+		return
+	}
+	rw.WriteHeader(http.StatusAccepted)
+}
+
+// verifyGitHub checks the payload's HMAC-SHA256 signature
+func (w *PreviewWebhook) verifyGitHub(req *http.Request, body []byte) bool {
+	if w.config.GitHubSecret == "" {
+		return false
+	}
+
+	signature := strings.TrimPrefix(req.Header.Get("X-Hub-Signature-256"), "sha256=")
+	expected, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, []byte(w.config.GitHubSecret))
+	mac.Write(body)
+	return hmac.Equal(mac.Sum(nil), expected)
+}
+
+// verifyGitLab checks the shared token, as GitLab does not sign payloads
+func (w *PreviewWebhook) verifyGitLab(req *http.Request) bool {
+	if w.config.GitLabToken == "" {
+		return false
+	}
+	token := req.Header.Get("X-Gitlab-Token")
+	return subtle.ConstantTimeCompare([]byte(token), []byte(w.config.GitLabToken)) == 1
+}
+
+func parseGitHubEvent(body []byte) (*pullRequestEvent, error) {
+	var payload struct {
+		Action      string `json:"action"`
+		Number      int    `json:"number"`
+		PullRequest struct {
+			Head struct {
+				Ref string `json:"ref"`
+				SHA string `json:"sha"`
+			} `json:"head"`
+			Labels []struct {
+				Name string `json:"name"`
+			} `json:"labels"`
+		} `json:"pull_request"`
+		Repository struct {
+			FullName string `json:"full_name"`
+		} `json:"repository"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, fmt.Errorf("failed to parse pull request event: %w", err)
+	}
+
+	actions := map[string]string{
+		"opened":      "open",
+		"reopened":    "open",
+		"synchronize": "update",
+		"closed":      "close",
+		"labeled":     "label",
+		"unlabeled":   "unlabel",
+	}
+	action, ok := actions[payload.Action]
+	if !ok {
+		return nil, nil
+	}
+
+	event := &pullRequestEvent{
+		Provider:   GitProviderGitHub,
+		Repository: payload.Repository.FullName,
+		Number:     payload.Number,
+		Action:     action,
+		Branch:     payload.PullRequest.Head.Ref,
+		CommitSHA:  payload.PullRequest.Head.SHA,
+	}
+	for _, label := range payload.PullRequest.Labels {
+		event.Labels = append(event.Labels, label.Name)
+	}
+	return event, nil
+}
+
+func parseGitLabEvent(body []byte) (*pullRequestEvent, error) {
+	var payload struct {
+		ObjectAttributes struct {
+			IID          int    `json:"iid"`
+			Action       string `json:"action"`
+			SourceBranch string `json:"source_branch"`
+			OldRev       string `json:"oldrev"`
+			LastCommit   struct {
+				ID string `json:"id"`
+			} `json:"last_commit"`
+		} `json:"object_attributes"`
+		Labels []struct {
+			Title string `json:"title"`
+		} `json:"labels"`
+		Changes struct {
+			Labels *struct {
+				Previous []struct {
+					Title string `json:"title"`
+				} `json:"previous"`
+			} `json:"labels"`
+		} `json:"changes"`
+		Project struct {
+			PathWithNamespace string `json:"path_with_namespace"`
+		} `json:"project"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, fmt.Errorf("failed to parse merge request event: %w", err)
+	}
+
+	attrs := payload.ObjectAttributes
+	event := &pullRequestEvent{
+		Provider:   GitProviderGitLab,
+		Repository: payload.Project.PathWithNamespace,
+		Number:     attrs.IID,
+		Branch:     attrs.SourceBranch,
+		CommitSHA:  attrs.LastCommit.ID,
+	}
+	for _, label := range payload.Labels {
+		event.Labels = append(event.Labels, label.Title)
+	}
+
+	switch attrs.Action {
+	case "open", "reopen":
+		event.Action = "open"
+	case "close", "merge":
+		event.Action = "close"
+	case "update":
+		// Updates carry either new commits or changed labels
+		switch {
+		case attrs.OldRev != "":
+			event.Action = "update"
+		case payload.Changes.Labels != nil:
+			event.Action = "label"
+		default:
+			return nil, nil
+		}
+	default:
+		return nil, nil
+	}
+	return event, nil
+}
+
+// previewRepositories loads the repository to project mapping
+func (w *PreviewWebhook) previewRepositories(ctx context.Context) ([]PreviewRepository, error) {
+	configMap := &corev1.ConfigMap{}
+	if err := w.client.Get(ctx, types.NamespacedName{
+		Name:      w.config.ConfigMapName,
+		Namespace: w.config.ConfigMapNamespace,
+	}, configMap); err != nil {
+		return nil, fmt.Errorf("failed to get preview repositories ConfigMap: %w", err)
+	}
+
+	repositories := []PreviewRepository{}
+	if err := yaml.Unmarshal([]byte(configMap.Data[previewRepositoriesKey]), &repositories); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", previewRepositoriesKey, err)
+	}
+	return repositories, nil
+}
+
+func (w *PreviewWebhook) handleEvent(ctx context.Context, event *pullRequestEvent) error {
+	repositories, err := w.previewRepositories(ctx)
+	if err != nil {
+		return err
+	}
+
+	var repo *PreviewRepository
+	for i := range repositories {
+		if strings.EqualFold(repositories[i].Repository, event.Repository) {
+			repo = &repositories[i]
+		}
+	}
+	if repo == nil {
+		w.log.Info("Ignoring event for unmapped repository", "repository", event.Repository)
+		return nil
+	}
+
+	label := repo.Label
+	if label == "" {
+		label = defaultPreviewLabel
+	}
+
+	switch {
+	case event.Action == "close":
+		return w.deletePreview(ctx, repo, event)
+	case !event.hasLabel(label):
+		// Removing the label tears the preview down; other events are ignored
+		return w.deletePreview(ctx, repo, event)
+	default:
+		return w.upsertPreview(ctx, repo, event)
+	}
+}
+
+// previewName names the PreviewEnvironment of a pull request
+func previewName(repo *PreviewRepository, number int) string {
+	return fmt.Sprintf("%s-pr-%d", strings.ToLower(strings.ReplaceAll(repo.ProjectID, "_", "-")), number)
+}
+
+func previewNamespaceFor(repo *PreviewRepository) string {
+	if repo.Namespace != "" {
+		return repo.Namespace
+	}
+	return getPreviewNamespace()
+}
+
+func (w *PreviewWebhook) upsertPreview(ctx context.Context, repo *PreviewRepository, event *pullRequestEvent) error {
+	images := map[string]string{}
+	for service, image := range repo.Images {
+		images[service] = strings.ReplaceAll(image, "{sha}", event.CommitSHA)
+	}
+
+	preview := &PreviewEnvironment{}
+	err := w.client.Get(ctx, types.NamespacedName{
+		Name:      previewName(repo, event.Number),
+		Namespace: previewNamespaceFor(repo),
+	}, preview)
+
+	if errors.IsNotFound(err) {
+		preview = &PreviewEnvironment{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      previewName(repo, event.Number),
+				Namespace: previewNamespaceFor(repo),
+				Labels: map[string]string{
+					"cygni.io/project": repo.ProjectID,
+					"cygni.io/pr":      fmt.Sprintf("%d", event.Number),
+				},
+			},
+			Spec: PreviewEnvironmentSpec{
+				PullRequest:     event.Number,
+				Branch:          event.Branch,
+				ProjectID:       repo.ProjectID,
+				BaseEnvironment: repo.BaseEnvironment,
+				TTL:             repo.TTL,
+				Database:        repo.Database,
+				Repository:      event.Repository,
+				Provider:        event.Provider,
+				CommitSHA:       event.CommitSHA,
+			},
+		}
+		if len(images) > 0 {
+			preview.Spec.Services = &PreviewServicesSpec{ImageOverrides: images}
+		}
+
+		if err := w.client.Create(ctx, preview); err != nil && !errors.IsAlreadyExists(err) {
+			return fmt.Errorf("failed to create preview: %w", err)
+		}
+		w.log.Info("Created preview from pull request", "preview", preview.Name, "commit", event.CommitSHA)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if preview.Spec.CommitSHA == event.CommitSHA && preview.Spec.Branch == event.Branch {
+		return nil
+	}
+
+	preview.Spec.Branch = event.Branch
+	preview.Spec.CommitSHA = event.CommitSHA
+	if len(images) > 0 {
+		if preview.Spec.Services == nil {
+			preview.Spec.Services = &PreviewServicesSpec{}
+		}
+		preview.Spec.Services.ImageOverrides = images
+	}
+	if err := w.client.Update(ctx, preview); err != nil {
+		return fmt.Errorf("failed to update preview: %w", err)
+	}
+	w.log.Info("Updated preview to new commit", "preview", preview.Name, "commit", event.CommitSHA)
+	return nil
+}
+
+func (w *PreviewWebhook) deletePreview(ctx context.Context, repo *PreviewRepository, event *pullRequestEvent) error {
+	preview := &PreviewEnvironment{}
+	preview.Name = previewName(repo, event.Number)
+	preview.Namespace = previewNamespaceFor(repo)
+
+	if err := w.client.Delete(ctx, preview); err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to delete preview: %w", err)
+	}
+	w.log.Info("Deleted preview for pull request", "preview", preview.Name, "action", event.Action)
+	return nil
+}
@@ -0,0 +1,365 @@
+package controllers
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+const (
+	testGitHubSecret = "github-secret"
+	testGitLabToken  = "gitlab-token"
+)
+
+const testRepositories = `
+- repository: acme/shop
+  projectId: shop
+  baseEnvironment: staging
+  namespace: previews
+  images:
+    api: registry.example.com/shop/api:{sha}
+- repository: group/sub/shop
+  projectId: shop
+  baseEnvironment: staging
+  namespace: previews
+  label: deploy-preview
+`
+
+func newTestWebhook(t *testing.T, objects ...client.Object) (*PreviewWebhook, client.Client) {
+	t.Helper()
+
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	scheme.AddKnownTypes(schema.GroupVersion{Group: "cloudx.io", Version: "v1"}, &PreviewEnvironment{}, &PreviewEnvironmentList{})
+
+	repositories := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "preview-repositories", Namespace: "runtime-orchestrator"},
+		Data:       map[string]string{previewRepositoriesKey: testRepositories},
+	}
+	c := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(append(objects, repositories)...).
+		Build()
+
+	return NewPreviewWebhook(c, logr.Discard(), PreviewWebhookConfig{
+		GitHubSecret:       testGitHubSecret,
+		GitLabToken:        testGitLabToken,
+		ConfigMapNamespace: "runtime-orchestrator",
+		ConfigMapName:      "preview-repositories",
+	}, ""), c
+}
+
+func githubPayload(action, repository, sha string, labels ...string) string {
+	labelObjects := []map[string]string{}
+	for _, label := range labels {
+		labelObjects = append(labelObjects, map[string]string{"name": label})
+	}
+	body, _ := json.Marshal(map[string]interface{}{
+		"action": action,
+		"number": 7,
+		"pull_request": map[string]interface{}{
+			"head":   map[string]string{"ref": "feature/cart", "sha": sha},
+			"labels": labelObjects,
+		},
+		"repository": map[string]string{"full_name": repository},
+	})
+	return string(body)
+}
+
+func gitlabPayload(action, oldrev, sha string, labelsChanged bool, labels ...string) string {
+	labelObjects := []map[string]string{}
+	for _, label := range labels {
+		labelObjects = append(labelObjects, map[string]string{"title": label})
+	}
+	changes := map[string]interface{}{}
+	if labelsChanged {
+		changes["labels"] = map[string]interface{}{"previous": []map[string]string{}}
+	}
+	body, _ := json.Marshal(map[string]interface{}{
+		"object_kind": "merge_request",
+		"object_attributes": map[string]interface{}{
+			"iid":           7,
+			"action":        action,
+			"source_branch": "feature/cart",
+			"oldrev":        oldrev,
+			"last_commit":   map[string]string{"id": sha},
+		},
+		"labels":  labelObjects,
+		"changes": changes,
+		"project": map[string]string{"path_with_namespace": "group/sub/shop"},
+	})
+	return string(body)
+}
+
+func githubSignature(secret, body string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(body))
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func githubHeaders(event, body string) map[string]string {
+	return map[string]string{
+		"X-GitHub-Event":      event,
+		"X-Hub-Signature-256": githubSignature(testGitHubSecret, body),
+	}
+}
+
+func gitlabHeaders(token string) map[string]string {
+	return map[string]string{
+		"X-Gitlab-Event": "Merge Request Hook",
+		"X-Gitlab-Token": token,
+	}
+}
+
+func existingPreview(commit string) *PreviewEnvironment {
+	return &PreviewEnvironment{
+		ObjectMeta: metav1.ObjectMeta{Name: "shop-pr-7", Namespace: "previews"},
+		Spec: PreviewEnvironmentSpec{
+			PullRequest:     7,
+			Branch:          "feature/cart",
+			ProjectID:       "shop",
+			BaseEnvironment: "staging",
+			CommitSHA:       commit,
+		},
+	}
+}
+
+func TestPreviewWebhook(t *testing.T) {
+	opened := githubPayload("opened", "acme/shop", "abc123", "preview")
+	unlabeled := githubPayload("unlabeled", "acme/shop", "abc123", "bug")
+
+	tests := []struct {
+		name     string
+		existing []client.Object
+		headers  map[string]string
+		body     string
+
+		wantStatus  int
+		wantPreview bool   // whether shop-pr-7 exists afterwards
+		wantCommit  string // commit of the preview, if it exists
+		wantImage   string // image override of the api service, if any
+	}{
+		{
+			name:        "github opened with label creates the preview",
+			headers:     githubHeaders("pull_request", opened),
+			body:        opened,
+			wantStatus:  http.StatusAccepted,
+			wantPreview: true,
+			wantCommit:  "abc123",
+			wantImage:   "registry.example.com/shop/api:abc123",
+		},
+		{
+			name:       "github bad signature is rejected",
+			headers:    map[string]string{"X-GitHub-Event": "pull_request", "X-Hub-Signature-256": githubSignature("wrong", opened)},
+			body:       opened,
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "github missing signature is rejected",
+			headers:    map[string]string{"X-GitHub-Event": "pull_request"},
+			body:       opened,
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name: "github payload altered after signing is rejected",
+			headers: map[string]string{
+				"X-GitHub-Event":      "pull_request",
+				"X-Hub-Signature-256": githubSignature(testGitHubSecret, opened),
+			},
+			body:       strings.Replace(opened, "abc123", "evil00", 1),
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "github opened without label is ignored",
+			headers:    githubHeaders("pull_request", githubPayload("opened", "acme/shop", "abc123", "bug")),
+			body:       githubPayload("opened", "acme/shop", "abc123", "bug"),
+			wantStatus: http.StatusAccepted,
+		},
+		{
+			name:       "github other events are ignored",
+			headers:    githubHeaders("push", `{"ref":"refs/heads/main"}`),
+			body:       `{"ref":"refs/heads/main"}`,
+			wantStatus: http.StatusNoContent,
+		},
+		{
+			name:       "github unmapped repository is ignored",
+			headers:    githubHeaders("pull_request", githubPayload("opened", "acme/other", "abc123", "preview")),
+			body:       githubPayload("opened", "acme/other", "abc123", "preview"),
+			wantStatus: http.StatusAccepted,
+		},
+		{
+			name:        "github synchronize moves the preview to the new commit",
+			existing:    []client.Object{existingPreview("abc123")},
+			headers:     githubHeaders("pull_request", githubPayload("synchronize", "acme/shop", "def456", "preview")),
+			body:        githubPayload("synchronize", "acme/shop", "def456", "preview"),
+			wantStatus:  http.StatusAccepted,
+			wantPreview: true,
+			wantCommit:  "def456",
+			wantImage:   "registry.example.com/shop/api:def456",
+		},
+		{
+			name:       "github unlabel deletes the preview",
+			existing:   []client.Object{existingPreview("abc123")},
+			headers:    githubHeaders("pull_request", unlabeled),
+			body:       unlabeled,
+			wantStatus: http.StatusAccepted,
+		},
+		{
+			name:       "github closed deletes the preview",
+			existing:   []client.Object{existingPreview("abc123")},
+			headers:    githubHeaders("pull_request", githubPayload("closed", "acme/shop", "abc123", "preview")),
+			body:       githubPayload("closed", "acme/shop", "abc123", "preview"),
+			wantStatus: http.StatusAccepted,
+		},
+		{
+			name:        "gitlab opened with label creates the preview",
+			headers:     gitlabHeaders(testGitLabToken),
+			body:        gitlabPayload("open", "", "abc123", false, "deploy-preview"),
+			wantStatus:  http.StatusAccepted,
+			wantPreview: true,
+			wantCommit:  "abc123",
+		},
+		{
+			name:       "gitlab opened without the repository's label is ignored",
+			headers:    gitlabHeaders(testGitLabToken),
+			body:       gitlabPayload("open", "", "abc123", false, "preview"),
+			wantStatus: http.StatusAccepted,
+		},
+		{
+			name:       "gitlab bad token is rejected",
+			headers:    gitlabHeaders("wrong"),
+			body:       gitlabPayload("open", "", "abc123", false, "deploy-preview"),
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:        "gitlab push to the merge request updates the preview",
+			existing:    []client.Object{existingPreview("abc123")},
+			headers:     gitlabHeaders(testGitLabToken),
+			body:        gitlabPayload("update", "abc123", "def456", false, "deploy-preview"),
+			wantStatus:  http.StatusAccepted,
+			wantPreview: true,
+			wantCommit:  "def456",
+		},
+		{
+			name:        "gitlab adding the label creates the preview",
+			headers:     gitlabHeaders(testGitLabToken),
+			body:        gitlabPayload("update", "", "abc123", true, "deploy-preview"),
+			wantStatus:  http.StatusAccepted,
+			wantPreview: true,
+			wantCommit:  "abc123",
+		},
+		{
+			name:       "gitlab removing the label deletes the preview",
+			existing:   []client.Object{existingPreview("abc123")},
+			headers:    gitlabHeaders(testGitLabToken),
+			body:       gitlabPayload("update", "", "abc123", true),
+			wantStatus: http.StatusAccepted,
+		},
+		{
+			name:       "gitlab merge deletes the preview",
+			existing:   []client.Object{existingPreview("abc123")},
+			headers:    gitlabHeaders(testGitLabToken),
+			body:       gitlabPayload("merge", "", "abc123", false, "deploy-preview"),
+			wantStatus: http.StatusAccepted,
+		},
+		{
+			name:       "unknown source is rejected",
+			body:       opened,
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			webhook, c := newTestWebhook(t, tt.existing...)
+
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body))
+			for key, value := range tt.headers {
+				req.Header.Set(key, value)
+			}
+			rec := httptest.NewRecorder()
+			webhook.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+
+			preview := &PreviewEnvironment{}
+			err := c.Get(context.Background(), types.NamespacedName{Name: "shop-pr-7", Namespace: "previews"}, preview)
+			if !tt.wantPreview {
+				if !errors.IsNotFound(err) {
+					t.Fatalf("expected no preview, got %+v (err %v)", preview.Spec, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected a preview: %v", err)
+			}
+
+			if preview.Spec.CommitSHA != tt.wantCommit {
+				t.Errorf("commit = %q, want %q", preview.Spec.CommitSHA, tt.wantCommit)
+			}
+			if preview.Spec.PullRequest != 7 || preview.Spec.BaseEnvironment != "staging" || preview.Spec.Branch != "feature/cart" {
+				t.Errorf("unexpected preview spec %+v", preview.Spec)
+			}
+			if tt.wantImage != "" {
+				if preview.Spec.Services == nil || preview.Spec.Services.ImageOverrides["api"] != tt.wantImage {
+					t.Errorf("api image override = %+v, want %q", preview.Spec.Services, tt.wantImage)
+				}
+			}
+		})
+	}
+}
+
+func TestPreviewWebhookRejectsUnconfiguredProviders(t *testing.T) {
+	webhook, _ := newTestWebhook(t)
+	webhook.config.GitHubSecret = ""
+	webhook.config.GitLabToken = ""
+
+	body := githubPayload("opened", "acme/shop", "abc123", "preview")
+	for _, headers := range []map[string]string{
+		githubHeaders("pull_request", body),
+		{"X-Hub-Signature-256": githubSignature("", body), "X-GitHub-Event": "pull_request"},
+		gitlabHeaders(""),
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		for key, value := range headers {
+			req.Header.Set(key, value)
+		}
+		rec := httptest.NewRecorder()
+		webhook.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("status = %d with headers %v, want %d", rec.Code, headers, http.StatusUnauthorized)
+		}
+	}
+}
+
+func TestPreviewWebhookRejectsOtherMethods(t *testing.T) {
+	webhook, _ := newTestWebhook(t)
+	rec := httptest.NewRecorder()
+	webhook.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusMethodNotAllowed)
+	}
+}
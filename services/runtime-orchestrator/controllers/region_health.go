@@ -0,0 +1,124 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	cloudxv1 "github.com/cygni/runtime-orchestrator/api/v1"
+)
+
+// Defaults for regional health checks when TrafficPolicy.HealthCheck leaves them out
+const (
+	defaultRegionHealthPath             = "/"
+	defaultRegionHealthInterval         = 30 * time.Second
+	defaultRegionHealthTimeout          = 5 * time.Second
+	defaultRegionHealthFailureThreshold = 3
+)
+
+// regionHealthCheck is the parsed health check configuration of a MultiRegionService
+type regionHealthCheck struct {
+	path             string
+	interval         time.Duration
+	timeout          time.Duration
+	failureThreshold int32
+}
+
+// regionHealthCheckFor applies defaults to the configured health check. The
+// service's own health check path is used when the traffic policy has none.
+func regionHealthCheckFor(mrs *cloudxv1.MultiRegionService, cxs *cloudxv1.CloudExpressService) regionHealthCheck {
+	check := regionHealthCheck{
+		path:             defaultRegionHealthPath,
+		interval:         defaultRegionHealthInterval,
+		timeout:          defaultRegionHealthTimeout,
+		failureThreshold: defaultRegionHealthFailureThreshold,
+	}
+	if cxs.Spec.HealthCheck != nil && cxs.Spec.HealthCheck.Path != "" {
+		check.path = cxs.Spec.HealthCheck.Path
+	}
+
+	config := mrs.Spec.TrafficPolicy.HealthCheck
+	if config == nil {
+		return check
+	}
+	if config.Path != "" {
+		check.path = config.Path
+	}
+	if d, err := time.ParseDuration(config.Interval); err == nil && d > 0 {
+		check.interval = d
+	}
+	if d, err := time.ParseDuration(config.Timeout); err == nil && d > 0 {
+		check.timeout = d
+	}
+	if config.FailureThreshold > 0 {
+		check.failureThreshold = config.FailureThreshold
+	}
+	return check
+}
+
+// checkRegionHealth probes the regional endpoint and updates the health of
+// status. The probe runs at most once per interval; in between the previous
+// result is carried over. A healthy region only turns unhealthy after
+// failureThreshold consecutive failures, while a region without ready
+// replicas is unhealthy straight away.
+func (r *MultiRegionServiceReconciler) checkRegionHealth(ctx context.Context, check regionHealthCheck, status *cloudxv1.RegionStatus, deployment *cloudxv1.CloudExpressService, previous cloudxv1.RegionStatus) {
+	status.Healthy = previous.Healthy
+	status.ConsecutiveFailures = previous.ConsecutiveFailures
+	status.Message = previous.Message
+	status.LastHealthCheck = previous.LastHealthCheck
+
+	if deployment.Status.Phase != "Running" || deployment.Status.ReadyReplicas == 0 {
+		status.Healthy = false
+		status.ConsecutiveFailures++
+		status.Message = "no ready replicas"
+		status.LastHealthCheck = metav1.Now()
+		return
+	}
+
+	if !previous.LastHealthCheck.IsZero() && time.Since(previous.LastHealthCheck.Time) < check.interval {
+		return
+	}
+
+	err := r.probeRegion(ctx, status.Endpoint, check)
+	status.LastHealthCheck = metav1.Now()
+	if err != nil {
+		status.ConsecutiveFailures++
+		status.Message = err.Error()
+		status.Healthy = previous.Healthy && status.ConsecutiveFailures < check.failureThreshold
+		return
+	}
+
+	status.Healthy = true
+	status.ConsecutiveFailures = 0
+	status.Message = ""
+}
+
+// probeRegion sends one HTTP health check to a regional endpoint
+func (r *MultiRegionServiceReconciler) probeRegion(ctx context.Context, endpoint string, check regionHealthCheck) error {
+	ctx, cancel := context.WithTimeout(ctx, check.timeout)
+	defer cancel()
+
+	url := strings.TrimSuffix(endpoint, "/") + "/" + strings.TrimPrefix(check.path, "/")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create health check request: %w", err)
+	}
+	req.Header.Set("User-Agent", "cygni-region-health-check")
+
+	resp, err := r.HealthClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("health check failed: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("health check returned %s", resp.Status)
+	}
+	return nil
+}
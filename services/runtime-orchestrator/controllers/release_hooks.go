@@ -0,0 +1,440 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	cloudxv1 "github.com/cygni/runtime-orchestrator/api/v1"
+)
+
+// Points of the rollout at which release hooks run
+const (
+	HookPhasePreDeploy   = "preDeploy"
+	HookPhasePostDeploy  = "postDeploy"
+	HookPhasePreRollback = "preRollback"
+	HookPhasePostPromote = "postPromote"
+)
+
+// What a failed hook does to the rollout
+const (
+	HookFailurePolicyFail   = "Fail"
+	HookFailurePolicyIgnore = "Ignore"
+)
+
+// States of a hook job
+const (
+	HookStatePending   = "Pending"
+	HookStateRunning   = "Running"
+	HookStateSucceeded = "Succeeded"
+	HookStateFailed    = "Failed"
+)
+
+// defaultHookTimeout bounds hooks that do not declare a timeout
+const defaultHookTimeout = 10 * time.Minute
+
+// hookName matches names that can be embedded in Job names and label values
+var hookName = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]{0,28}[a-z0-9])?$`)
+
+// HookRunner runs release hooks as Jobs
+type HookRunner struct {
+	client     client.Client
+	kubeClient kubernetes.Interface
+	scheme     *runtime.Scheme
+	log        logr.Logger
+}
+
+// validateReleaseHooks checks the declared hooks before any job is created
+func validateReleaseHooks(hooks []cloudxv1.ReleaseHook) error {
+	seen := map[string]bool{}
+	for _, hook := range hooks {
+		if !hookName.MatchString(hook.Name) {
+			return fmt.Errorf("hook name %q must be a lowercase DNS label of at most 30 characters", hook.Name)
+		}
+		if seen[hook.Name] {
+			return fmt.Errorf("duplicate hook name %q", hook.Name)
+		}
+		seen[hook.Name] = true
+
+		switch hook.Phase {
+		case HookPhasePreDeploy, HookPhasePostDeploy, HookPhasePreRollback, HookPhasePostPromote:
+		default:
+			return fmt.Errorf("hook %s has unsupported phase %q", hook.Name, hook.Phase)
+		}
+
+		// The service image's entrypoint starts the app, so it needs a command
+		if hook.Image == "" && len(hook.Command) == 0 {
+			return fmt.Errorf("hook %s requires a command when it runs the service image", hook.Name)
+		}
+
+		switch hook.FailurePolicy {
+		case "", HookFailurePolicyFail, HookFailurePolicyIgnore:
+		default:
+			return fmt.Errorf("hook %s has unsupported failure policy %q", hook.Name, hook.FailurePolicy)
+		}
+
+		if hook.Timeout != "" {
+			timeout, err := time.ParseDuration(hook.Timeout)
+			if err != nil || timeout <= 0 {
+				return fmt.Errorf("hook %s has invalid timeout %q", hook.Name, hook.Timeout)
+			}
+		}
+	}
+
+	return nil
+}
+
+// hasHooks reports whether the service declares hooks for a phase
+func hasHooks(cxs *cloudxv1.CloudExpressService, phase string) bool {
+	return len(hooksForPhase(cxs, phase)) > 0
+}
+
+// hooksForPhase returns the hooks of a phase in declaration order
+func hooksForPhase(cxs *cloudxv1.CloudExpressService, phase string) []cloudxv1.ReleaseHook {
+	hooks := []cloudxv1.ReleaseHook{}
+	for _, hook := range cxs.Spec.Hooks {
+		if hook.Phase == phase {
+			hooks = append(hooks, hook)
+		}
+	}
+	return hooks
+}
+
+func hookIgnoresFailure(hook cloudxv1.ReleaseHook) bool {
+	return hook.FailurePolicy == HookFailurePolicyIgnore
+}
+
+func hookTimeout(hook cloudxv1.ReleaseHook) time.Duration {
+	if timeout, err := time.ParseDuration(hook.Timeout); err == nil && timeout > 0 {
+		return timeout
+	}
+	return defaultHookTimeout
+}
+
+// RunHooks runs the hooks of a phase one after another without blocking the
+// caller. It reports whether all of them have finished; an error means a hook
+// with the Fail policy failed.
+func (h *HookRunner) RunHooks(ctx context.Context, cxs *cloudxv1.CloudExpressService, phase string) (bool, error) {
+	if err := validateReleaseHooks(cxs.Spec.Hooks); err != nil {
+		return false, fmt.Errorf("invalid hooks: %w", err)
+	}
+	pruneHookStatuses(cxs)
+
+	for _, hook := range hooksForPhase(cxs, phase) {
+		jobName := hookJobName(cxs, hook, "")
+		status := hookStatusFor(cxs, hook, jobName)
+
+		switch status.State {
+		case HookStateSucceeded:
+			continue
+		case HookStateFailed:
+			if hookIgnoresFailure(hook) {
+				continue
+			}
+			return false, fmt.Errorf("%s hook %s failed: %s", phase, hook.Name, status.Message)
+		}
+
+		existing := &batchv1.Job{}
+		err := h.client.Get(ctx, types.NamespacedName{
+			Name:      jobName,
+			Namespace: cxs.Namespace,
+		}, existing)
+
+		if err != nil && !errors.IsNotFound(err) {
+			return false, fmt.Errorf("failed to check existing hook job: %w", err)
+		}
+
+		if errors.IsNotFound(err) {
+			job := h.constructHookJob(cxs, hook, jobName, "")
+			// Owning the job lets its completion trigger the next reconcile
+			if h.scheme != nil {
+				if err := controllerutil.SetControllerReference(cxs, job, h.scheme); err != nil {
+					return false, fmt.Errorf("failed to set controller reference: %w", err)
+				}
+			}
+			if err := h.client.Create(ctx, job); err != nil {
+				return false, fmt.Errorf("failed to create hook job: %w", err)
+			}
+
+			status.State = HookStateRunning
+			status.StartedAt = metav1.Now()
+			h.log.Info("Created hook job", "hook", hook.Name, "phase", phase, "job", jobName)
+			return false, nil
+		}
+
+		finished, succeeded := jobFinished(existing)
+		if !finished {
+			status.State = HookStateRunning
+			return false, nil
+		}
+
+		if succeeded {
+			h.log.Info("Hook completed successfully", "hook", hook.Name, "job", jobName)
+			status.State = HookStateSucceeded
+			status.CompletedAt = metav1.Now()
+			continue
+		}
+
+		h.markFailed(ctx, status, existing, fmt.Sprintf("hook job %s failed", jobName))
+		if hookIgnoresFailure(hook) {
+			h.log.Info("Ignoring failed hook", "hook", hook.Name, "job", jobName)
+			continue
+		}
+		return false, fmt.Errorf("%s hook %s failed: %s", phase, hook.Name, status.Message)
+	}
+
+	return true, nil
+}
+
+// RunHooksAndWait runs the hooks of a phase one after another and waits for
+// each of them. It is used outside the reconcile loop, where rollbacks and
+// canary promotions already block. targetImage is the image being rolled
+// back to, if any.
+func (h *HookRunner) RunHooksAndWait(ctx context.Context, cxs *cloudxv1.CloudExpressService, phase, targetImage string) error {
+	if err := validateReleaseHooks(cxs.Spec.Hooks); err != nil {
+		return fmt.Errorf("invalid hooks: %w", err)
+	}
+	pruneHookStatuses(cxs)
+
+	for _, hook := range hooksForPhase(cxs, phase) {
+		jobName := hookJobName(cxs, hook, targetImage)
+		status := hookStatusFor(cxs, hook, jobName)
+		if status.State == HookStateSucceeded {
+			continue
+		}
+
+		job := h.constructHookJob(cxs, hook, jobName, targetImage)
+		if h.scheme != nil {
+			if err := controllerutil.SetControllerReference(cxs, job, h.scheme); err != nil {
+				return fmt.Errorf("failed to set controller reference: %w", err)
+			}
+		}
+		// A hook that failed on an earlier attempt runs again
+		job, err := createOrRerunJob(ctx, h.client, job)
+		if err != nil {
+			return fmt.Errorf("failed to start hook job: %w", err)
+		}
+
+		status.State = HookStateRunning
+		status.StartedAt = metav1.Now()
+		h.log.Info("Running hook", "hook", hook.Name, "phase", phase, "job", jobName)
+
+		// The job enforces the timeout itself; allow it time to report failure
+		succeeded, err := waitForJobCompletion(ctx, h.client, job, hookTimeout(hook)+time.Minute)
+		if err == nil && succeeded {
+			status.State = HookStateSucceeded
+			status.CompletedAt = metav1.Now()
+			continue
+		}
+
+		message := fmt.Sprintf("hook job %s failed", jobName)
+		if err != nil {
+			message = err.Error()
+		}
+		h.markFailed(ctx, status, job, message)
+		if hookIgnoresFailure(hook) {
+			h.log.Info("Ignoring failed hook", "hook", hook.Name, "job", jobName)
+			continue
+		}
+		return fmt.Errorf("%s hook %s failed: %s", phase, hook.Name, status.Message)
+	}
+
+	return nil
+}
+
+// markFailed records a failed hook along with the tail of its output
+func (h *HookRunner) markFailed(ctx context.Context, status *cloudxv1.HookStatus, job *batchv1.Job, message string) {
+	logs, err := jobLogs(ctx, h.client, h.kubeClient, job, "hook")
+	if err != nil {
+		h.log.Error(err, "Failed to capture hook logs", "job", job.Name)
+	}
+	status.State = HookStateFailed
+	status.CompletedAt = metav1.Now()
+	status.Message = message
+	status.Logs = logs
+}
+
+// hookJobName keys the job on the hook definition and the images involved,
+// so a hook runs once per release
+func hookJobName(cxs *cloudxv1.CloudExpressService, hook cloudxv1.ReleaseHook, targetImage string) string {
+	parts := []string{cxs.Spec.Image, targetImage, hook.Phase, hook.Image}
+	parts = append(parts, hook.Command...)
+	parts = append(parts, "--")
+	parts = append(parts, hook.Args...)
+	for _, key := range sortedKeys(hook.Env) {
+		parts = append(parts, key, hook.Env[key])
+	}
+
+	return fmt.Sprintf("%s-hook-%s-%s", cxs.Name, hook.Name, shortHash(parts...))
+}
+
+// hookStatusFor returns the status entry of a hook, starting a new one when
+// the hook is about to run a different job
+func hookStatusFor(cxs *cloudxv1.CloudExpressService, hook cloudxv1.ReleaseHook, jobName string) *cloudxv1.HookStatus {
+	fresh := cloudxv1.HookStatus{
+		Name:    hook.Name,
+		Phase:   hook.Phase,
+		JobName: jobName,
+		Image:   cxs.Spec.Image,
+		State:   HookStatePending,
+	}
+
+	for i := range cxs.Status.Hooks {
+		if cxs.Status.Hooks[i].Name != hook.Name {
+			continue
+		}
+		if cxs.Status.Hooks[i].JobName != jobName {
+			cxs.Status.Hooks[i] = fresh
+		}
+		return &cxs.Status.Hooks[i]
+	}
+
+	cxs.Status.Hooks = append(cxs.Status.Hooks, fresh)
+	return &cxs.Status.Hooks[len(cxs.Status.Hooks)-1]
+}
+
+// pruneHookStatuses drops the status of hooks that are no longer declared
+func pruneHookStatuses(cxs *cloudxv1.CloudExpressService) {
+	declared := map[string]bool{}
+	for _, hook := range cxs.Spec.Hooks {
+		declared[hook.Name] = true
+	}
+
+	statuses := []cloudxv1.HookStatus{}
+	for _, status := range cxs.Status.Hooks {
+		if declared[status.Name] {
+			statuses = append(statuses, status)
+		}
+	}
+	if len(statuses) == 0 {
+		statuses = nil
+	}
+	cxs.Status.Hooks = statuses
+}
+
+// newlyFailedHooks returns the hooks that failed since previous was recorded
+func newlyFailedHooks(previous, current []cloudxv1.HookStatus) []cloudxv1.HookStatus {
+	failed := map[string]bool{}
+	for _, status := range previous {
+		if status.State == HookStateFailed {
+			failed[status.JobName] = true
+		}
+	}
+
+	newly := []cloudxv1.HookStatus{}
+	for _, status := range current {
+		if status.State == HookStateFailed && !failed[status.JobName] {
+			newly = append(newly, status)
+		}
+	}
+	return newly
+}
+
+func (h *HookRunner) constructHookJob(cxs *cloudxv1.CloudExpressService, hook cloudxv1.ReleaseHook, jobName, targetImage string) *batchv1.Job {
+	image := hook.Image
+	if image == "" {
+		image = cxs.Spec.Image
+	}
+
+	env := append(serviceEnvVars(cxs),
+		corev1.EnvVar{
+			Name:  "CLOUDEXPRESS_HOOK",
+			Value: hook.Name,
+		},
+		corev1.EnvVar{
+			Name:  "CLOUDEXPRESS_HOOK_PHASE",
+			Value: hook.Phase,
+		},
+		corev1.EnvVar{
+			Name:  "CLOUDEXPRESS_IMAGE",
+			Value: cxs.Spec.Image,
+		},
+		corev1.EnvVar{
+			Name:  "CLOUDEXPRESS_PREVIOUS_IMAGE",
+			Value: cxs.Status.PreviousImage,
+		},
+	)
+	if targetImage != "" {
+		env = append(env, corev1.EnvVar{
+			Name:  "CLOUDEXPRESS_TARGET_IMAGE",
+			Value: targetImage,
+		})
+	}
+	for _, key := range sortedKeys(hook.Env) {
+		env = append(env, corev1.EnvVar{
+			Name:  key,
+			Value: hook.Env[key],
+		})
+	}
+
+	labels := map[string]string{
+		"cygni.io/service": cxs.Name,
+		"cygni.io/type":    "hook",
+		"cygni.io/hook":    hook.Name,
+	}
+
+	return &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      jobName,
+			Namespace: cxs.Namespace,
+			Labels:    labels,
+			Annotations: map[string]string{
+				"cygni.io/image":      cxs.Spec.Image,
+				"cygni.io/hook-phase": hook.Phase,
+			},
+		},
+		Spec: batchv1.JobSpec{
+			// Hooks such as notifications are rarely safe to repeat
+			BackoffLimit:            &[]int32{0}[0],
+			ActiveDeadlineSeconds:   &[]int64{int64(hookTimeout(hook).Seconds())}[0],
+			TTLSecondsAfterFinished: &[]int32{3600}[0], // Clean up after 1 hour
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: labels,
+				},
+				Spec: corev1.PodSpec{
+					RestartPolicy: corev1.RestartPolicyNever,
+					Containers: []corev1.Container{
+						{
+							Name:    "hook",
+							Image:   image,
+							Command: hook.Command,
+							Args:    hook.Args,
+							Env:     env,
+							EnvFrom: serviceEnvFrom(cxs),
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// sortedKeys returns the keys of a string map in a stable order
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// hookFailureSummary formats a failed hook for events
+func hookFailureSummary(status cloudxv1.HookStatus) string {
+	return strings.TrimSpace(fmt.Sprintf("%s hook %s failed: %s\n%s", status.Phase, status.Name, status.Message, status.Logs))
+}
@@ -2,10 +2,13 @@ package controllers
 
 import (
 	"context"
+	"errors"
 	"fmt"
 
 	cloudxv1 "github.com/cygni/runtime-orchestrator/api/v1"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/retry"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
@@ -23,23 +26,28 @@ func (r *CloudExpressServiceReconciler) RollbackService(ctx context.Context, nam
 		return fmt.Errorf("no previous image available for rollback")
 	}
 
-	// Store current as next previous
-	currentImage := cxs.Spec.Image
-	
-	// Update spec with previous image
-	cxs.Spec.Image = cxs.Status.PreviousImage
-	
-	if err := r.Update(ctx, cxs); err != nil {
-		return fmt.Errorf("failed to update CloudExpressService: %w", err)
+	if err := r.runRollbackHooks(ctx, cxs, cxs.Status.PreviousImage); err != nil {
+		return err
 	}
+	hookStatuses := cxs.Status.Hooks
 
-	// Update status to reflect rollback
-	cxs.Status.PreviousImage = currentImage
-	cxs.Status.Phase = "RollingBack"
-	cxs.Status.Message = fmt.Sprintf("Rolling back from %s to %s", currentImage, cxs.Spec.Image)
-	
-	if err := r.Status().Update(ctx, cxs); err != nil {
-		return fmt.Errorf("failed to update status: %w", err)
+	// Revert the schema first when migrations opted in to automatic rollback
+	migrationStatus, err := r.rollbackSchema(ctx, cxs, cxs.Status.PreviousImage)
+	if err != nil {
+		return fmt.Errorf("failed to roll back schema: %w", err)
+	}
+
+	// Store current as next previous
+	currentImage := cxs.Spec.Image
+	targetImage := cxs.Status.PreviousImage
+
+	if err := r.revertImage(ctx, cxs, targetImage, migrationStatus, func(status *cloudxv1.CloudExpressServiceStatus) {
+		status.Hooks = hookStatuses
+		status.PreviousImage = currentImage
+		status.Phase = "RollingBack"
+		status.Message = fmt.Sprintf("Rolling back from %s to %s", currentImage, targetImage)
+	}); err != nil {
+		return err
 	}
 
 	r.Log.Info("Initiated rollback", 
@@ -51,6 +59,106 @@ func (r *CloudExpressServiceReconciler) RollbackService(ctx context.Context, nam
 	return nil
 }
 
+// revertImage points the service at targetImage once its schema has been
+// rolled back, and records the rollback in status. The rollback may have
+// taken minutes, so both updates re-fetch the service and retry on
+// conflicts. If the image cannot be reverted after the schema was, the new
+// image runs against the old schema; that is recorded as a failure.
+func (r *CloudExpressServiceReconciler) revertImage(ctx context.Context, cxs *cloudxv1.CloudExpressService, targetImage string, migrationStatus *cloudxv1.MigrationStatus, setStatus func(*cloudxv1.CloudExpressServiceStatus)) error {
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		latest := &cloudxv1.CloudExpressService{}
+		if err := r.Get(ctx, client.ObjectKeyFromObject(cxs), latest); err != nil {
+			return err
+		}
+		latest.Spec.Image = targetImage
+		if err := r.Update(ctx, latest); err != nil {
+			return err
+		}
+		*cxs = *latest
+		return nil
+	})
+	if err != nil {
+		if migrationStatus == nil {
+			return fmt.Errorf("failed to update CloudExpressService: %w", err)
+		}
+
+		message := fmt.Sprintf("Schema was rolled back for %s but the image could not be reverted from %s: %v",
+			targetImage, cxs.Spec.Image, err)
+		r.Log.Error(err, "Schema and image do not match after rollback",
+			"service", cxs.Name,
+			"namespace", cxs.Namespace,
+			"image", cxs.Spec.Image,
+			"schemaFor", targetImage)
+		r.recordEvent(cxs, corev1.EventTypeWarning, "SchemaImageMismatch", message)
+		if statusErr := r.updateStatusWithRetry(ctx, cxs, func(status *cloudxv1.CloudExpressServiceStatus) {
+			status.Phase = "Failed"
+			status.Message = message
+		}); statusErr != nil {
+			r.Log.Error(statusErr, "Failed to record schema and image mismatch", "service", cxs.Name)
+		}
+		return errors.New(message)
+	}
+
+	if err := r.updateStatusWithRetry(ctx, cxs, func(status *cloudxv1.CloudExpressServiceStatus) {
+		if migrationStatus != nil {
+			status.Migration = migrationStatus
+		}
+		setStatus(status)
+	}); err != nil {
+		if migrationStatus != nil {
+			// Without the migration status the reverted image's migrations
+			// would be run again against the rolled back schema
+			r.recordEvent(cxs, corev1.EventTypeWarning, "SchemaRollbackNotRecorded",
+				fmt.Sprintf("Schema was rolled back for %s but could not be recorded: %v", targetImage, err))
+		}
+		return fmt.Errorf("failed to update status: %w", err)
+	}
+	return nil
+}
+
+// updateStatusWithRetry applies mutate to the latest status of the service,
+// retrying on conflicts, and leaves the saved object in cxs
+func (r *CloudExpressServiceReconciler) updateStatusWithRetry(ctx context.Context, cxs *cloudxv1.CloudExpressService, mutate func(*cloudxv1.CloudExpressServiceStatus)) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		latest := &cloudxv1.CloudExpressService{}
+		if err := r.Get(ctx, client.ObjectKeyFromObject(cxs), latest); err != nil {
+			return err
+		}
+		mutate(&latest.Status)
+		if err := r.Status().Update(ctx, latest); err != nil {
+			return err
+		}
+		*cxs = *latest
+		return nil
+	})
+}
+
+// rollbackSchema migrates the database down to the schema version expected by
+// targetImage when the service's migrations opted in to automatic rollback.
+// It returns the migration status to record once the image has been rolled back.
+func (r *CloudExpressServiceReconciler) rollbackSchema(ctx context.Context, cxs *cloudxv1.CloudExpressService, targetImage string) (*cloudxv1.MigrationStatus, error) {
+	runner := &MigrationRunner{
+		client:     r.Client,
+		kubeClient: r.KubeClient,
+		scheme:     r.Scheme,
+		log:        r.Log.WithName("migration"),
+	}
+
+	return runner.RollbackMigrations(ctx, cxs, targetImage)
+}
+
+// runRollbackHooks runs the service's preRollback hooks before targetImage is restored
+func (r *CloudExpressServiceReconciler) runRollbackHooks(ctx context.Context, cxs *cloudxv1.CloudExpressService, targetImage string) error {
+	runner := &HookRunner{
+		client:     r.Client,
+		kubeClient: r.KubeClient,
+		scheme:     r.Scheme,
+		log:        r.Log.WithName("hooks"),
+	}
+
+	return runner.RunHooksAndWait(ctx, cxs, HookPhasePreRollback, targetImage)
+}
+
 // GetDeploymentStatus returns the current status of a CloudExpressService
 func (r *CloudExpressServiceReconciler) GetDeploymentStatus(ctx context.Context, namespace, name string) (*DeploymentStatus, error) {
 	cxs := &cloudxv1.CloudExpressService{}
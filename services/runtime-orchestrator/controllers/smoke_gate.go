@@ -0,0 +1,237 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	cloudxv1 "github.com/cygni/runtime-orchestrator/api/v1"
+)
+
+// smokeTestLabel selects the pods a rolling update is smoke tested on. The
+// service's own selector does not match them, so they receive no traffic.
+const smokeTestLabel = "cygni.io/smoke-test"
+
+// smokeTargetName names the Deployment and Service a rolling update is smoke tested through
+func smokeTargetName(cxs *cloudxv1.CloudExpressService) string {
+	return fmt.Sprintf("%s-smoke", cxs.Name)
+}
+
+// gatesRolloutOnSmokeTest reports whether a rolling update waits for smoke
+// tests. Canary rollouts run them against the canary backend instead.
+func gatesRolloutOnSmokeTest(cxs *cloudxv1.CloudExpressService) bool {
+	if !hasSmokeTest(cxs) || isHibernated(cxs) {
+		return false
+	}
+	return cxs.Spec.Strategy == nil || cxs.Spec.Strategy.Type != "canary"
+}
+
+// deploymentImage returns the image the Deployment's app container runs
+func deploymentImage(deployment *appsv1.Deployment) string {
+	for _, container := range deployment.Spec.Template.Spec.Containers {
+		if container.Name == "app" {
+			return container.Image
+		}
+	}
+	return ""
+}
+
+// gateRolloutOnSmokeTest holds a rolling update until smoke tests have passed
+// against the new image. The new image runs in a separate Deployment behind
+// its own Service, so the current release keeps all traffic while the tests
+// run. It reports whether the rollout may continue; otherwise the returned
+// result and error should be returned from Reconcile.
+func (r *CloudExpressServiceReconciler) gateRolloutOnSmokeTest(ctx context.Context, cxs *cloudxv1.CloudExpressService, current *appsv1.Deployment) (ctrl.Result, bool, error) {
+	if current != nil && deploymentImage(current) == cxs.Spec.Image {
+		// Already rolled out; drop the smoke test pods of an earlier rollout
+		if err := r.deleteSmokeTarget(ctx, cxs); err != nil {
+			return ctrl.Result{}, false, err
+		}
+		return ctrl.Result{}, true, nil
+	}
+
+	runner := &SmokeTestRunner{
+		client:     r.Client,
+		kubeClient: r.KubeClient,
+		log:        r.Log.WithName("smoke-test"),
+	}
+
+	// A failed run holds the rollout until the image or the smoke test
+	// changes. The target is not recreated for it, as deleting the target
+	// again would trigger another reconcile.
+	previous, err := runner.Existing(ctx, cxs, smokeTargetName(cxs))
+	if err != nil {
+		return ctrl.Result{}, false, err
+	}
+	if previous != nil {
+		if finished, succeeded := jobFinished(previous); finished && !succeeded {
+			return r.holdOnFailedSmokeTest(ctx, cxs, runner, previous)
+		}
+	}
+
+	if err := r.ensureSmokeTarget(ctx, cxs); err != nil {
+		return ctrl.Result{}, false, err
+	}
+
+	target := &appsv1.Deployment{}
+	if err := r.Get(ctx, types.NamespacedName{Name: smokeTargetName(cxs), Namespace: cxs.Namespace}, target); err != nil {
+		return ctrl.Result{}, false, fmt.Errorf("failed to get smoke test deployment: %w", err)
+	}
+	if target.Status.ObservedGeneration < target.Generation || target.Status.UpdatedReplicas < 1 || target.Status.ReadyReplicas < 1 {
+		return r.waitForSmokeTest(ctx, cxs, "Waiting for smoke test pods to become ready")
+	}
+
+	job, err := runner.Start(ctx, cxs, smokeTargetName(cxs))
+	if err != nil {
+		cxs.Status.Phase = "Failed"
+		cxs.Status.Message = fmt.Sprintf("Smoke tests could not be run: %v", err)
+		r.updateStatus(ctx, cxs)
+		return ctrl.Result{}, false, err
+	}
+
+	finished, succeeded := jobFinished(job)
+	if !finished {
+		return r.waitForSmokeTest(ctx, cxs, fmt.Sprintf("Waiting for smoke test job %s", job.Name))
+	}
+
+	if !succeeded {
+		return r.holdOnFailedSmokeTest(ctx, cxs, runner, job)
+	}
+
+	r.Log.Info("Smoke tests passed, rolling out", "service", cxs.Name, "job", job.Name)
+	if err := r.deleteSmokeTarget(ctx, cxs); err != nil {
+		return ctrl.Result{}, false, err
+	}
+	return ctrl.Result{}, true, nil
+}
+
+// holdOnFailedSmokeTest reports a failed smoke test once and removes its
+// target. The job keeps its result until the image or the smoke test
+// changes, so the rollout stays held without rerunning the tests.
+func (r *CloudExpressServiceReconciler) holdOnFailedSmokeTest(ctx context.Context, cxs *cloudxv1.CloudExpressService, runner *SmokeTestRunner, job *batchv1.Job) (ctrl.Result, bool, error) {
+	prefix := fmt.Sprintf("Smoke tests failed (job %s):", job.Name)
+	if cxs.Status.Phase != "Failed" || !strings.HasPrefix(cxs.Status.Message, prefix) {
+		message := fmt.Sprintf("%s\n%s", prefix, runner.logs(ctx, job))
+		r.recordEvent(cxs, corev1.EventTypeWarning, "SmokeTestFailed", message)
+		cxs.Status.Phase = "Failed"
+		cxs.Status.Message = message
+		if err := r.updateStatus(ctx, cxs); err != nil {
+			return ctrl.Result{}, false, err
+		}
+	}
+	return ctrl.Result{}, false, r.deleteSmokeTarget(ctx, cxs)
+}
+
+// waitForSmokeTest requeues while the smoke test pods start or the job runs
+func (r *CloudExpressServiceReconciler) waitForSmokeTest(ctx context.Context, cxs *cloudxv1.CloudExpressService, message string) (ctrl.Result, bool, error) {
+	cxs.Status.Phase = "SmokeTesting"
+	cxs.Status.Message = message
+	if err := r.updateStatus(ctx, cxs); err != nil {
+		return ctrl.Result{}, false, err
+	}
+	return ctrl.Result{RequeueAfter: 5 * time.Second}, false, nil
+}
+
+// ensureSmokeTarget runs one pod of the new image behind a Service of its own
+func (r *CloudExpressServiceReconciler) ensureSmokeTarget(ctx context.Context, cxs *cloudxv1.CloudExpressService) error {
+	labels := map[string]string{
+		smokeTestLabel:        cxs.Name,
+		"cygni.io/managed-by": "runtime-orchestrator",
+	}
+
+	spec := r.constructDeploymentSpec(cxs)
+	replicas := int32(1)
+	spec.Replicas = &replicas
+	spec.Selector = &metav1.LabelSelector{MatchLabels: labels}
+	spec.Template.Labels = labels
+
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      smokeTargetName(cxs),
+			Namespace: cxs.Namespace,
+			Labels:    labels,
+		},
+	}
+	if _, err := controllerutil.CreateOrUpdate(ctx, r.Client, deployment, func() error {
+		deployment.Spec = spec
+		return controllerutil.SetControllerReference(cxs, deployment, r.Scheme)
+	}); err != nil {
+		return fmt.Errorf("failed to apply smoke test deployment: %w", err)
+	}
+
+	// The smoke test job targets its configured port, the first service port or 80
+	servicePorts := append([]int32{}, cxs.Spec.Ports...)
+	if port := cxs.Spec.HealthGate.SmokeTest.Port; port != 0 && !containsPort(servicePorts, port) {
+		servicePorts = append(servicePorts, port)
+	}
+	if len(servicePorts) == 0 {
+		servicePorts = []int32{80}
+	}
+
+	ports := []corev1.ServicePort{}
+	for i, port := range servicePorts {
+		ports = append(ports, corev1.ServicePort{
+			Name:       fmt.Sprintf("port-%d", i),
+			Port:       port,
+			TargetPort: intstr.FromInt(int(port)),
+			Protocol:   corev1.ProtocolTCP,
+		})
+	}
+
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      smokeTargetName(cxs),
+			Namespace: cxs.Namespace,
+			Labels:    labels,
+		},
+	}
+	if _, err := controllerutil.CreateOrUpdate(ctx, r.Client, service, func() error {
+		service.Spec.Type = corev1.ServiceTypeClusterIP
+		service.Spec.Selector = labels
+		service.Spec.Ports = ports
+		return controllerutil.SetControllerReference(cxs, service, r.Scheme)
+	}); err != nil {
+		return fmt.Errorf("failed to apply smoke test service: %w", err)
+	}
+
+	return nil
+}
+
+// deleteSmokeTarget removes the smoke test Deployment and Service
+func (r *CloudExpressServiceReconciler) deleteSmokeTarget(ctx context.Context, cxs *cloudxv1.CloudExpressService) error {
+	deployment := &appsv1.Deployment{}
+	deployment.Name = smokeTargetName(cxs)
+	deployment.Namespace = cxs.Namespace
+	if err := r.Delete(ctx, deployment); err != nil && !errors.IsNotFound(err) {
+		return fmt.Errorf("failed to delete smoke test deployment: %w", err)
+	}
+
+	service := &corev1.Service{}
+	service.Name = smokeTargetName(cxs)
+	service.Namespace = cxs.Namespace
+	if err := r.Delete(ctx, service); err != nil && !errors.IsNotFound(err) {
+		return fmt.Errorf("failed to delete smoke test service: %w", err)
+	}
+
+	return nil
+}
+
+func containsPort(ports []int32, port int32) bool {
+	for _, p := range ports {
+		if p == port {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,76 @@
+package controllers
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/go-logr/logr"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	cloudxv1 "github.com/cygni/runtime-orchestrator/api/v1"
+)
+
+func newTestServiceReconciler(t *testing.T, objects ...client.Object) *CloudExpressServiceReconciler {
+	t.Helper()
+
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := cloudxv1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	return &CloudExpressServiceReconciler{
+		Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(objects...).Build(),
+		Log:    logr.Discard(),
+		Scheme: scheme,
+	}
+}
+
+func TestSmokeGateHoldsFailedRolloutWithoutRecreatingTarget(t *testing.T) {
+	ctx := context.Background()
+
+	cxs := baseService("api", 8080)
+	cxs.Spec.HealthGate = &cloudxv1.HealthGateSpec{
+		Enabled:   true,
+		SmokeTest: &cloudxv1.SmokeTestSpec{HTTPChecks: []cloudxv1.HTTPCheck{{Path: "/healthz"}}},
+	}
+
+	// The smoke test of the new image already failed
+	runner := &SmokeTestRunner{log: logr.Discard()}
+	job := runner.constructSmokeTestJob(cxs, cxs.Spec.HealthGate.SmokeTest, smokeTargetName(cxs))
+	job.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobFailed, Status: corev1.ConditionTrue}}
+
+	r := newTestServiceReconciler(t, cxs, job)
+	current := &appsv1.Deployment{}
+	current.Spec.Template.Spec.Containers = []corev1.Container{{Name: "app", Image: "registry.example.com/shop/api:0.9.0"}}
+
+	for i := 0; i < 3; i++ {
+		_, proceed, err := r.gateRolloutOnSmokeTest(ctx, cxs, current)
+		if err != nil {
+			t.Fatalf("reconcile %d: %v", i, err)
+		}
+		if proceed {
+			t.Fatalf("reconcile %d: rollout proceeded after a failed smoke test", i)
+		}
+
+		target := &appsv1.Deployment{}
+		err = r.Get(ctx, types.NamespacedName{Name: smokeTargetName(cxs), Namespace: cxs.Namespace}, target)
+		if !errors.IsNotFound(err) {
+			t.Fatalf("reconcile %d: smoke target was recreated (err %v)", i, err)
+		}
+		if cxs.Status.Phase != "Failed" || !strings.Contains(cxs.Status.Message, job.Name) {
+			t.Errorf("reconcile %d: status = %s %q, want Failed naming %s", i, cxs.Status.Phase, cxs.Status.Message, job.Name)
+		}
+	}
+}
@@ -0,0 +1,255 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	cloudxv1 "github.com/cygni/runtime-orchestrator/api/v1"
+)
+
+// SmokeTestRunner runs synthetic smoke tests as Jobs against a rollout's pods
+type SmokeTestRunner struct {
+	client     client.Client
+	kubeClient kubernetes.Interface
+	log        logr.Logger
+}
+
+// SmokeTestResult holds the outcome of a smoke test run
+type SmokeTestResult struct {
+	Passed  bool
+	JobName string
+	Logs    string
+}
+
+// hasSmokeTest reports whether a service has smoke tests configured
+func hasSmokeTest(cxs *cloudxv1.CloudExpressService) bool {
+	return cxs.Spec.HealthGate != nil &&
+		cxs.Spec.HealthGate.Enabled &&
+		cxs.Spec.HealthGate.SmokeTest != nil
+}
+
+// validateSmokeTestSpec checks a smoke test before any job is created
+func validateSmokeTestSpec(spec *cloudxv1.SmokeTestSpec) error {
+	if spec.Image == "" && len(spec.HTTPChecks) == 0 {
+		return fmt.Errorf("smoke test requires either an image or HTTP checks")
+	}
+
+	if spec.Timeout != "" {
+		timeout, err := time.ParseDuration(spec.Timeout)
+		if err != nil || timeout <= 0 {
+			return fmt.Errorf("invalid smoke test timeout %q", spec.Timeout)
+		}
+	}
+
+	for _, check := range spec.HTTPChecks {
+		if check.Path == "" {
+			return fmt.Errorf("smoke test HTTP checks require a path")
+		}
+	}
+
+	return nil
+}
+
+// smokeTestTimeout returns the maximum duration of a smoke test job
+func smokeTestTimeout(spec *cloudxv1.SmokeTestSpec) time.Duration {
+	if timeout, err := time.ParseDuration(spec.Timeout); err == nil && timeout > 0 {
+		return timeout
+	}
+	return 5 * time.Minute
+}
+
+// Run executes the smoke tests against the given Service and waits for the result.
+// It blocks, so callers should invoke it from a rollout goroutine rather than Reconcile.
+func (s *SmokeTestRunner) Run(ctx context.Context, cxs *cloudxv1.CloudExpressService, targetService string) (*SmokeTestResult, error) {
+	job, err := s.Start(ctx, cxs, targetService)
+	if err != nil {
+		return nil, err
+	}
+
+	passed, err := waitForJobCompletion(ctx, s.client, job, smokeTestTimeout(cxs.Spec.HealthGate.SmokeTest))
+	if err != nil {
+		return nil, err
+	}
+
+	return &SmokeTestResult{
+		Passed:  passed,
+		JobName: job.Name,
+		Logs:    s.logs(ctx, job),
+	}, nil
+}
+
+// Start creates the smoke test job unless it already exists and returns it
+// without waiting. The job is keyed on the image and the smoke test, so a
+// finished job keeps its result until either changes.
+func (s *SmokeTestRunner) Start(ctx context.Context, cxs *cloudxv1.CloudExpressService, targetService string) (*batchv1.Job, error) {
+	spec := cxs.Spec.HealthGate.SmokeTest
+	if err := validateSmokeTestSpec(spec); err != nil {
+		return nil, err
+	}
+
+	existing, err := s.Existing(ctx, cxs, targetService)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return existing, nil
+	}
+
+	job := s.constructSmokeTestJob(cxs, spec, targetService)
+	if err := s.client.Create(ctx, job); err != nil {
+		return nil, fmt.Errorf("failed to create smoke test job: %w", err)
+	}
+	s.log.Info("Created smoke test job", "job", job.Name, "target", targetService)
+
+	return job, nil
+}
+
+// Existing returns the job Start would reuse, or nil if it has not been created
+func (s *SmokeTestRunner) Existing(ctx context.Context, cxs *cloudxv1.CloudExpressService, targetService string) (*batchv1.Job, error) {
+	job := s.constructSmokeTestJob(cxs, cxs.Spec.HealthGate.SmokeTest, targetService)
+
+	existing := &batchv1.Job{}
+	err := s.client.Get(ctx, types.NamespacedName{
+		Name:      job.Name,
+		Namespace: job.Namespace,
+	}, existing)
+	if errors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to check existing smoke test job: %w", err)
+	}
+	return existing, nil
+}
+
+// logs returns the tail of a smoke test job's output
+func (s *SmokeTestRunner) logs(ctx context.Context, job *batchv1.Job) string {
+	logs, err := jobLogs(ctx, s.client, s.kubeClient, job, "smoke-test")
+	if err != nil {
+		s.log.Error(err, "Failed to capture smoke test logs", "job", job.Name)
+	}
+	return logs
+}
+
+func (s *SmokeTestRunner) constructSmokeTestJob(cxs *cloudxv1.CloudExpressService, spec *cloudxv1.SmokeTestSpec, targetService string) *batchv1.Job {
+	// Key the job on the image and checks under test so retries reuse the
+	// same run, while a corrected smoke test runs again
+	specJSON, _ := json.Marshal(spec)
+	jobName := fmt.Sprintf("%s-smoke-%s", cxs.Name, shortHash(cxs.Spec.Image, targetService, string(specJSON)))
+
+	port := spec.Port
+	if port == 0 && len(cxs.Spec.Ports) > 0 {
+		port = cxs.Spec.Ports[0]
+	}
+	if port == 0 {
+		port = 80
+	}
+	targetURL := fmt.Sprintf("http://%s.%s.svc.cluster.local:%d", targetService, cxs.Namespace, port)
+
+	container := corev1.Container{
+		Name: "smoke-test",
+		Env: []corev1.EnvVar{
+			{
+				Name:  "TARGET_URL",
+				Value: targetURL,
+			},
+			{
+				Name:  "CLOUDEXPRESS_SERVICE",
+				Value: cxs.Name,
+			},
+		},
+	}
+
+	if spec.Image != "" {
+		container.Image = spec.Image
+		container.Command = spec.Command
+	} else {
+		container.Image = "curlimages/curl:8.5.0"
+		container.Command = []string{"sh", "-c", buildHTTPCheckScript(spec.HTTPChecks)}
+	}
+
+	return &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      jobName,
+			Namespace: cxs.Namespace,
+			Labels: map[string]string{
+				"cygni.io/service": cxs.Name,
+				"cygni.io/type":    "smoke-test",
+			},
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit:            &[]int32{0}[0],
+			ActiveDeadlineSeconds:   &[]int64{int64(smokeTestTimeout(spec).Seconds())}[0],
+			TTLSecondsAfterFinished: &[]int32{3600}[0], // Clean up after 1 hour
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: map[string]string{
+						"cygni.io/service": cxs.Name,
+						"cygni.io/type":    "smoke-test",
+					},
+				},
+				Spec: corev1.PodSpec{
+					RestartPolicy: corev1.RestartPolicyNever,
+					Containers:    []corev1.Container{container},
+				},
+			},
+		},
+	}
+}
+
+// buildHTTPCheckScript renders HTTP checks into a POSIX shell script run with curl
+func buildHTTPCheckScript(checks []cloudxv1.HTTPCheck) string {
+	var b strings.Builder
+	b.WriteString("fail=0\n")
+
+	for _, check := range checks {
+		method := check.Method
+		if method == "" {
+			method = "GET"
+		}
+		expected := check.ExpectedStatus
+		if expected == 0 {
+			expected = 200
+		}
+
+		fmt.Fprintf(&b, "echo %s\n", shellQuote(fmt.Sprintf("==> %s %s", method, check.Path)))
+		fmt.Fprintf(&b,
+			"out=$(curl -s -o /tmp/body -w '%%{http_code} %%{time_total}' -X %s \"$TARGET_URL\"%s) || { echo '  request failed'; fail=1; }\n",
+			shellQuote(method), shellQuote(check.Path))
+		b.WriteString("code=${out%% *}; secs=${out##* }\n")
+		fmt.Fprintf(&b, "if [ \"$code\" != \"%d\" ]; then echo \"  expected status %d, got $code\"; fail=1; fi\n",
+			expected, expected)
+
+		if check.MaxLatency > 0 {
+			b.WriteString("ms=$(awk \"BEGIN { printf \\\"%d\\\", $secs * 1000 }\")\n")
+			fmt.Fprintf(&b, "if [ \"$ms\" -gt %d ]; then echo \"  latency ${ms}ms exceeds %dms\"; fail=1; fi\n",
+				check.MaxLatency, check.MaxLatency)
+		}
+
+		if check.BodyRegex != "" {
+			fmt.Fprintf(&b, "if ! grep -Eq %s /tmp/body; then echo %s; fail=1; fi\n",
+				shellQuote(check.BodyRegex),
+				shellQuote(fmt.Sprintf("  body does not match %s", check.BodyRegex)))
+		}
+	}
+
+	b.WriteString("exit $fail\n")
+	return b.String()
+}
+
+// shellQuote wraps a value in single quotes for safe use in sh scripts
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}